@@ -1,26 +1,49 @@
 package api
 
 import (
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"html"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/jakubruminski/FYP/go/api/deals"
 	"github.com/jakubruminski/FYP/go/api/fetch"
+	"github.com/jakubruminski/FYP/go/api/image_proxy"
+	"github.com/jakubruminski/FYP/go/api/match"
+	"github.com/jakubruminski/FYP/go/api/normalise"
 	"github.com/jakubruminski/FYP/go/api/product"
-	"github.com/jakubruminski/FYP/go/api/query"
+	"github.com/jakubruminski/FYP/go/api/relevance"
+	"github.com/jakubruminski/FYP/go/api/repository"
+	"github.com/jakubruminski/FYP/go/api/suggest"
 
 	"github.com/jakubruminski/FYP/go/utils/env"
 	"github.com/jakubruminski/FYP/go/utils/http/response"
 	"github.com/jakubruminski/FYP/go/utils/logger"
 	"github.com/jakubruminski/FYP/go/utils/postgres"
 	"github.com/jakubruminski/FYP/go/utils/token"
+	"github.com/jakubruminski/FYP/go/utils/unit"
 )
 
 type Products struct {
-	Results  *[]*product.Product               `json:"results"`
+	Results  *[]*product.Product               `json:"results,omitempty"`  // left out when grouped into sections
+	Sections []*product.Section                `json:"sections,omitempty"`
+	Currency map[string]map[string]interface{} `json:"currency,omitempty"`  // only on the first page
+	Meta     *Meta                             `json:"meta,omitempty"`
+}
+
+type Meta struct {
+	Total        int            `json:"total"`          // results after filtering, across every page
+	SellerTotals map[string]int `json:"seller_totals"`
+	PageSize     int            `json:"page_size"`      // 0 when everything is returned at once
+	Sort         string         `json:"sort"`
+	NextCursor   string         `json:"next_cursor,omitempty"`
+}
+
+type Comparison struct {
+	Groups   []*match.Group                    `json:"groups"`
 	Currency map[string]map[string]interface{} `json:"currency"`
 }
 
@@ -41,6 +64,31 @@ func GetResponse(logger *logger.Logger, r *http.Request, w http.ResponseWriter)
 
 	} else if r.URL.Path == "/api/remove_item" {
 		return removeItemHandler(logger, w, r)
+
+	} else if r.URL.Path == "/api/compare" {
+		return compareHandler(logger, w, r)
+
+	} else if strings.HasPrefix(r.URL.Path, productPathPrefix) && strings.HasSuffix(r.URL.Path, "/history") {
+		return historyHandler(logger, w, r)
+
+	} else if r.URL.Path == "/api/suggest" {
+		return suggestHandler(logger, w, r)
+
+	} else if r.URL.Path == "/api/deals" {
+		return dealsHandler(logger, w, r)
+
+	} else if r.URL.Path == "/api/watch" {
+		return watchHandler(logger, w, r)
+
+	} else if r.URL.Path == "/api/watches" {
+		return watchesHandler(logger, w, r)
+
+	} else if r.URL.Path == "/api/unwatch" {
+		return unwatchHandler(logger, w, r)
+
+	} else if r.URL.Path == "/api/inbox" {
+		return inboxHandler(logger, w, r)
+
 	}
 
 	logger.ERROR("Invalid request %s", r.URL.Path)
@@ -50,44 +98,99 @@ func GetResponse(logger *logger.Logger, r *http.Request, w http.ResponseWriter)
 func getProductsHandler(logger *logger.Logger, w http.ResponseWriter, r *http.Request) (jsonResponse []byte, ok bool) {
 	searchTerm := parseSearchValue(r.FormValue("search_term"))
 	searchTerm = strings.ToLower(searchTerm)
+	cacheKey := normalise.Key(logger, searchTerm)
+
+	comparator, ok := product.Sorting(r.FormValue("sort"), r.FormValue("order"))
+	if !ok {
+		logger.ERROR("Invalid sort '%s' or order '%s'", r.FormValue("sort"), r.FormValue("order"))
+		response.WriteResponse(logger, w, http.StatusBadRequest, "application/json", "error", "Invalid sort or order")
+		return nil, true
+	}
+
+	filter, ok := product.ParseFilter(logger, r)
+	if !ok {
+		logger.ERROR("Invalid filter")
+		response.WriteResponse(logger, w, http.StatusBadRequest, "application/json", "error", "Invalid filter")
+		return nil, true
+	}
+
+	sorting := product.SortingName(r.FormValue("sort"), r.FormValue("order"))
+
+	pageSize, cursor, ok := parsePage(logger, r, sorting)
+	if !ok {
+		response.WriteResponse(logger, w, http.StatusBadRequest, "application/json", "error", "Invalid page_size or cursor")
+		return nil, true
+	}
+
+	grouped, convertTo, ok := parseUnitOptions(logger, r)
+	if !ok {
+		response.WriteResponse(logger, w, http.StatusBadRequest, "application/json", "error", "Invalid group_by or convert_to")
+		return nil, true
+	}
 
 	products := &[]*product.Product{}
 
-	ok = postgres.ExecuteInTransaction(logger, getProducts_DoInTransaction, products, searchTerm)
+	// A search may scrape the sellers, which isn't worth doing twice over a serialisation failure
+	ok = repository.Default.InTransaction(logger, r.Context(), postgres.Once, func(repos *repository.Repositories) bool {
+		return getProducts_DoInTransaction(logger, repos, products, searchTerm, cacheKey, filter)
+	})
 	if !ok && len(*products) == 0 {
 		logger.ERROR("Failed to get products")
 		return nil, false
 	}
-	if len(*products) == 0 {
+	// A filter may leave nothing, that is still a valid answer
+	if len(*products) == 0 && filter.IsEmpty() {
 		logger.ERROR("No products found")
 		return nil, false
 	}
 
-	currency, ok := getCurrency(logger)
+	if convertTo != "" {
+		converted := product.ConvertUnits(products, convertTo)
+		logger.DEBUG("Converted %d products to prices per %s", converted, convertTo)
+	}
+
+	// Off-topic hits, like shampoo when searching for milk, go after everything relevant in every sort
+	relevance.Score(logger, searchTerm, products)
+	comparator = product.Then(product.RelevantFirst(relevance.Threshold(logger)), comparator)
+
+	// Cached and freshly scraped results are both sorted here, so changing the sort never scrapes again
+	product.SortBy(products, comparator)
+
+	meta := &Meta{Total: len(*products), SellerTotals: map[string]int{}, PageSize: pageSize, Sort: sorting}
+	for _, product := range *products {
+		meta.SellerTotals[product.Seller]++
+	}
+	for seller, total := range meta.SellerTotals {
+		logger.INFO("%s: %d", seller, total)
+	}
+
+	meta.NextCursor = product.Paginate(products, comparator, sorting, cursor, pageSize)
+
+	// The currency table doesn't change between pages, so only the first one carries it
+	var currency map[string]map[string]interface{}
+	if cursor == nil {
+		currency, ok = getCurrency(logger)
+		if !ok {
+			logger.ERROR("Failed to get currency")
+			return nil, false
+		}
+	}
+
+	ok = convertProducts(logger, products, r.FormValue("currency"))
 	if !ok {
-		logger.ERROR("Failed to get currency")
+		logger.ERROR("Failed to convert products to currency '%s'", r.FormValue("currency"))
 		return nil, false
 	}
 
-	numberOfProductsForTesco := 0
-	numberOfProductsForDunnes := 0
-	numberOfProductsForSuperValu := 0
-	for _, product := range *products {	
-		if product.Seller == "Tesco" {
-			numberOfProductsForTesco++
-			
-		} else if product.Seller == "Dunnes" {
-			numberOfProductsForDunnes++
+	image_proxy.ProxyProducts(logger, products)
 
-		} else if product.Seller == "SuperValu" {
-			numberOfProductsForSuperValu++
-		}
+	result := Products{Results: products, Currency: currency, Meta: meta}
+	if grouped {
+		result.Sections = product.Sections(products)
+		result.Results = nil
 	}
-	logger.INFO("Tesco: %d", numberOfProductsForTesco)
-	logger.INFO("Dunnes: %d", numberOfProductsForDunnes)
-	logger.INFO("SuperValu: %d", numberOfProductsForSuperValu)
 
-	jsonResponse, err := json.Marshal(Products{Results: products, Currency: currency})
+	jsonResponse, err := json.Marshal(result)
 	if err != nil {
 		logger.ERROR("Failed to marshal response: %s", err)
 		return nil, false
@@ -97,56 +200,167 @@ func getProductsHandler(logger *logger.Logger, w http.ResponseWriter, r *http.Re
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(jsonResponse)
 
+	suggest.Default.Record(suggest.SearchText(cacheKey))
+
 	logger.INFO("Client /logs/%s.txt searched for %s and got %d results", logger.ClientID, searchTerm, len(*products))
 
 	return jsonResponse, true
 }
 
 
-func getProducts_DoInTransaction(logger *logger.Logger, tx *sql.Tx, args ...interface{}) bool {
+// parsePage reads page_size and cursor. Without page_size every result is returned, as before,
+// otherwise it is capped at MAX_PAGE_SIZE. A cursor is only valid with the sort it was made for.
+func parsePage(logger *logger.Logger, r *http.Request, sorting string) (pageSize int, cursor *product.Cursor, ok bool) {
+	if r.FormValue("page_size") != "" {
+		size, err := strconv.Atoi(r.FormValue("page_size"))
+		if err != nil || size < 1 {
+			logger.ERROR("Invalid page_size '%s'", r.FormValue("page_size"))
+			return 0, nil, false
+		}
+		pageSize = min(size, env.GetIntDefault(logger, "MAX_PAGE_SIZE", 100))
+	}
 
-    if len(args) != 2 {
-        logger.ERROR("Expected 2 arguments, got %d", len(args))
-        return false
-    }
+	cursor, ok = product.ParseCursor(logger, r.FormValue("cursor"))
+	if !ok {
+		return 0, nil, false
+	}
+	if cursor != nil && cursor.Sorting != sorting {
+		logger.ERROR("Cursor was made for sort '%s', not '%s'", cursor.Sorting, sorting)
+		return 0, nil, false
+	}
 
-    products, ok := args[0].(*[]*product.Product)
-    if !ok {
-        logger.ERROR("Failed to get products")
-        return false
-    }
+	return pageSize, cursor, true
+}
 
-    searchTerm, ok := args[1].(string)
-    if !ok {
-		logger.ERROR("Failed to get search term")
-        return false
-    }
 
-	db_available, ok := env.GetBool(logger, "DB_AVAILABLE")
-	if !ok { return false }
+// parseUnitOptions reads group_by=dimension, which returns results in sections per kg, per litre,
+// per item and so on, and convert_to, a dimension ("mass") or its unit ("kilogram") to reprice
+// products into when their pack size allows it.
+func parseUnitOptions(logger *logger.Logger, r *http.Request) (grouped bool, convertTo unit.Dimension, ok bool) {
+	switch strings.ToLower(r.FormValue("group_by")) {
+	case "":
+	case "dimension", "unit_type":
+		grouped = true
+	default:
+		logger.ERROR("Invalid group_by '%s'", r.FormValue("group_by"))
+		return false, "", false
+	}
 
-	found := false
-	expired := false
-	if db_available {
-		found, expired, ok := query.Products(logger, tx, products, searchTerm)
+	target := strings.ToLower(strings.TrimSpace(r.FormValue("convert_to")))
+	if target == "" {
+		return grouped, "", true
+	}
 
-		if !ok {
-			logger.ERROR("Failed to get products from database")
+	if u, found := unit.ByName(target); found {
+		return grouped, u.Dimension, true
+	}
+	for _, dimension := range unit.Dimensions {
+		if string(dimension) == target {
+			return grouped, dimension, true
+		}
+	}
+
+	logger.ERROR("Invalid convert_to '%s'", r.FormValue("convert_to"))
+	return false, "", false
+}
+
+
+// compareHandler groups the results of a search into products that are the same across sellers.
+// With product_id set, only the group containing that product is returned.
+func compareHandler(logger *logger.Logger, w http.ResponseWriter, r *http.Request) (jsonResponse []byte, ok bool) {
+	searchTerm := parseSearchValue(r.FormValue("search_term"))
+	searchTerm = strings.ToLower(searchTerm)
+	cacheKey := normalise.Key(logger, searchTerm)
+
+	products := &[]*product.Product{}
+
+	ok = repository.Default.InTransaction(logger, r.Context(), postgres.Once, func(repos *repository.Repositories) bool {
+		return getProducts_DoInTransaction(logger, repos, products, searchTerm, cacheKey, &product.Filter{})
+	})
+	if !ok && len(*products) == 0 {
+		logger.ERROR("Failed to get products")
+		return nil, false
+	}
+
+	groups := match.Groups(logger, products)
+
+	if r.FormValue("product_id") != "" {
+		productID, err := strconv.ParseInt(r.FormValue("product_id"), 10, 64)
+		if err != nil {
+			logger.ERROR("Invalid product_id '%s'", r.FormValue("product_id"))
+			response.WriteResponse(logger, w, http.StatusBadRequest, "application/json", "error", "Invalid product_id")
+			return nil, true
 		}
-		if !expired && found {
-			logger.INFO("Products found in database")
-			return true
+
+		group, found := match.GroupOf(groups, productID)
+		groups = []*match.Group{}
+		if found {
+			groups = append(groups, group)
 		}
 	}
 
+	image_proxy.ProxyProducts(logger, products)
+
+	ok = convertProducts(logger, products, r.FormValue("currency"))
+	if !ok {
+		logger.ERROR("Failed to convert products to currency '%s'", r.FormValue("currency"))
+		return nil, false
+	}
+
+	currency, ok := getCurrency(logger)
+	if !ok {
+		logger.ERROR("Failed to get currency")
+		return nil, false
+	}
+
+	jsonResponse, err := json.Marshal(Comparison{Groups: groups, Currency: currency})
+	if err != nil {
+		logger.ERROR("Failed to marshal response: %s", err)
+		return nil, false
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonResponse)
+
+	logger.INFO("Client /logs/%s.txt compared %s and got %d groups", logger.ClientID, searchTerm, len(groups))
+
+	return jsonResponse, true
+}
+
+
+// getProducts_DoInTransaction looks searches up and caches them under cacheKey, the normalised
+// search term, but asks the sellers for searchTerm, the way the client worded it.
+func getProducts_DoInTransaction(
+	logger *logger.Logger,
+	repos *repository.Repositories,
+	products *[]*product.Product,
+	searchTerm, cacheKey string,
+	filter *product.Filter,
+) bool {
+
+	found, expired, ok := repos.Searches.Products(logger, products, cacheKey, filter)
+	if !ok {
+		logger.ERROR("Failed to get products from database")
+	}
+	if !expired && found {
+		logger.INFO("Products found in database")
+		return true
+	}
+
 	var oldProducts []*product.Product
 	if expired {
-		oldProducts = make([]*product.Product, len(*products))
-		copy(oldProducts, *products)
-	
 		// Reset *products to an empty slice, without allocating new memory
 		*products = (*products)[:0]
-	
+
+		// The cached products were filtered for this client, telling which ones sellers stopped
+		// listing needs all of them
+		ok = repos.Searches.Cached(logger, &oldProducts, cacheKey)
+		if !ok {
+			logger.WARN("Failed to get expired products, none will be marked missing")
+			oldProducts = nil
+		}
+
 		logger.DEBUG_WARN("Products expired in database")
 	}
 
@@ -166,39 +380,29 @@ func getProducts_DoInTransaction(logger *logger.Logger, tx *sql.Tx, args ...inte
 		logger.ERROR("No products found")
 		return true
 	}
-    if db_available {
-		ok = query.AddProducts(logger, tx, searchTerm, &oldProducts, products)
-		if !ok {
-			logger.ERROR("Failed to add products to database")
-			return false
-		}
-
-		ok = query.AddSearchTerm(logger, tx, searchTerm, products)
-		if !ok {
-			logger.ERROR("Failed to add search term to database")
-			return false
-		}
+	ok = repos.Products.Add(logger, &oldProducts, products)
+	if !ok {
+		logger.ERROR("Failed to add products to database")
+		return false
 	}
 
-	return true
-}
+	ok = repos.Searches.Add(logger, cacheKey, products)
+	if !ok {
+		logger.ERROR("Failed to add search term to database")
+		return false
+	}
 
+	// Deals on offer now are added to the feed, ones that ended are dropped
+	added, removed := deals.Default.Update(products, time.Now().Unix())
+	logger.DEBUG("Deals feed: %d added, %d removed", added, removed)
 
-// TODO: These should be fetched and not hardcoded.
-func getCurrency(logger *logger.Logger) (Rates map[string]map[string]interface{}, ok bool) {
-	Rates = map[string]map[string]interface{}{
-		"Canada":     {"rate": 1.44, "symbol": "C$"},
-		"India":      {"rate": 89.42, "symbol": "₹"},
-		"Costa Rica": {"rate": 588.03, "symbol": "₡"},
-		"Australia":  {"rate": 1.63, "symbol": "A$"},
-		"UK":         {"rate": 0.86, "symbol": "£"},
-		"Euro":       {"rate": 1.0, "symbol": "€"},
-		"Poland":     {"rate": 4.46, "symbol": "zł"},
-	}
+	// Everything scraped is stored above, only the response is filtered
+	filter.Apply(products)
 
-	return Rates, true
+	return true
 }
 
+
 // This function escapes html characters and replaces spaces with "%20"
 func parseSearchValue(searchValue string) string {
 
@@ -224,14 +428,6 @@ func parseSearchValue(searchValue string) string {
 
 
 func addItemHandler(logger *logger.Logger, w http.ResponseWriter, r *http.Request) (jsonResponse []byte, ok bool) {
-	db_available, ok := env.GetBool(logger, "DB_AVAILABLE")
-	if !ok { return nil, false }
-
-	if !db_available {
-		message := "Sorry, could not add this product"
-		response.WriteResponse(logger, w, http.StatusOK, "application/json", "message", message)
-	}
-
 	logger.INFO("Request: %s", r.URL.Path)
 
 	clientID, ok := token.GetID(logger, r)
@@ -248,7 +444,9 @@ func addItemHandler(logger *logger.Logger, w http.ResponseWriter, r *http.Reques
 
 	logger.DEBUG("Adding product to basket id: %d", product.ID)
 
-	ok = postgres.ExecuteInTransaction(logger, AddItem_DoInTransaction, clientID, product)
+	ok = repository.Default.InTransaction(logger, r.Context(), nil, func(repos *repository.Repositories) bool {
+		return repos.Baskets.Add(logger, clientID, product.ID)
+	})
 	if !ok {
 		logger.ERROR("Failed to add product to basket")
 		return nil, false
@@ -261,40 +459,9 @@ func addItemHandler(logger *logger.Logger, w http.ResponseWriter, r *http.Reques
 }
 
 
-func AddItem_DoInTransaction(logger *logger.Logger, tx *sql.Tx, args ...interface{}) bool {
-	if len(args) != 2 {
-		logger.ERROR("Expected 2 arguments, got %d", len(args))
-		return false
-	}
-
-	clientID, ok := args[0].(string)
-	if !ok {
-		logger.ERROR("Failed to get client ID")
-		return false
-	}
-
-	product, ok := args[1].(*product.Product)
-	if !ok {
-		logger.ERROR("Failed to get product")
-		return false
-	}
-
-	return query.AddToBaskets(logger, tx, clientID, *product)
-}
-
-
 func getItemsHandler(logger *logger.Logger, w http.ResponseWriter, r *http.Request) (jsonResponse []byte, ok bool) {
 	logger.INFO("Request: %s", r.URL.Path)
 
-	db_available, ok := env.GetBool(logger, "DB_AVAILABLE")
-	if !ok { return nil, false }
-
-	if !db_available {
-		message := "Sorry, cannot display products at this time."
-		response.WriteResponse(logger, w, http.StatusOK, "application/json", "message", message)
-		return nil, true
-	}
-
 	clientID, ok := token.GetID(logger, r)
 	if !ok {
 		logger.ERROR("Failed to get client ID")
@@ -302,12 +469,23 @@ func getItemsHandler(logger *logger.Logger, w http.ResponseWriter, r *http.Reque
 	}
 
 	products := &[]*product.Product{}
-	ok = postgres.ExecuteInTransaction(logger, getItems_DoInTransaction, clientID, products)
+	ok = repository.Default.InTransaction(logger, r.Context(), postgres.ReadOnly, func(repos *repository.Repositories) bool {
+		*products = (*products)[:0]
+		return repos.Baskets.Get(logger, clientID, products)
+	})
 	if !ok {
 		logger.ERROR("Failed to get products")
 		return nil, false
 	}
 
+	image_proxy.ProxyProducts(logger, products)
+
+	ok = convertProducts(logger, products, r.FormValue("currency"))
+	if !ok {
+		logger.ERROR("Failed to convert products to currency '%s'", r.FormValue("currency"))
+		return nil, false
+	}
+
 	jsonResponse, err := json.Marshal(Products{Results: products})
 	if err != nil {
 		logger.ERROR("Failed to marshal response")
@@ -321,39 +499,9 @@ func getItemsHandler(logger *logger.Logger, w http.ResponseWriter, r *http.Reque
 	return jsonResponse, true
 }
 
-
-func getItems_DoInTransaction(logger *logger.Logger, tx *sql.Tx, args ...interface{}) bool {
-	if len(args) != 2 {
-		logger.ERROR("Expected 2 arguments, got %d", len(args))
-		return false
-	}
-
-	clientID, ok := args[0].(string)
-	if !ok {
-		logger.ERROR("Failed to get client ID")
-		return false
-	}
-
-	products, ok := args[1].(*[]*product.Product)
-	if !ok {
-		logger.ERROR("Failed to get products")
-		return false
-	}
-
-	return query.Baskets(logger, tx, clientID, products)
-}
-
 func removeItemHandler(logger *logger.Logger, w http.ResponseWriter, r *http.Request) (jsonResponse []byte, ok bool) {
 	logger.INFO("Request: %s", r.URL.Path)
 
-	db_available, ok := env.GetBool(logger, "DB_AVAILABLE")
-	if !ok { return nil, false }
-
-	if !db_available {
-		message := "Sorry, could not remove this product"
-		response.WriteResponse(logger, w, http.StatusOK, "application/json", "message", message)
-	}
-
 	clientID, ok := token.GetID(logger, r)
 	if !ok {
 		logger.ERROR("Failed to get client ID")
@@ -368,7 +516,9 @@ func removeItemHandler(logger *logger.Logger, w http.ResponseWriter, r *http.Req
 
 	logger.DEBUG("Removing product from basket id: %d", product.ID)
 
-	ok = postgres.ExecuteInTransaction(logger, RemoveItem_DoInTransaction, clientID, product)
+	ok = repository.Default.InTransaction(logger, r.Context(), nil, func(repos *repository.Repositories) bool {
+		return repos.Baskets.Remove(logger, clientID, product.ID)
+	})
 	if !ok {
 		logger.ERROR("Failed to remove product from basket")
 		return nil, false
@@ -379,24 +529,3 @@ func removeItemHandler(logger *logger.Logger, w http.ResponseWriter, r *http.Req
 
 	return nil, true
 }
-
-func RemoveItem_DoInTransaction(logger *logger.Logger, tx *sql.Tx, args ...interface{}) bool {
-	if len(args) != 2 {
-		logger.ERROR("Expected 2 arguments, got %d", len(args))
-		return false
-	}
-
-	clientID, ok := args[0].(string)
-	if !ok {
-		logger.ERROR("Failed to get client ID")
-		return false
-	}
-
-	product, ok := args[1].(*product.Product)
-	if !ok {
-		logger.ERROR("Failed to get product")
-		return false
-	}
-
-	return query.RemoveFromBasket(logger, tx, clientID, *product)
-}
\ No newline at end of file
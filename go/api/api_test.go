@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jakubruminski/FYP/go/api/product"
+	"github.com/jakubruminski/FYP/go/api/repository"
+	"github.com/jakubruminski/FYP/go/api/watch"
+	"github.com/jakubruminski/FYP/go/utils/logger"
+	"github.com/jakubruminski/FYP/go/utils/token"
+)
+
+func serve(t *testing.T, logger *logger.Logger, handler func(*logger.Logger, http.ResponseWriter, *http.Request) ([]byte, bool), cookie *http.Cookie, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api/basket", strings.NewReader(body))
+	r.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	if _, ok := handler(logger, w, r); !ok {
+		t.Fatalf("Handler failed for '%s'", body)
+	}
+	return w
+}
+
+// get serves a GET of target and decodes the JSON answer into value.
+func get(t *testing.T, logger *logger.Logger, handler func(*logger.Logger, http.ResponseWriter, *http.Request) ([]byte, bool), cookie *http.Cookie, target string, value interface{}) {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	r.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	if _, ok := handler(logger, w, r); !ok || w.Code != http.StatusOK {
+		t.Fatalf("Handler failed for '%s' with status %d: %s", target, w.Code, w.Body.String())
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), value); err != nil {
+		t.Fatalf("Failed to decode '%s': %s", w.Body.String(), err)
+	}
+}
+
+// The basket handlers run against the memory store, no database needed.
+func TestBasketHandlers(t *testing.T) {
+	logger := &logger.Logger{}
+	t.Setenv("TOKEN_KEY", "test key")
+	t.Setenv("TOKEN_EXPIRY", "1")
+
+	defaultStore := repository.Default
+	repository.Default = repository.NewMemory()
+	defer func() { repository.Default = defaultStore }()
+
+	products := &[]*product.Product{
+		{Seller: "Tesco", Name: "Milk 2L", Price: 2.50, URL: "tesco/milk"},
+		{Seller: "Dunnes", Name: "Bread", Price: 1.80, URL: "dunnes/bread"},
+	}
+	stored := repository.Default.InTransaction(logger, context.Background(), nil, func(repos *repository.Repositories) bool {
+		return repos.Products.Add(logger, &[]*product.Product{}, products)
+	})
+	if !stored {
+		t.Fatalf("Failed to store products")
+	}
+
+	recorder := httptest.NewRecorder()
+	if !token.CreateToken(logger, recorder, "client") {
+		t.Fatalf("Failed to create token")
+	}
+	cookie := recorder.Result().Cookies()[0]
+
+	serve(t, logger, addItemHandler, cookie, `{"result": {"id": 2, "name": "Bread"}}`)
+	serve(t, logger, addItemHandler, cookie, `{"result": {"id": 1, "name": "Milk 2L"}}`)
+	serve(t, logger, removeItemHandler, cookie, `{"result": {"id": 2, "name": "Bread"}}`)
+
+	w := serve(t, logger, getItemsHandler, cookie, "")
+	var response Products
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode '%s': %s", w.Body.String(), err)
+	}
+	if response.Results == nil || len(*response.Results) != 1 || (*response.Results)[0].Name != "Milk 2L" {
+		t.Errorf("Expected the basket to hold the milk, but got '%s'", w.Body.String())
+	}
+}
+
+// Watches, the inbox and price history run against the memory store too.
+func TestWatchAndHistoryHandlers(t *testing.T) {
+	logger := &logger.Logger{}
+	t.Setenv("TOKEN_KEY", "test key")
+	t.Setenv("TOKEN_EXPIRY", "1")
+
+	defaultStore := repository.Default
+	repository.Default = repository.NewMemory()
+	defer func() { repository.Default = defaultStore }()
+
+	recorder := httptest.NewRecorder()
+	if !token.CreateToken(logger, recorder, "client") {
+		t.Fatalf("Failed to create token")
+	}
+	cookie := recorder.Result().Cookies()[0]
+
+	var added watch.Watch
+	get(t, logger, watchHandler, cookie, "/api/watch?search_term=milk&target_unit_price=1.10&unit_type=litre", &added)
+	if added.ID == 0 {
+		t.Fatalf("Expected the watch to be stored")
+	}
+
+	scraped := &[]*product.Product{
+		{Seller: "Tesco", Name: "Milk 2L", Price: 2.00, PricePerUnit: 1.00, UnitType: "litre", URL: "tesco/milk"},
+	}
+	stored := repository.Default.InTransaction(logger, context.Background(), nil, func(repos *repository.Repositories) bool {
+		return repos.Products.Add(logger, &[]*product.Product{}, scraped) && repos.Searches.Add(logger, "milk", scraped)
+	})
+	if !stored {
+		t.Fatalf("Failed to store products")
+	}
+
+	var inbox Inbox
+	get(t, logger, inboxHandler, cookie, "/api/inbox", &inbox)
+	if inbox.Unread != 1 || len(*inbox.Notifications) != 1 || (*inbox.Notifications)[0].WatchID != added.ID {
+		t.Errorf("Expected one unread notification for the watch, but got %d", inbox.Unread)
+	}
+
+	var priceHistory PriceHistory
+	get(t, logger, historyHandler, cookie, fmt.Sprintf("/api/product/%d/history", (*scraped)[0].ID), &priceHistory)
+	if len(priceHistory.Observations) != 1 || priceHistory.Observations[0].Price != 2.00 {
+		t.Errorf("Expected the scraped price in the history, but got %d observations", len(priceHistory.Observations))
+	}
+
+	var watches Watches
+	get(t, logger, unwatchHandler, cookie, fmt.Sprintf("/api/unwatch?watch_id=%d", added.ID), &map[string]interface{}{})
+	get(t, logger, watchesHandler, cookie, "/api/watches", &watches)
+	if watches.Watches == nil || len(*watches.Watches) != 0 {
+		t.Errorf("Expected the watch to be removed")
+	}
+}
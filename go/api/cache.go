@@ -0,0 +1,60 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/jakubruminski/FYP/go/api/query"
+
+	"github.com/jakubruminski/FYP/go/utils/env"
+	"github.com/jakubruminski/FYP/go/utils/logger"
+	"github.com/jakubruminski/FYP/go/utils/postgres"
+)
+
+
+// StartCacheGC removes old searches and the products left without one every
+// CACHE_GC_INTERVAL_MINUTES.
+//
+// Expired searches are kept for SEARCH_RETENTION_IN_DAYS, so a refresh can still tell which
+// products went missing and autocomplete keeps their popularity. Products no search, basket or
+// watch refers to go once they weren't seen for ORPHAN_GRACE_IN_HOURS. It stops when ctx is done.
+func StartCacheGC(logger *logger.Logger, ctx context.Context) {
+	interval := env.GetIntDefault(logger, "CACHE_GC_INTERVAL_MINUTES", 60)
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				collectGarbage(logger, ctx)
+			}
+		}
+	}()
+
+	logger.INFO("Collecting cache garbage every %d minutes", interval)
+}
+
+func collectGarbage(logger *logger.Logger, ctx context.Context) {
+	retention := env.GetIntDefault(logger, "SEARCH_RETENTION_IN_DAYS", 7)
+	grace := env.GetIntDefault(logger, "ORPHAN_GRACE_IN_HOURS", 24)
+
+	now := time.Now()
+	expiredBefore := now.Add(-time.Duration(retention) * 24 * time.Hour).Unix()
+	unseenSince := now.Add(-time.Duration(grace) * time.Hour).Unix()
+
+	var searches, products int64
+	ok := postgres.ExecuteInTransaction(logger, ctx, nil, func(tx *postgres.Tx) (ok bool) {
+		searches, products, ok = query.CollectGarbage(logger, tx, expiredBefore, unseenSince)
+		return ok
+	})
+	if !ok {
+		logger.ERROR("Failed to collect cache garbage")
+		return
+	}
+
+	logger.INFO("Removed %d expired searches and %d orphaned products", searches, products)
+}
@@ -0,0 +1,237 @@
+package classify
+
+import (
+	_ "embed"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jakubruminski/FYP/go/api/product"
+
+	"github.com/jakubruminski/FYP/go/utils/env"
+	"github.com/jakubruminski/FYP/go/utils/logger"
+	"github.com/jakubruminski/FYP/go/utils/text"
+)
+
+
+// The built in taxonomy, used unless CLASSIFY_TAXONOMY_FILE points at another one.
+//
+//go:embed taxonomy.json
+var defaultTaxonomy []byte
+
+
+type Taxonomy struct {
+	OwnBrands  []*OwnBrand  `json:"own_brands"`
+	Brands     []string     `json:"brands"`
+	Categories []*Category  `json:"categories"`
+
+	matchers   []brandMatcher
+}
+
+type OwnBrand struct {
+	Name  string   `json:"name"`   // as shown to users, e.g. "Tesco Finest"
+	Match []string `json:"match"`  // other ways names start with it, e.g. "simply better"
+}
+
+// Category is picked when a product name contains one of its keywords and none of its exclusions.
+type Category struct {
+	Name     string   `json:"name"`
+	Keywords []string `json:"keywords"`
+	Exclude  []string `json:"exclude"`
+
+	keywords [][]string
+	exclude  [][]string
+}
+
+type Brand struct {
+	Name     string
+	OwnBrand bool
+}
+
+type brandMatcher struct {
+	text  string  // normalised
+	brand Brand
+}
+
+
+var (
+	once     sync.Once
+	taxonomy *Taxonomy
+)
+
+// Default returns the taxonomy from CLASSIFY_TAXONOMY_FILE, or the built in one if the
+// variable is unset or the file can't be used. It is loaded once.
+func Default(logger *logger.Logger) *Taxonomy {
+	once.Do(func() {
+		taxonomy = load(logger)
+	})
+	return taxonomy
+}
+
+func load(logger *logger.Logger) *Taxonomy {
+	path := env.GetDefault(logger, "CLASSIFY_TAXONOMY_FILE", "")
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			logger.ERROR("Failed to read taxonomy %s, using the built in one. Reason: %s", path, err)
+		} else if t, ok := Parse(logger, data); ok {
+			logger.INFO("Loaded taxonomy with %d categories from %s", len(t.Categories), path)
+			return t
+		}
+	}
+
+	t, ok := Parse(logger, defaultTaxonomy)
+	if !ok {
+		logger.ERROR("Built in taxonomy is invalid")
+		return &Taxonomy{}
+	}
+	return t
+}
+
+// Parse reads a taxonomy in the format of taxonomy.json.
+func Parse(logger *logger.Logger, data []byte) (t *Taxonomy, ok bool) {
+	t = &Taxonomy{}
+
+	err := json.Unmarshal(data, t)
+	if err != nil {
+		logger.ERROR("Failed to parse taxonomy. Reason: %s", err)
+		return nil, false
+	}
+
+	for _, b := range t.OwnBrands {
+		for _, match := range append([]string{b.Name}, b.Match...) {
+			t.matchers = append(t.matchers, brandMatcher{text.Normalise(match), Brand{Name: b.Name, OwnBrand: true}})
+		}
+	}
+	for _, b := range t.Brands {
+		t.matchers = append(t.matchers, brandMatcher{text.Normalise(b), Brand{Name: b}})
+	}
+
+	// Longest first, so "tesco finest" is tried before "tesco"
+	sort.SliceStable(t.matchers, func(i, j int) bool {
+		return len(t.matchers[i].text) > len(t.matchers[j].text)
+	})
+
+	for _, c := range t.Categories {
+		if c.Name == "" || len(c.Keywords) == 0 {
+			logger.ERROR("Taxonomy category '%s' needs a name and at least one keyword", c.Name)
+			return nil, false
+		}
+		c.keywords = splitAll(c.Keywords)
+		c.exclude = splitAll(c.Exclude)
+	}
+
+	return t, true
+}
+
+
+// Products sets the brand and category of every product.
+func Products(logger *logger.Logger, products *[]*product.Product) {
+	t := Default(logger)
+	for _, p := range *products {
+		t.Product(p)
+	}
+}
+
+// Product sets the brand and category of a single product from its name.
+func (t *Taxonomy) Product(p *product.Product) {
+	brand, rest, _ := t.Brand(p.Name)
+	p.Brand = brand.Name
+	p.OwnBrand = brand.OwnBrand
+
+	// The brand is left out so "Cadbury ..." or "Fairy ..." don't count as keywords, unless nothing
+	// else matches. Then the brand may be all there is to go on, as in "King Crisps Ready Salted"
+	var ok bool
+	p.Category, ok = t.category(strings.Fields(rest))
+	if !ok && p.Brand != "" {
+		p.Category, _ = t.category(text.Tokens(p.Name))
+	}
+}
+
+
+// Brand finds a known brand at the start of a product name.
+// rest is the normalised name without the brand, or the whole normalised name if none is found.
+func (t *Taxonomy) Brand(name string) (brand Brand, rest string, ok bool) {
+	name = text.Normalise(name)
+
+	for _, m := range t.matchers {
+		if name == m.text || strings.HasPrefix(name, m.text+" ") {
+			return m.brand, strings.TrimSpace(name[len(m.text):]), true
+		}
+	}
+	return Brand{}, name, false
+}
+
+// Category picks the category whose keywords match a product name best.
+func (t *Taxonomy) Category(name string) (category string, ok bool) {
+	return t.category(text.Tokens(name))
+}
+
+// category scores every matching keyword by its length in words, so "milk chocolate" beats "milk",
+// plus how close to the end of the name it is, as the last noun is usually what the product is.
+// Earlier categories win ties.
+func (t *Taxonomy) category(tokens []string) (category string, ok bool) {
+	best := 0.0
+
+	for _, c := range t.Categories {
+		if containsAny(tokens, c.exclude) {
+			continue
+		}
+
+		for _, keyword := range c.keywords {
+			end, found := find(tokens, keyword)
+			if !found {
+				continue
+			}
+			score := float64(len(keyword)) + float64(end)/float64(len(tokens)+1)
+			if score > best {
+				best = score
+				category = c.Name
+			}
+		}
+	}
+
+	return category, category != ""
+}
+
+
+func splitAll(phrases []string) (result [][]string) {
+	for _, phrase := range phrases {
+		tokens := text.Tokens(phrase)
+		if len(tokens) > 0 {
+			result = append(result, tokens)
+		}
+	}
+	return result
+}
+
+func containsAny(tokens []string, phrases [][]string) bool {
+	for _, phrase := range phrases {
+		if _, found := find(tokens, phrase); found {
+			return true
+		}
+	}
+	return false
+}
+
+// find returns the position just after the last occurrence of phrase in tokens.
+func find(tokens, phrase []string) (end int, found bool) {
+	for start := len(tokens) - len(phrase); start >= 0; start-- {
+		if equal(tokens[start:start+len(phrase)], phrase) {
+			return start + len(phrase), true
+		}
+	}
+	return 0, false
+}
+
+func equal(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
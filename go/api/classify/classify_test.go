@@ -0,0 +1,57 @@
+package classify
+
+import (
+	"testing"
+
+	"github.com/jakubruminski/FYP/go/api/product"
+	"github.com/jakubruminski/FYP/go/utils/logger"
+)
+
+func TestProduct(t *testing.T) {
+	logger := &logger.Logger{}
+
+	taxonomy, ok := Parse(logger, defaultTaxonomy)
+	if !ok {
+		t.Fatalf("Failed to parse the built in taxonomy")
+	}
+
+	testCases := []struct {
+		name             string
+		expectedBrand    string
+		expectedOwnBrand bool
+		expectedCategory string
+	}{
+		{"Avonmore Fresh Milk 2L",                       "Avonmore",                    false, "Dairy & Eggs"},
+		{"Tesco Finest Mature Cheddar 400g",             "Tesco Finest",                true,  "Dairy & Eggs"},
+		{"Tesco Whole Milk 1L",                          "Tesco",                       true,  "Dairy & Eggs"},
+		{"Dunnes Stores Simply Better Irish Beef Steak", "Dunnes Stores Simply Better", true,  "Meat & Poultry"},
+		{"Simply Better Irish Salmon Fillets",           "Dunnes Stores Simply Better", true,  "Fish & Seafood"},
+		{"SuperValu Signature Tastes Chicken Soup",      "SuperValu Signature Tastes",  true,  "Food Cupboard"},
+		{"Cadbury Dairy Milk 110g",                      "Cadbury",                     false, "Confectionery & Snacks"},
+		{"Milk Chocolate Digestives 400g",               "",                            false, "Confectionery & Snacks"},
+		{"Head & Shoulders Classic Shampoo 250ml",       "Head & Shoulders",            false, "Health & Beauty"},
+		{"Comfort Fabric Conditioner 33 Washes",         "",                            false, "Household & Cleaning"},
+		{"Tropicana Orange Juice 1L",                    "",                            false, "Drinks"},
+		{"Müller Corner Strawberry Yogurt",              "Müller",                      false, "Dairy & Eggs"},
+		{"Stockwell & Co. Baked Beans",                  "Stockwell & Co",              true,  "Food Cupboard"},
+		{"King Crisps Ready Salted 6 Pack",              "King Crisps",                 false, "Confectionery & Snacks"},
+		{"King Prawns 200g",                             "",                            false, "Fish & Seafood"},
+		{"King Edward Potatoes 2kg",                     "",                            false, "Fruit & Vegetables"},
+		{"King Oyster Mushrooms 150g",                   "",                            false, "Fruit & Vegetables"},
+
+		// Nothing to go on
+		{"Tesco Gift Card",                              "Tesco",                       true,  ""},
+	}
+
+	for _, tc := range testCases {
+		p := &product.Product{Name: tc.name}
+		taxonomy.Product(p)
+
+		if p.Brand != tc.expectedBrand || p.OwnBrand != tc.expectedOwnBrand {
+			t.Errorf("Expected brand '%s' (own brand %v), but got '%s' (%v) for '%s'", tc.expectedBrand, tc.expectedOwnBrand, p.Brand, p.OwnBrand, tc.name)
+		}
+		if p.Category != tc.expectedCategory {
+			t.Errorf("Expected category '%s', but got '%s' for '%s'", tc.expectedCategory, p.Category, tc.name)
+		}
+	}
+}
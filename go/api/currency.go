@@ -0,0 +1,70 @@
+package api
+
+import (
+	"github.com/jakubruminski/FYP/go/api/product"
+
+	"github.com/jakubruminski/FYP/go/utils/currency"
+	"github.com/jakubruminski/FYP/go/utils/logger"
+)
+
+
+// getCurrency builds the table the currency dropdown is drawn from, keyed by display name.
+// Rates are relative to the euro, which is what every seller prices in.
+func getCurrency(logger *logger.Logger) (Rates map[string]map[string]interface{}, ok bool) {
+	rates, ok := currency.GetRates(logger)
+	if !ok {
+		logger.WARN("No exchange rates available, only offering %s", currency.BASE)
+		rates = &currency.Rates{PerEUR: map[string]float64{currency.BASE: 1.0}}
+	}
+
+	Rates = map[string]map[string]interface{}{}
+	for _, c := range currency.Currencies {
+		rate, ok := rates.Rate(currency.BASE, c.Code)
+		if !ok {
+			logger.DEBUG("No exchange rate for %s", c.Code)
+			continue
+		}
+		Rates[c.Name] = map[string]interface{}{"rate": rate, "symbol": c.Symbol, "code": c.Code}
+	}
+
+	return Rates, true
+}
+
+// convertProducts fills in Converted on every product when the client asked for a currency.
+// An empty target leaves the products untouched.
+func convertProducts(logger *logger.Logger, products *[]*product.Product, target string) (ok bool) {
+	if target == "" {
+		return true
+	}
+
+	c, ok := currency.Lookup(target)
+	if !ok {
+		logger.WARN("Unknown currency '%s', returning original prices only", target)
+		return true
+	}
+
+	rates, ok := currency.GetRates(logger)
+	if !ok {
+		logger.WARN("No exchange rates available, returning original prices only")
+		return true
+	}
+
+	for _, p := range *products {
+		rate, ok := rates.Rate(p.Currency, c.Code)
+		if !ok {
+			logger.DEBUG_WARN("No exchange rate from %s to %s for product %d", p.Currency, c.Code, p.ID)
+			continue
+		}
+
+		p.Converted = &product.ConvertedPrice{
+			Currency:             c.Code,
+			Rate:                 rate,
+			Price:                p.Price * rate,
+			PricePerUnit:         p.PricePerUnit * rate,
+			DiscountPrice:        p.DiscountPrice * rate,
+			DiscountPricePerUnit: p.DiscountPricePerUnit * rate,
+		}
+	}
+
+	return true
+}
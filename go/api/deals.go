@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/jakubruminski/FYP/go/api/deals"
+	"github.com/jakubruminski/FYP/go/api/image_proxy"
+	"github.com/jakubruminski/FYP/go/api/product"
+	"github.com/jakubruminski/FYP/go/api/query"
+
+	"github.com/jakubruminski/FYP/go/utils/env"
+	"github.com/jakubruminski/FYP/go/utils/http/response"
+	"github.com/jakubruminski/FYP/go/utils/logger"
+	"github.com/jakubruminski/FYP/go/utils/postgres"
+)
+
+type Deals struct {
+	Results   *[]*product.Product               `json:"results"`
+	Currency  map[string]map[string]interface{} `json:"currency,omitempty"`  // only on the first page
+	Meta      *Meta                             `json:"meta"`
+	UpdatedAt int64                             `json:"updated_at"`          // latest scrape in the feed, unix seconds
+}
+
+
+// dealsHandler lists products on offer across every seller, from the deals feed.
+//
+//  sort=discount_depth (default) or saving, or any sort /api/search takes
+//  seller, category, brand and the other /api/search filters
+//  promotion=price_cut, loyalty or multibuy, comma separated or repeated
+//  page_size, cursor, currency as for /api/search
+//
+func dealsHandler(logger *logger.Logger, w http.ResponseWriter, r *http.Request) (jsonResponse []byte, ok bool) {
+	mode := r.FormValue("sort")
+	if mode == "" {
+		mode = product.SORT_DISCOUNT_DEPTH
+	}
+
+	comparator, ok := product.Sorting(mode, r.FormValue("order"))
+	if !ok {
+		logger.ERROR("Invalid sort '%s' or order '%s'", mode, r.FormValue("order"))
+		response.WriteResponse(logger, w, http.StatusBadRequest, "application/json", "error", "Invalid sort or order")
+		return nil, true
+	}
+	sorting := product.SortingName(mode, r.FormValue("order"))
+
+	filter, ok := product.ParseFilter(logger, r)
+	if !ok {
+		logger.ERROR("Invalid filter")
+		response.WriteResponse(logger, w, http.StatusBadRequest, "application/json", "error", "Invalid filter")
+		return nil, true
+	}
+
+	r.FormValue("promotion")
+	promotions, err := deals.ParsePromotions(r.Form["promotion"])
+	if err != nil {
+		logger.ERROR("Invalid promotion. Reason: %s", err)
+		response.WriteResponse(logger, w, http.StatusBadRequest, "application/json", "error", "Invalid promotion")
+		return nil, true
+	}
+
+	pageSize, cursor, ok := parsePage(logger, r, sorting)
+	if !ok {
+		response.WriteResponse(logger, w, http.StatusBadRequest, "application/json", "error", "Invalid page_size or cursor")
+		return nil, true
+	}
+
+	since := time.Now().Add(-dealsMaxAge(logger)).Unix()
+	pruned := deals.Default.Prune(since)
+	if pruned > 0 {
+		logger.DEBUG("Pruned %d outdated deals", pruned)
+	}
+
+	found := deals.Default.Deals(filter, promotions, since)
+	products := &found
+
+	product.SortBy(products, comparator)
+
+	meta := &Meta{Total: len(*products), SellerTotals: map[string]int{}, PageSize: pageSize, Sort: sorting}
+	for _, product := range *products {
+		meta.SellerTotals[product.Seller]++
+	}
+
+	meta.NextCursor = product.Paginate(products, comparator, sorting, cursor, pageSize)
+
+	var currency map[string]map[string]interface{}
+	if cursor == nil {
+		currency, ok = getCurrency(logger)
+		if !ok {
+			logger.ERROR("Failed to get currency")
+			return nil, false
+		}
+	}
+
+	ok = convertProducts(logger, products, r.FormValue("currency"))
+	if !ok {
+		logger.ERROR("Failed to convert products to currency '%s'", r.FormValue("currency"))
+		return nil, false
+	}
+
+	image_proxy.ProxyProducts(logger, products)
+
+	jsonResponse, err = json.Marshal(Deals{Results: products, Currency: currency, Meta: meta, UpdatedAt: deals.Default.UpdatedAt()})
+	if err != nil {
+		logger.ERROR("Failed to marshal response: %s", err)
+		return nil, false
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonResponse)
+
+	logger.INFO("Client /logs/%s.txt browsed %d of %d deals", logger.ClientID, len(*products), meta.Total)
+
+	return jsonResponse, true
+}
+
+
+// LoadDeals fills the deals feed from the searches cached within the last SEARCH_EXPIRY_IN_DAYS,
+// so it isn't empty until the first scrapes after a restart.
+func LoadDeals(logger *logger.Logger, ctx context.Context) (ok bool) {
+	since := time.Now().Add(-dealsMaxAge(logger)).Unix()
+
+	var products *[]*product.Product
+	var lastFetched map[int64]int64
+	ok = postgres.ExecuteInTransaction(logger, ctx, postgres.ReadOnly, func(tx *postgres.Tx) bool {
+		products, lastFetched = &[]*product.Product{}, map[int64]int64{}
+		return query.Deals(logger, tx, since, products, lastFetched)
+	})
+	if !ok {
+		logger.ERROR("Failed to load deals")
+		return false
+	}
+
+	for _, p := range *products {
+		deals.Default.Update(&[]*product.Product{p}, lastFetched[p.ID])
+	}
+
+	logger.INFO("Loaded %d deals", deals.Default.Len())
+	return true
+}
+
+
+// A deal is as current as the cached search that found it.
+func dealsMaxAge(logger *logger.Logger) time.Duration {
+	days := env.GetIntDefault(logger, "SEARCH_EXPIRY_IN_DAYS", 1)
+	return time.Duration(days) * 24 * time.Hour
+}
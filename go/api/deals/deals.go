@@ -0,0 +1,183 @@
+package deals
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/jakubruminski/FYP/go/api/product"
+)
+
+
+const (
+	PROMOTION_PRICE_CUT = "price_cut"   // a lower shelf price, "was €3 now €2"
+	PROMOTION_LOYALTY   = "loyalty"     // a lower price for members, like Tesco Clubcard Prices
+	PROMOTION_MULTIBUY  = "multibuy"    // "Any 3 for €10", no single discounted price
+)
+
+var Promotions = []string{PROMOTION_PRICE_CUT, PROMOTION_LOYALTY, PROMOTION_MULTIBUY}
+
+// Sellers whose discounted price is only for loyalty card members. Tesco has no "was" price,
+// every discount it shows is a Clubcard Price.
+var loyaltySellers = map[string]bool{
+	"tesco": true,
+}
+
+var multibuyPattern = regexp.MustCompile(`\d+\s+for\s`)
+
+
+// Promotion says what kind of offer a product is on, "" when it isn't on one.
+func Promotion(p *product.Product) string {
+	if multibuyPattern.MatchString(strings.ToLower(p.DiscountPriceInWords)) {
+		return PROMOTION_MULTIBUY
+	}
+	if p.DiscountDepth() > 0 {
+		if loyaltySellers[strings.ToLower(p.Seller)] {
+			return PROMOTION_LOYALTY
+		}
+		return PROMOTION_PRICE_CUT
+	}
+	return ""
+}
+
+// ParsePromotions reads promotion=multibuy&promotion=loyalty or promotion=multibuy,loyalty.
+func ParsePromotions(values []string) (promotions []string, err error) {
+	for _, value := range values {
+		for _, v := range strings.Split(value, ",") {
+			v = strings.ToLower(strings.TrimSpace(v))
+			if v == "" {
+				continue
+			}
+			if !contains(Promotions, v) {
+				return nil, fmt.Errorf("unknown promotion '%s', expected one of %s", v, strings.Join(Promotions, ", "))
+			}
+			promotions = append(promotions, v)
+		}
+	}
+	return promotions, nil
+}
+
+
+// Feed holds every product currently on offer, across sellers and searches. Scrapes update it
+// as they land, so browsing deals never scrapes and never waits on the database.
+type Feed struct {
+	mu        sync.RWMutex
+	entries   map[string]*entry
+	updatedAt int64
+}
+
+type entry struct {
+	product *product.Product
+	seenAt  int64
+}
+
+// Default is the feed the server keeps.
+var Default = NewFeed()
+
+func NewFeed() *Feed {
+	return &Feed{entries: map[string]*entry{}}
+}
+
+
+// Update takes in the products of a scrape seen at seenAt, unix seconds. Products on offer are
+// added or replaced, products that no longer are drop out of the feed.
+func (f *Feed) Update(products *[]*product.Product, seenAt int64) (added, removed int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, p := range *products {
+		key := key(p)
+
+		if Promotion(p) == "" {
+			if _, found := f.entries[key]; found {
+				delete(f.entries, key)
+				removed++
+			}
+			continue
+		}
+
+		if existing, found := f.entries[key]; found && existing.seenAt > seenAt {
+			continue
+		}
+
+		copied := *p
+		copied.Converted = nil
+		copied.Relevance, copied.Score = 0, 0
+		f.entries[key] = &entry{product: &copied, seenAt: seenAt}
+		added++
+	}
+
+	f.updatedAt = max(f.updatedAt, seenAt)
+	return added, removed
+}
+
+// Prune drops deals last seen before since. Their price may have changed since then.
+func (f *Feed) Prune(since int64) (removed int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for key, e := range f.entries {
+		if e.seenAt < since {
+			delete(f.entries, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Deals returns copies of the deals seen at or after since that match the filter and are one of
+// promotions, any promotion when there are none. They are unsorted.
+func (f *Feed) Deals(filter *product.Filter, promotions []string, since int64) (deals []*product.Product) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	deals = []*product.Product{}
+	for _, e := range f.entries {
+		if e.seenAt < since || !filter.Matches(e.product) {
+			continue
+		}
+
+		promotion := Promotion(e.product)
+		if len(promotions) > 0 && !contains(promotions, promotion) {
+			continue
+		}
+
+		copied := *e.product
+		copied.Promotion = promotion
+		deals = append(deals, &copied)
+	}
+	return deals
+}
+
+// UpdatedAt is when the latest scrape in the feed was seen, 0 for an empty feed.
+func (f *Feed) UpdatedAt() int64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.updatedAt
+}
+
+func (f *Feed) Len() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return len(f.entries)
+}
+
+
+// key tells products apart without a database ID, freshly scraped ones don't have one when the
+// database is down. A product's URL is unique to it at its seller.
+func key(p *product.Product) string {
+	if p.URL != "" {
+		return strings.ToLower(p.Seller) + " " + p.URL
+	}
+	return strings.ToLower(p.Seller) + " " + strings.ToLower(p.Name)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
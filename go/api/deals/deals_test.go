@@ -0,0 +1,102 @@
+package deals
+
+import (
+	"testing"
+
+	"github.com/jakubruminski/FYP/go/api/product"
+)
+
+func TestPromotion(t *testing.T) {
+	testCases := []struct {
+		product  product.Product
+		expected string
+	}{
+		{product.Product{Seller: "Dunnes",    Price: 3.00, DiscountPrice: 2.00}, PROMOTION_PRICE_CUT},
+		{product.Product{Seller: "Tesco",     Price: 3.00, DiscountPrice: 2.50}, PROMOTION_LOYALTY},
+		{product.Product{Seller: "Tesco",     Price: 3.00, DiscountPriceInWords: "any 3 for €10 "}, PROMOTION_MULTIBUY},
+		{product.Product{Seller: "SuperValu", Price: 3.00, DiscountPriceInWords: "2 for €5"}, PROMOTION_MULTIBUY},
+		{product.Product{Seller: "SuperValu", Price: 3.00}, ""},
+		{product.Product{Seller: "Dunnes",    Price: 3.00, DiscountPrice: 3.50}, ""},
+	}
+
+	for i, tc := range testCases {
+		if promotion := Promotion(&tc.product); promotion != tc.expected {
+			t.Errorf("Test case %d: expected '%s', but got '%s'", i, tc.expected, promotion)
+		}
+	}
+}
+
+func TestParsePromotions(t *testing.T) {
+	promotions, err := ParsePromotions([]string{"multibuy, Loyalty", "price_cut"})
+	if err != nil || len(promotions) != 3 || promotions[1] != PROMOTION_LOYALTY {
+		t.Errorf("Expected 3 promotions, but got %v and error %v", promotions, err)
+	}
+
+	_, err = ParsePromotions([]string{"bogof"})
+	if err == nil {
+		t.Errorf("Expected an unknown promotion to fail")
+	}
+}
+
+func TestFeed(t *testing.T) {
+	feed := NewFeed()
+
+	scrape := []*product.Product{
+		{ID: 1, Seller: "Dunnes",    URL: "d/1", Category: "Dairy & Eggs", Price: 3.00, DiscountPrice: 2.00},
+		{ID: 2, Seller: "Tesco",     URL: "t/2", Category: "Bakery",       Price: 2.00, DiscountPrice: 1.80},
+		{ID: 3, Seller: "SuperValu", URL: "s/3", Category: "Dairy & Eggs", Price: 2.50, DiscountPriceInWords: "2 for €4"},
+		{ID: 4, Seller: "SuperValu", URL: "s/4", Category: "Dairy & Eggs", Price: 1.00},
+	}
+
+	added, removed := feed.Update(&scrape, 100)
+	if added != 3 || removed != 0 {
+		t.Errorf("Expected 3 deals added and none removed, but got %d and %d", added, removed)
+	}
+
+	testCases := []struct {
+		filter      *product.Filter
+		promotions  []string
+		since       int64
+		expectedIDs map[int64]bool
+	}{
+		{&product.Filter{}, nil, 0, map[int64]bool{1: true, 2: true, 3: true}},
+		{&product.Filter{Sellers: []string{"supervalu"}}, nil, 0, map[int64]bool{3: true}},
+		{&product.Filter{Categories: []string{"Dairy & Eggs"}}, nil, 0, map[int64]bool{1: true, 3: true}},
+		{&product.Filter{}, []string{PROMOTION_LOYALTY, PROMOTION_MULTIBUY}, 0, map[int64]bool{2: true, 3: true}},
+		{&product.Filter{}, nil, 101, map[int64]bool{}},
+	}
+
+	for i, tc := range testCases {
+		deals := feed.Deals(tc.filter, tc.promotions, tc.since)
+		if len(deals) != len(tc.expectedIDs) {
+			t.Errorf("Test case %d: expected %v, but got %d deals", i, tc.expectedIDs, len(deals))
+			continue
+		}
+		for _, p := range deals {
+			if !tc.expectedIDs[p.ID] || p.Promotion == "" {
+				t.Errorf("Test case %d: expected %v, but got product %d with promotion '%s'", i, tc.expectedIDs, p.ID, p.Promotion)
+			}
+		}
+	}
+
+	// The next scrape finds the Dunnes offer over and the Tesco one unchanged
+	rescrape := []*product.Product{
+		{ID: 1, Seller: "Dunnes", URL: "d/1", Price: 3.00},
+		{ID: 2, Seller: "Tesco",  URL: "t/2", Price: 2.00, DiscountPrice: 1.80},
+	}
+	added, removed = feed.Update(&rescrape, 200)
+	if added != 1 || removed != 1 || feed.Len() != 2 || feed.UpdatedAt() != 200 {
+		t.Errorf("Expected 1 deal added, 1 removed and 2 left, but got %d, %d and %d", added, removed, feed.Len())
+	}
+
+	// An older scrape doesn't overwrite a newer one
+	stale := []*product.Product{{ID: 2, Seller: "Tesco", URL: "t/2", Price: 2.00, DiscountPrice: 1.00}}
+	feed.Update(&stale, 150)
+	if deals := feed.Deals(&product.Filter{Sellers: []string{"Tesco"}}, nil, 0); len(deals) != 1 || deals[0].DiscountPrice != 1.80 {
+		t.Errorf("Expected the newer Tesco price to be kept")
+	}
+
+	if removed := feed.Prune(150); removed != 1 || feed.Len() != 1 {
+		t.Errorf("Expected the SuperValu deal seen at 100 to be pruned, but removed %d and %d are left", removed, feed.Len())
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/jakubruminski/FYP/go/api/fetch/seller/dunnes"
 	"github.com/jakubruminski/FYP/go/api/fetch/seller/supervalu"
 
+	"github.com/jakubruminski/FYP/go/api/classify"
 	"github.com/jakubruminski/FYP/go/api/product"
 
 	"github.com/jakubruminski/FYP/go/utils/logger"
@@ -28,6 +29,8 @@ func Products(logger *logger.Logger, products *[]*product.Product, searchValue s
 
     wg.Wait()
 
+	classify.Products(logger, products)
+
 	ok = product.Sort(logger, products)
 	if !ok {
 		logger.ERROR("Error while sorting products")
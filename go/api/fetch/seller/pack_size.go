@@ -0,0 +1,62 @@
+package seller
+
+import (
+	"math"
+
+	"github.com/jakubruminski/FYP/go/utils/logger"
+	"github.com/jakubruminski/FYP/go/utils/unit"
+)
+
+
+// Seller unit prices are rounded to the cent and sometimes quoted per 100g,
+// so small differences are expected. Anything beyond this is worth a look.
+const pricePerUnitTolerance = 0.10
+
+
+// derivePricePerUnit works out a unit price from the pack size in the product name,
+// for tiles where the seller doesn't print one.
+func derivePricePerUnit(index int, logger *logger.Logger, productName string, price float64) (pricePerUnit float64, unitType string, ok bool) {
+	packSize, ok := unit.ParsePackSize(productName)
+	if !ok {
+		logger.DEBUG_WARN("%v - Failed to find a pack size in '%s'", index, productName)
+		return 0.0, "", false
+	}
+
+	pricePerUnit, ok = unit.PricePerCanonical(price, packSize)
+	if !ok {
+		logger.DEBUG_WARN("%v - Failed to derive price per unit from pack size in '%s'", index, productName)
+		return 0.0, "", false
+	}
+
+	unitType = unit.Canonical(packSize.Unit.Dimension).Name
+	logger.DEBUG("%v - Derived '%f' per %s from pack size %f %s in '%s'", index, pricePerUnit, unitType, packSize.Value, packSize.Unit.Name, productName)
+
+	return pricePerUnit, unitType, true
+}
+
+// crossCheckPricePerUnit compares the seller's unit price with the one implied by the
+// pack size in the name. The seller's value is always kept, a mismatch is only logged,
+// since it usually means either the name or our pack size parsing is off.
+func crossCheckPricePerUnit(index int, logger *logger.Logger, productName string, price, pricePerUnit float64, unitType string) {
+	derived, derivedUnitType, ok := derivePricePerUnit(index, logger, productName, price)
+	if !ok {
+		return
+	}
+
+	if derivedUnitType != unitType {
+		logger.DEBUG("%v - Seller prices '%s' per %s, pack size is per %s. Not comparable", index, productName, unitType, derivedUnitType)
+		return
+	}
+
+	if pricePerUnit == 0.0 {
+		return
+	}
+
+	difference := math.Abs(derived-pricePerUnit) / pricePerUnit
+	if difference > pricePerUnitTolerance {
+		logger.DEBUG_WARN("%v - Price per unit mismatch for '%s': seller says '%f' per %s, pack size gives '%f' (%.0f%% apart)", index, productName, pricePerUnit, unitType, derived, difference*100)
+		return
+	}
+
+	logger.DEBUG("%v - Price per unit for '%s' agrees with pack size", index, productName)
+}
@@ -8,9 +8,14 @@ import (
 	"github.com/jakubruminski/FYP/go/api/product"
 	"github.com/jakubruminski/FYP/go/utils/logger"
 	"github.com/jakubruminski/FYP/go/utils/parse/price_parser"
+	"github.com/jakubruminski/FYP/go/utils/parse/srcset_parser"
 )
 
 
+// Every seller shows one of these on the tile instead of, or next to, the add to basket button.
+var outOfStockPhrases = []string{"out of stock", "sold out", "unavailable", "not available"}
+
+
 type HTMLParser struct {
 	sellerName                           string
 
@@ -150,13 +155,20 @@ func (parser *HTMLParser) Parse(logger *logger.Logger, doc *goquery.Document) (p
 		}
 
 		_, pricePerUnit, pricePerUnitUnitType, ok := parseFloatPerUnit(index, logger, parser.pricePerUnitPattern, s)
+		derivedPricePerUnit := false
 		if !ok {
-			logger.DEBUG_WARN("%v - [%s] Failed to parse price per unit", index, link)
-			return
+			logger.DEBUG_WARN("%v - [%s] Failed to parse price per unit, trying the pack size in the name", index, link)
+
+			pricePerUnit, pricePerUnitUnitType, ok = derivePricePerUnit(index, logger, productName, price)
+			if !ok {
+				logger.DEBUG_WARN("%v - [%s] Failed to derive price per unit", index, link)
+				return
+			}
+			derivedPricePerUnit = true
 		}
 
 		var discountPricePerUnit float64
-		if parser.sellerName == "Dunnes" && discountPrice != 0.0{
+		if parser.sellerName == "Dunnes" && discountPrice != 0.0 && !derivedPricePerUnit {
 			discountPricePerUnit = pricePerUnit
 			pricePerUnit  = (price / discountPrice) * pricePerUnit
 			
@@ -164,11 +176,26 @@ func (parser *HTMLParser) Parse(logger *logger.Logger, doc *goquery.Document) (p
 			discountPricePerUnit = (discountPrice / price) * pricePerUnit
 		}
 
+		if !derivedPricePerUnit {
+			crossCheckPricePerUnit(index, logger, productName, price, pricePerUnit, pricePerUnitUnitType)
+		}
+
 		discountPriceInWords, ok := parseDiscountPriceInWords(index, logger, s, parser.discountPricePattern, parser.discountPriceInWordsRegexPattern, parser.discountPriceInWordsStringsToStrip...)
 		if !ok {
 			logger.DEBUG_WARN("%v - [%s] Failed to parse discount price in words. Ignoring...", index, link)
 		}
 
+		// A multi-buy like "2 for €3" leaves the shelf price alone, what one item costs when
+		// bought that way is the discount price
+		if discountPrice == 0.0 && discountPriceInWords != "" {
+			_, multiBuyPrice, quantity, ok := price_parser.MultiBuy(index, logger, discountPriceInWords)
+			if ok && multiBuyPrice < price {
+				logger.DEBUG("%v - [%s] Multi-buy of %d at %f each", index, link, quantity, multiBuyPrice)
+				discountPrice = multiBuyPrice
+				discountPricePerUnit = (discountPrice / price) * pricePerUnit
+			}
+		}
+
 		imageURL, ok := parseByAttribute(index, logger, s, parser.imageURLPattern, parser.imageURLAttribute)
 		if !ok {
 			logger.WARN("%v - [%s] Failed to parse image URL", index, link)
@@ -178,7 +205,9 @@ func (parser *HTMLParser) Parse(logger *logger.Logger, doc *goquery.Document) (p
 		if len(imageURL) == 0 {
 			logger.WARN("%v - [%s] Failed to find image for product", index, link)
 		}
-		imageURL = strings.Split(imageURL, " ")[0]
+		// Tesco gives a srcset, the others a plain src. Either way keep the largest candidate,
+		// the image proxy scales it down to whatever the client asks for.
+		imageURL, _ = srcset_parser.Best(imageURL, 0)
 
 		// Create a new Product instance and append it to the products slice
 		p, ok := product.NewProduct(
@@ -201,6 +230,11 @@ func (parser *HTMLParser) Parse(logger *logger.Logger, doc *goquery.Document) (p
 			return
 		}
 
+		p.InStock = inStock(s)
+		if !p.InStock {
+			logger.DEBUG("%v - [%s] Product is out of stock", index, link)
+		}
+
 		logger.DEBUG("%v - Parsed p.Seller: %s", index, p.Seller)
 		logger.DEBUG("%v - Parsed p.Name: %s", index, p.Name)
 		logger.DEBUG("%v - Parsed p.Currency: %s", index, p.Currency)
@@ -211,6 +245,7 @@ func (parser *HTMLParser) Parse(logger *logger.Logger, doc *goquery.Document) (p
 		logger.DEBUG("%v - Parsed p.DiscountPriceInWords: %s", index, p.DiscountPriceInWords)
 		logger.DEBUG("%v - Parsed p.URL: %s", index, p.URL)
 		logger.DEBUG("%v - Parsed p.ImgURL: %s", index, p.ImgURL)
+		logger.DEBUG("%v - Parsed p.InStock: %v", index, p.InStock)
 
 		// logger.DATA(`unOrderedProducts = append(unOrderedProducts, &Product{ Seller: "%s", Name: "%s", Currency: "%s", Price: %f, PricePerUnit: %f, DiscountPrice: %f, DiscountPricePerUnit: %f, DiscountPriceInWords: "%s", URL: "%s", ImgURL: "%s" })`, p.Seller, p.Name, p.Currency, p.Price, p.PricePerUnit, p.DiscountPrice, p.DiscountPricePerUnit, p.DiscountPriceInWords, p.URL, p.ImgURL) 
 
@@ -222,6 +257,16 @@ func (parser *HTMLParser) Parse(logger *logger.Logger, doc *goquery.Document) (p
 	return products, true
 }
 
+func inStock(s *goquery.Selection) bool {
+	text := strings.ToLower(s.Text())
+	for _, phrase := range outOfStockPhrases {
+		if strings.Contains(text, phrase) {
+			return false
+		}
+	}
+	return true
+}
+
 func parseFloat(index int, logger *logger.Logger, pattern string, s *goquery.Selection, optional bool, allowedRegexPattern string, prohibitedRegexPattern, stringsToStrip []string) (currency string, price float64, ok bool) {
 	priceAsString := s.Find(pattern).Text()
 	if priceAsString == "" && optional {
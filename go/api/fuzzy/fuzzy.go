@@ -0,0 +1,79 @@
+package fuzzy
+
+import (
+	"html"
+	"sort"
+	"strings"
+
+	"github.com/jakubruminski/FYP/go/utils/env"
+	"github.com/jakubruminski/FYP/go/utils/logger"
+)
+
+
+// Match is a stored product that Postgres found close to a search term that has no cached search
+// of its own, by full text search on the name or by trigram similarity.
+type Match struct {
+	ProductID  int64
+	Seller     string
+	Confidence float64   // 1 when every word of the term is in the name, stemmed, otherwise the trigram word similarity
+}
+
+// Options decide when matches are good enough to answer a search without scraping.
+type Options struct {
+	Threshold  float64   // lowest Confidence that counts
+	MinResults int       // fewer products than this and the sellers are scraped
+	MinSellers int       // results from fewer sellers than this and the sellers are scraped
+	Limit      int       // most matches looked at
+}
+
+func DefaultOptions(logger *logger.Logger) Options {
+	return Options{
+		Threshold:  env.GetFloatDefault(logger, "FUZZY_THRESHOLD", 0.7),
+		MinResults: env.GetIntDefault(logger, "FUZZY_MIN_RESULTS", 3),
+		MinSellers: env.GetIntDefault(logger, "FUZZY_MIN_SELLERS", 2),
+		Limit:      env.GetIntDefault(logger, "FUZZY_LIMIT", 100),
+	}
+}
+
+// Enabled is false with FUZZY_SEARCH=false, for databases without the pg_trgm extension.
+func Enabled(logger *logger.Logger) bool {
+	return env.GetBoolDefault(logger, "FUZZY_SEARCH", true)
+}
+
+
+// Text turns a search term as the API receives it, escaped and with "%20" for spaces, back into
+// what was typed. Quoted terms ask for exactly that and are never matched fuzzily.
+func Text(searchTerm string) (text string, ok bool) {
+	if strings.HasPrefix(searchTerm, "\"") {
+		return "", false
+	}
+
+	text = strings.ReplaceAll(searchTerm, "%20", " ")
+	text = html.UnescapeString(text)
+	text = strings.Join(strings.Fields(strings.ToLower(text)), " ")
+
+	return text, text != ""
+}
+
+// Confident keeps the matches at or above the threshold, best first, and says whether they are
+// enough to serve the search from the database.
+func Confident(matches []*Match, options Options) (productIDs []int64, ok bool) {
+	kept := []*Match{}
+	for _, m := range matches {
+		if m.Confidence >= options.Threshold {
+			kept = append(kept, m)
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool { return kept[i].Confidence > kept[j].Confidence })
+
+	sellers := map[string]bool{}
+	for _, m := range kept {
+		productIDs = append(productIDs, m.ProductID)
+		sellers[strings.ToLower(m.Seller)] = true
+	}
+
+	if len(productIDs) == 0 || len(productIDs) < options.MinResults || len(sellers) < options.MinSellers {
+		return nil, false
+	}
+	return productIDs, true
+}
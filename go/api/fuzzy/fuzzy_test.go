@@ -0,0 +1,64 @@
+package fuzzy
+
+import (
+	"testing"
+)
+
+func TestText(t *testing.T) {
+	testCases := []struct {
+		searchTerm string
+		expected   string
+		expectedOk bool
+	}{
+		{"cheddar%20cheese",     "cheddar cheese", true},
+		{"m&amp;s%20%20biscuits", "m&s biscuits",   true},
+		{"Aspargus",             "aspargus",       true},
+		{"\"free%20range\"",     "",               false},
+		{"%20",                  "",               false},
+	}
+
+	for _, tc := range testCases {
+		text, ok := Text(tc.searchTerm)
+		if text != tc.expected || ok != tc.expectedOk {
+			t.Errorf("Expected '%s' and %v, but got '%s' and %v for '%s'", tc.expected, tc.expectedOk, text, ok, tc.searchTerm)
+		}
+	}
+}
+
+func TestConfident(t *testing.T) {
+	options := Options{Threshold: 0.7, MinResults: 3, MinSellers: 2}
+
+	testCases := []struct {
+		matches     []*Match
+		expectedIDs []int64
+		expectedOk  bool
+	}{
+		// "apples", full text matches from two sellers
+		{[]*Match{{1, "Tesco", 1}, {2, "Dunnes", 1}, {3, "Tesco", 0.71}}, []int64{1, 2, 3}, true},
+		// "aspargus", similar enough, best first
+		{[]*Match{{4, "Tesco", 0.72}, {5, "SuperValu", 0.78}, {6, "Dunnes", 0.75}, {7, "Dunnes", 0.4}}, []int64{5, 6, 4}, true},
+		// only one seller has it
+		{[]*Match{{1, "Tesco", 1}, {2, "Tesco", 1}, {3, "tesco", 1}}, nil, false},
+		// too few close enough
+		{[]*Match{{1, "Tesco", 1}, {2, "Dunnes", 0.65}, {3, "SuperValu", 0.5}}, nil, false},
+		{[]*Match{}, nil, false},
+	}
+
+	for i, tc := range testCases {
+		productIDs, ok := Confident(tc.matches, options)
+		if ok != tc.expectedOk {
+			t.Errorf("Test case %d: expected ok to be %v, but got %v", i, tc.expectedOk, ok)
+			continue
+		}
+		if len(productIDs) != len(tc.expectedIDs) {
+			t.Errorf("Test case %d: expected %v, but got %v", i, tc.expectedIDs, productIDs)
+			continue
+		}
+		for j := range productIDs {
+			if productIDs[j] != tc.expectedIDs[j] {
+				t.Errorf("Test case %d: expected %v, but got %v", i, tc.expectedIDs, productIDs)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/jakubruminski/FYP/go/utils/env"
+	"github.com/jakubruminski/FYP/go/utils/logger"
+	"github.com/jakubruminski/FYP/go/utils/postgres"
+)
+
+type Health struct {
+	Status   string           `json:"status"`              // "ok", or "unavailable" when the database can't be reached
+	Database *postgres.Health `json:"database,omitempty"`  // only with DB_AVAILABLE
+}
+
+
+// HealthHandler reports whether the server can reach its database, with the connection pool's
+// stats for monitoring. It answers 503 while the database is down, so load balancers stop
+// sending searches to this instance.
+func HealthHandler(logger *logger.Logger, w http.ResponseWriter, r *http.Request) (jsonResponse []byte, ok bool) {
+	health := &Health{Status: "ok"}
+	status := http.StatusOK
+
+	db_available := env.GetBoolDefault(logger, "DB_AVAILABLE", false)
+	if db_available {
+		health.Database = postgres.Check(logger)
+		if !health.Database.Available {
+			health.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	jsonResponse, err := json.Marshal(health)
+	if err != nil {
+		logger.ERROR("Failed to marshal response: %s", err)
+		return nil, false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonResponse)
+
+	return jsonResponse, true
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jakubruminski/FYP/go/api/history"
+	"github.com/jakubruminski/FYP/go/api/repository"
+
+	"github.com/jakubruminski/FYP/go/utils/http/response"
+	"github.com/jakubruminski/FYP/go/utils/logger"
+	"github.com/jakubruminski/FYP/go/utils/postgres"
+)
+
+const productPathPrefix = "/api/product/"
+
+type PriceHistory struct {
+	ProductID    int64                   `json:"product_id"`
+	Observations []*history.Observation  `json:"observations"`  // oldest first, back to the start of the longest window
+	Windows      []*history.Window       `json:"windows"`
+}
+
+
+// historyHandler serves /api/product/{id}/history?windows=7d,30d,90d
+func historyHandler(logger *logger.Logger, w http.ResponseWriter, r *http.Request) (jsonResponse []byte, ok bool) {
+	productID, ok := parseProductPath(r.URL.Path, "history")
+	if !ok {
+		logger.ERROR("Invalid product path %s", r.URL.Path)
+		response.WriteResponse(logger, w, http.StatusBadRequest, "application/json", "error", "Invalid product id")
+		return nil, true
+	}
+
+	windows, err := history.ParseWindows(r.FormValue("windows"))
+	if err != nil {
+		logger.ERROR("Invalid windows '%s'. Reason: %s", r.FormValue("windows"), err)
+		response.WriteResponse(logger, w, http.StatusBadRequest, "application/json", "error", "Invalid windows")
+		return nil, true
+	}
+
+	now := time.Now()
+	since := now.Add(-history.Longest(windows)).Unix()
+
+	observations := &[]*history.Observation{}
+	ok = repository.Default.InTransaction(logger, r.Context(), postgres.ReadOnly, func(repos *repository.Repositories) bool {
+		*observations = (*observations)[:0]
+		return repos.Observations.Get(logger, productID, since, observations)
+	})
+	if !ok {
+		logger.ERROR("Failed to get price history")
+		return nil, false
+	}
+
+	history.Summarise(*observations, windows, now)
+
+	jsonResponse, err = json.Marshal(PriceHistory{ProductID: productID, Observations: *observations, Windows: windows})
+	if err != nil {
+		logger.ERROR("Failed to marshal response: %s", err)
+		return nil, false
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonResponse)
+
+	return jsonResponse, true
+}
+
+// parseProductPath reads the id out of /api/product/{id}/{action}.
+func parseProductPath(path, action string) (productID int64, ok bool) {
+	rest, found := strings.CutPrefix(path, productPathPrefix)
+	if !found {
+		return 0, false
+	}
+
+	id, found := strings.CutSuffix(rest, "/"+action)
+	if !found {
+		return 0, false
+	}
+
+	productID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || productID < 0 {
+		return 0, false
+	}
+	return productID, true
+}
@@ -0,0 +1,170 @@
+package history
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jakubruminski/FYP/go/api/product"
+)
+
+
+// Observation is a product's price as seen by one scrape.
+type Observation struct {
+	ProductID            int64   `json:"product_id"`
+	Seller               string  `json:"seller"`
+	ObservedAt           int64   `json:"observed_at"`     // unix seconds
+
+	Currency             string  `json:"currency"`
+	Price                float64 `json:"price"`
+	PricePerUnit         float64 `json:"price_per_unit"`
+	DiscountPrice        float64 `json:"discount_price"`
+	DiscountPricePerUnit float64 `json:"discount_price_per_unit"`
+	DiscountPriceInWords string  `json:"discount_price_in_words"`
+	UnitType             string  `json:"unit_type"`
+}
+
+// Window summarises the observations of the last Duration, prices with any discount applied.
+type Window struct {
+	Name              string  `json:"window"`          // as asked for, e.g. "30d"
+	From              int64   `json:"from"`            // unix seconds
+	Count             int     `json:"count"`
+
+	Min               float64 `json:"min"`
+	Max               float64 `json:"max"`
+	Average           float64 `json:"average"`
+
+	MinUnitPrice      float64 `json:"min_unit_price"`
+	MaxUnitPrice      float64 `json:"max_unit_price"`
+	AverageUnitPrice  float64 `json:"average_unit_price"`
+
+	duration          time.Duration
+}
+
+const DEFAULT_WINDOWS = "7d,30d,90d"
+
+// At most this many windows per request, each one is a pass over the series.
+const maxWindows = 6
+
+
+func ObservationInsertQuery() (query string) {
+	return `
+    INSERT INTO price_observations
+    (product_id, seller, observed_at, currency, price, price_per_unit, discount_price, discount_price_per_unit, discount_price_in_words, unit_type)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+    `
+}
+
+
+func NewObservation(p *product.Product, observedAt int64) *Observation {
+	return &Observation{
+		ProductID:            p.ID,
+		Seller:               p.Seller,
+		ObservedAt:           observedAt,
+		Currency:             p.Currency,
+		Price:                p.Price,
+		PricePerUnit:         p.PricePerUnit,
+		DiscountPrice:        p.DiscountPrice,
+		DiscountPricePerUnit: p.DiscountPricePerUnit,
+		DiscountPriceInWords: p.DiscountPriceInWords,
+		UnitType:             p.UnitType,
+	}
+}
+
+func (o *Observation) EffectivePrice() float64 {
+	if o.DiscountPrice != 0.0 {
+		return o.DiscountPrice
+	}
+	return o.Price
+}
+
+func (o *Observation) EffectivePricePerUnit() float64 {
+	if o.DiscountPricePerUnit != 0.0 {
+		return o.DiscountPricePerUnit
+	}
+	return o.PricePerUnit
+}
+
+
+// ParseWindows reads a comma separated list like "24h,7d,4w". An empty list is DEFAULT_WINDOWS.
+func ParseWindows(raw string) (windows []*Window, err error) {
+	if strings.TrimSpace(raw) == "" {
+		raw = DEFAULT_WINDOWS
+	}
+
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		duration, err := parseWindow(name)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, &Window{Name: name, duration: duration})
+	}
+
+	if len(windows) == 0 || len(windows) > maxWindows {
+		return nil, fmt.Errorf("expected between 1 and %d windows, got %d", maxWindows, len(windows))
+	}
+	return windows, nil
+}
+
+func parseWindow(name string) (duration time.Duration, err error) {
+	units := map[byte]time.Duration{'h': time.Hour, 'd': 24 * time.Hour, 'w': 7 * 24 * time.Hour}
+
+	unit, ok := units[name[len(name)-1]]
+	if !ok {
+		return 0, fmt.Errorf("window '%s' must end in h, d or w", name)
+	}
+
+	count, err := strconv.Atoi(name[:len(name)-1])
+	if err != nil || count < 1 || count > 3650 {
+		return 0, fmt.Errorf("invalid window '%s'", name)
+	}
+
+	return time.Duration(count) * unit, nil
+}
+
+// Longest is how far back the widest window goes.
+func Longest(windows []*Window) (duration time.Duration) {
+	for _, w := range windows {
+		duration = max(duration, w.duration)
+	}
+	return duration
+}
+
+
+// Summarise fills in every window from observations, which must be sorted oldest first.
+func Summarise(observations []*Observation, windows []*Window, now time.Time) {
+	for _, w := range windows {
+		w.From = now.Add(-w.duration).Unix()
+		w.Count = 0
+
+		totalPrice, totalUnitPrice := 0.0, 0.0
+		for _, o := range observations {
+			if o.ObservedAt < w.From {
+				continue
+			}
+
+			price, unitPrice := o.EffectivePrice(), o.EffectivePricePerUnit()
+			if w.Count == 0 {
+				w.Min, w.Max = price, price
+				w.MinUnitPrice, w.MaxUnitPrice = unitPrice, unitPrice
+			}
+			w.Min, w.Max = min(w.Min, price), max(w.Max, price)
+			w.MinUnitPrice, w.MaxUnitPrice = min(w.MinUnitPrice, unitPrice), max(w.MaxUnitPrice, unitPrice)
+
+			totalPrice += price
+			totalUnitPrice += unitPrice
+			w.Count++
+		}
+
+		if w.Count > 0 {
+			w.Average = totalPrice / float64(w.Count)
+			w.AverageUnitPrice = totalUnitPrice / float64(w.Count)
+		}
+	}
+}
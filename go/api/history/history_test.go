@@ -0,0 +1,72 @@
+package history
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSummarise(t *testing.T) {
+	now := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) int64 { return now.Add(-time.Duration(days) * 24 * time.Hour).Unix() }
+
+	observations := []*Observation{
+		{ObservedAt: daysAgo(60), Price: 3.00, PricePerUnit: 1.50},
+		{ObservedAt: daysAgo(20), Price: 2.80, PricePerUnit: 1.40},
+		{ObservedAt: daysAgo(5),  Price: 2.80, PricePerUnit: 1.40, DiscountPrice: 2.00, DiscountPricePerUnit: 1.00},
+		{ObservedAt: daysAgo(1),  Price: 2.90, PricePerUnit: 1.45},
+	}
+
+	windows, err := ParseWindows("")
+	if err != nil {
+		t.Fatalf("Failed to parse the default windows: %s", err)
+	}
+	if Longest(windows) != 90*24*time.Hour {
+		t.Errorf("Expected the longest default window to be 90 days, but got %s", Longest(windows))
+	}
+
+	Summarise(observations, windows, now)
+
+	testCases := []struct {
+		count   int
+		min     float64
+		max     float64
+		average float64
+		minUnit float64
+	}{
+		{2, 2.00, 2.90, 2.45,  1.00},   // 7d
+		{3, 2.00, 2.90, 2.5666666666666664, 1.00},   // 30d
+		{4, 2.00, 3.00, 2.675, 1.00},   // 90d
+	}
+
+	for i, tc := range testCases {
+		w := windows[i]
+		if w.Count != tc.count || w.Min != tc.min || w.Max != tc.max || math.Abs(w.Average-tc.average) > 1e-9 || w.MinUnitPrice != tc.minUnit {
+			t.Errorf("Window %s: expected %+v, but got count %d min %f max %f average %f min unit %f", w.Name, tc, w.Count, w.Min, w.Max, w.Average, w.MinUnitPrice)
+		}
+	}
+}
+
+func TestParseWindows(t *testing.T) {
+	testCases := []struct {
+		raw        string
+		expectedOk bool
+	}{
+		{"24h,7d,4w", true},
+		{" 30d ",     true},
+
+		// These should fail
+		{"7",         false},
+		{"7m",        false},
+		{"0d",        false},
+		{"-1d",       false},
+		{"1d,2d,3d,4d,5d,6d,7d", false},
+	}
+
+	for _, tc := range testCases {
+		_, err := ParseWindows(tc.raw)
+		if (err == nil) != tc.expectedOk {
+			t.Errorf("Expected ok to be %v for '%s', but got error %v", tc.expectedOk, tc.raw, err)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package image_proxy
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jakubruminski/FYP/go/api/product"
+
+	"github.com/jakubruminski/FYP/go/utils/env"
+	"github.com/jakubruminski/FYP/go/utils/http/public"
+	"github.com/jakubruminski/FYP/go/utils/http/response"
+	"github.com/jakubruminski/FYP/go/utils/logger"
+)
+
+const (
+	PATH          = "/api/image"
+	maxImageBytes = 10 << 20
+)
+
+// Requested widths are rounded up to one of these, so the disk cache holds at most
+// a handful of variants per image no matter what clients ask for.
+var allowedWidths = []int{64, 128, 256, 512}
+
+
+// URL returns the proxied address for a seller image.
+//
+// The original URL is signed with TOKEN_KEY, so the endpoint only ever fetches images
+// that this server handed out and can't be used as an open proxy.
+//
+func URL(logger *logger.Logger, imgURL string) (proxiedURL string, ok bool) {
+	if !strings.HasPrefix(imgURL, "http://") && !strings.HasPrefix(imgURL, "https://") {
+		return imgURL, false
+	}
+
+	signature, ok := sign(logger, imgURL)
+	if !ok {
+		return imgURL, false
+	}
+
+	query := neturl.Values{}
+	query.Set("url", imgURL)
+	query.Set("sig", signature)
+
+	return PATH + "?" + query.Encode(), true
+}
+
+// ProxyProducts points ImgURL of every product at the image endpoint.
+// Products keep their seller URL if it can't be signed.
+func ProxyProducts(logger *logger.Logger, products *[]*product.Product) {
+	for _, p := range *products {
+		proxiedURL, ok := URL(logger, p.ImgURL)
+		if !ok {
+			logger.DEBUG_WARN("Serving seller image URL for product %d: '%s'", p.ID, p.ImgURL)
+			continue
+		}
+		p.ImgURL = proxiedURL
+	}
+}
+
+
+// Serve handles GET /api/image?url=<seller url>&sig=<signature>&w=<width>
+func Serve(logger *logger.Logger, w http.ResponseWriter, r *http.Request) (ok bool) {
+	source := r.FormValue("url")
+	signature := r.FormValue("sig")
+
+	if source == "" || !verify(logger, source, signature) {
+		logger.WARN("Refusing to proxy image '%s'", source)
+		response.WriteResponse(logger, w, http.StatusForbidden, "application/json", "error", "Invalid image URL")
+		return true
+	}
+
+	width := fitWidth(r.FormValue("w"))
+
+	cacheDir := env.GetDefault(logger, "IMAGE_CACHE_DIR", "/cache/images")
+	ttlHours := env.GetIntDefault(logger, "IMAGE_CACHE_TTL_HOURS", 168)
+	maxAge := env.GetIntDefault(logger, "IMAGE_MAX_AGE_SECONDS", 7*24*60*60)
+
+	err := os.MkdirAll(cacheDir, 0700)
+	if err != nil {
+		logger.ERROR("Failed to create image cache directory '%s'. Reason: %s", cacheDir, err)
+		return false
+	}
+
+	key := cacheKey(source)
+
+	original, modTime, ok := getOriginal(logger, cacheDir, key, source, time.Duration(ttlHours)*time.Hour)
+	if !ok {
+		logger.ERROR("Failed to get image '%s'", source)
+		return false
+	}
+
+	data := original
+	if width > 0 {
+		data, modTime, ok = getResized(logger, cacheDir, key, original, modTime, width)
+		if !ok {
+			logger.DEBUG_WARN("Failed to resize image '%s' to %d, serving original", source, width)
+			data = original
+		}
+	}
+
+	digest := sha256.Sum256(data)
+
+	w.Header().Set("Content-Type", http.DetectContentType(data))
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", maxAge))
+	w.Header().Set("ETag", `"`+hex.EncodeToString(digest[:8])+`"`)
+
+	http.ServeContent(w, r, "", modTime, bytes.NewReader(data))
+
+	logger.DEBUG("Served image '%s' at width %d (%d bytes)", source, width, len(data))
+	return true
+}
+
+
+// getOriginal returns the cached seller image, refreshing it once it is older than ttl.
+// If the seller can't be reached, a stale copy is better than a broken image.
+func getOriginal(logger *logger.Logger, cacheDir, key, source string, ttl time.Duration) (data []byte, modTime time.Time, ok bool) {
+	path := filepath.Join(cacheDir, key)
+
+	data, modTime, cached := readCache(path)
+	if cached && time.Since(modTime) < ttl {
+		logger.DEBUG("Image cache hit for '%s'", source)
+		return data, modTime, true
+	}
+
+	fetched, ok := fetch(logger, source)
+	if !ok {
+		if cached {
+			logger.WARN("Failed to refresh image '%s', serving stale copy from %s", source, modTime)
+			return data, modTime, true
+		}
+		return nil, time.Time{}, false
+	}
+
+	ok = writeCache(logger, cacheDir, path, fetched)
+	if !ok {
+		logger.DEBUG_WARN("Failed to cache image '%s'", source)
+	}
+
+	return fetched, time.Now(), true
+}
+
+func getResized(logger *logger.Logger, cacheDir, key string, original []byte, originalModTime time.Time, width int) (data []byte, modTime time.Time, ok bool) {
+	path := filepath.Join(cacheDir, fmt.Sprintf("%s_w%d", key, width))
+
+	data, modTime, cached := readCache(path)
+	if cached && !modTime.Before(originalModTime) {
+		return data, modTime, true
+	}
+
+	data, ok = resize(logger, original, width)
+	if !ok {
+		return nil, time.Time{}, false
+	}
+
+	ok = writeCache(logger, cacheDir, path, data)
+	if !ok {
+		logger.DEBUG_WARN("Failed to cache resized image '%s'", path)
+	}
+
+	return data, time.Now(), true
+}
+
+
+// fetch downloads a seller image. Only public addresses are fetched, redirects included, so a
+// signed URL that redirects can't reach this network. IMAGE_ALLOW_PRIVATE=true lifts this, for
+// development.
+func fetch(logger *logger.Logger, source string) (data []byte, ok bool) {
+	client := public.Client(15*time.Second, env.GetBoolDefault(logger, "IMAGE_ALLOW_PRIVATE", false))
+
+	req, err := http.NewRequest("GET", source, nil)
+	if err != nil {
+		logger.ERROR("Error creating HTTP request: %v", err)
+		return nil, false
+	}
+	req.Header.Set("Accept", "image/avif,image/webp,image/png,image/jpeg,image/*;q=0.8")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.ERROR("Error sending GET request: %v", err)
+		return nil, false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		logger.ERROR("Received HTTP status code %d for image %s", resp.StatusCode, source)
+		return nil, false
+	}
+
+	data, err = io.ReadAll(io.LimitReader(resp.Body, maxImageBytes+1))
+	if err != nil {
+		logger.ERROR("Error reading image body: %v", err)
+		return nil, false
+	}
+	if len(data) > maxImageBytes {
+		logger.ERROR("Image %s is larger than %d bytes", source, maxImageBytes)
+		return nil, false
+	}
+
+	if !strings.HasPrefix(http.DetectContentType(data), "image/") && !strings.HasPrefix(resp.Header.Get("Content-Type"), "image/") {
+		logger.ERROR("Response for %s is not an image", source)
+		return nil, false
+	}
+
+	return data, true
+}
+
+
+func readCache(path string) (data []byte, modTime time.Time, ok bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+
+	data, err = os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+
+	return data, info.ModTime(), true
+}
+
+// writeCache writes through a temporary file, so concurrent requests never read a half written image.
+func writeCache(logger *logger.Logger, cacheDir, path string, data []byte) (ok bool) {
+	tmp, err := os.CreateTemp(cacheDir, ".tmp-*")
+	if err != nil {
+		logger.ERROR("Failed to create temporary cache file. Reason: %s", err)
+		return false
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	closeErr := tmp.Close()
+	if err != nil || closeErr != nil {
+		logger.ERROR("Failed to write cache file '%s'. Reason: %v %v", path, err, closeErr)
+		return false
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		logger.ERROR("Failed to move cache file into place '%s'. Reason: %s", path, err)
+		return false
+	}
+
+	return true
+}
+
+
+func cacheKey(source string) string {
+	digest := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(digest[:])
+}
+
+// fitWidth rounds a requested width up to the nearest allowed width. 0 means the original size.
+func fitWidth(requested string) (width int) {
+	value, err := strconv.Atoi(requested)
+	if err != nil || value <= 0 {
+		return 0
+	}
+
+	for _, allowed := range allowedWidths {
+		if value <= allowed {
+			return allowed
+		}
+	}
+	return allowedWidths[len(allowedWidths)-1]
+}
+
+
+func sign(logger *logger.Logger, source string) (signature string, ok bool) {
+	tokenKey, ok := env.Get(logger, "TOKEN_KEY")
+	if !ok {
+		logger.ERROR("Failed to get token key")
+		return "", false
+	}
+
+	h := hmac.New(sha256.New, []byte(tokenKey))
+	h.Write([]byte(source))
+
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)), true
+}
+
+func verify(logger *logger.Logger, source, signature string) bool {
+	expected, ok := sign(logger, source)
+	if !ok {
+		return false
+	}
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
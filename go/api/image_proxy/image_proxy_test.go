@@ -0,0 +1,211 @@
+package image_proxy
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jakubruminski/FYP/go/utils/logger"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	logger := &logger.Logger{}
+	t.Setenv("TOKEN_KEY", "test key")
+
+	source := "https://images.example.com/milk.jpg"
+	signature, ok := sign(logger, source)
+	if !ok {
+		t.Fatalf("Failed to sign '%s'", source)
+	}
+
+	testCases := []struct {
+		source    string
+		signature string
+		valid     bool
+	}{
+		{source, signature, true},
+		{source + "?w=1", signature, false},
+		{"https://images.example.com/bread.jpg", signature, false},
+		{source, "", false},
+		{source, signature[1:], false},
+	}
+
+	for i, tc := range testCases {
+		if verify(logger, tc.source, tc.signature) != tc.valid {
+			t.Errorf("Test case %d: expected valid to be %v for '%s'", i, tc.valid, tc.source)
+		}
+	}
+
+	t.Setenv("TOKEN_KEY", "another key")
+	if verify(logger, source, signature) {
+		t.Errorf("Expected a signature made with another key to be refused")
+	}
+}
+
+func TestFitWidth(t *testing.T) {
+	testCases := []struct {
+		requested string
+		expected  int
+	}{
+		{"", 0},
+		{"abc", 0},
+		{"-5", 0},
+		{"0", 0},
+		{"1", 64},
+		{"64", 64},
+		{"65", 128},
+		{"300", 512},
+		{"512", 512},
+		{"4000", 512},
+	}
+
+	for _, tc := range testCases {
+		if width := fitWidth(tc.requested); width != tc.expected {
+			t.Errorf("Expected %d, but got %d for '%s'", tc.expected, width, tc.requested)
+		}
+	}
+}
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	var buffer bytes.Buffer
+	err := png.Encode(&buffer, image.NewGray(image.Rect(0, 0, width, height)))
+	if err != nil {
+		t.Fatalf("Failed to encode image: %s", err)
+	}
+	return buffer.Bytes()
+}
+
+func TestResize(t *testing.T) {
+	logger := &logger.Logger{}
+
+	testCases := []struct {
+		width, height int
+		to            int
+		expectedWidth int
+		expectedOk    bool
+	}{
+		{200, 100, 64, 64, true},
+		{50, 50, 64, 50, true},                        // never upscaled
+		{1, maxImageSide + 1, 64, 0, false},           // too tall to decode
+		{maxImageSide + 1, 1, 64, 0, false},           // too wide to decode
+	}
+
+	for i, tc := range testCases {
+		resized, ok := resize(logger, encodePNG(t, tc.width, tc.height), tc.to)
+		if ok != tc.expectedOk {
+			t.Errorf("Test case %d: expected ok to be %v, but got %v", i, tc.expectedOk, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		config, _, err := image.DecodeConfig(bytes.NewReader(resized))
+		if err != nil || config.Width != tc.expectedWidth {
+			t.Errorf("Test case %d: expected width %d, but got %d (%v)", i, tc.expectedWidth, config.Width, err)
+		}
+	}
+
+	if _, ok := resize(logger, []byte("not an image"), 64); ok {
+		t.Errorf("Expected something that isn't an image to fail")
+	}
+}
+
+func TestGetOriginal(t *testing.T) {
+	logger := &logger.Logger{}
+	t.Setenv("IMAGE_ALLOW_PRIVATE", "true")   // the test seller listens on loopback
+	cacheDir := t.TempDir()
+	ttl := time.Hour
+
+	original := encodePNG(t, 10, 10)
+	requests := 0
+	available := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if !available {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(original)
+	}))
+	defer server.Close()
+
+	source := server.URL + "/milk.png"
+	key := cacheKey(source)
+	path := filepath.Join(cacheDir, key)
+
+	testCases := []struct {
+		description      string
+		age              time.Duration   // how old the cached copy is made before the call, 0 to leave it
+		available        bool
+		expectedRequests int
+		expectedOk       bool
+	}{
+		{"miss fetches", 0, true, 1, true},
+		{"hit within the TTL", 0, true, 1, true},
+		{"expired copy is refreshed", 2 * ttl, true, 2, true},
+		{"stale copy when the seller is down", 2 * ttl, false, 3, true},
+	}
+
+	for _, tc := range testCases {
+		if tc.age > 0 {
+			old := time.Now().Add(-tc.age)
+			if err := os.Chtimes(path, old, old); err != nil {
+				t.Fatalf("%s: failed to age the cached copy: %s", tc.description, err)
+			}
+		}
+		available = tc.available
+
+		data, _, ok := getOriginal(logger, cacheDir, key, source, ttl)
+		if ok != tc.expectedOk || !bytes.Equal(data, original) {
+			t.Errorf("%s: expected the image (ok %v), but got %d bytes (ok %v)", tc.description, tc.expectedOk, len(data), ok)
+		}
+		if requests != tc.expectedRequests {
+			t.Errorf("%s: expected %d requests to the seller, but got %d", tc.description, tc.expectedRequests, requests)
+		}
+	}
+
+	os.Remove(path)
+	if _, _, ok := getOriginal(logger, cacheDir, key, source, ttl); ok {
+		t.Errorf("Expected no image without a cached copy while the seller is down")
+	}
+}
+
+// Signed URLs come from what sellers list, a seller image that is, or redirects to, an address in
+// this network isn't fetched.
+func TestFetchRefusesPrivateAddresses(t *testing.T) {
+	logger := &logger.Logger{}
+
+	requests := 0
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write(encodePNG(t, 10, 10))
+	}))
+	defer internal.Close()
+
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, internal.URL+"/secret.png", http.StatusFound)
+	}))
+	defer redirect.Close()
+
+	for _, source := range []string{internal.URL + "/milk.png", redirect.URL + "/milk.png"} {
+		if _, ok := fetch(logger, source); ok {
+			t.Errorf("Expected fetching %s to be refused", source)
+		}
+	}
+	if requests != 0 {
+		t.Errorf("Expected no requests to reach the internal server, but got %d", requests)
+	}
+
+	// Lifted for development, the redirect is followed
+	t.Setenv("IMAGE_ALLOW_PRIVATE", "true")
+	if _, ok := fetch(logger, redirect.URL+"/milk.png"); !ok || requests != 1 {
+		t.Errorf("Expected the redirect to be followed with IMAGE_ALLOW_PRIVATE=true, %d requests", requests)
+	}
+}
@@ -0,0 +1,105 @@
+package image_proxy
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+
+	"github.com/jakubruminski/FYP/go/utils/logger"
+)
+
+
+// Images are decoded whole, a few kilobytes of compressed data can claim a size that takes
+// gigabytes to decode. Sellers' images are well below this.
+const maxImageSide = 6000
+
+// resize scales an image down to the given width, keeping its aspect ratio.
+//
+// Only formats in the standard library can be decoded (JPEG, PNG, GIF). Anything else,
+// e.g. WebP, fails here and the caller falls back to serving the original. So does an image
+// wider or taller than maxImageSide, which is never decoded.
+//
+func resize(logger *logger.Logger, original []byte, width int) (resized []byte, ok bool) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(original))
+	if err != nil {
+		logger.DEBUG_WARN("Failed to decode image header. Reason: %s", err)
+		return nil, false
+	}
+	if config.Width > maxImageSide || config.Height > maxImageSide {
+		logger.WARN("Refusing to decode a %dx%d image, the limit is %d on either side", config.Width, config.Height, maxImageSide)
+		return nil, false
+	}
+
+	src, format, err := image.Decode(bytes.NewReader(original))
+	if err != nil {
+		logger.DEBUG_WARN("Failed to decode image. Reason: %s", err)
+		return nil, false
+	}
+
+	// Never upscale, the original is already the best we have.
+	if src.Bounds().Dx() <= width {
+		return original, true
+	}
+
+	dst := scaleDown(src, width)
+
+	var buffer bytes.Buffer
+	if format == "jpeg" {
+		err = jpeg.Encode(&buffer, dst, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&buffer, dst)
+	}
+	if err != nil {
+		logger.ERROR("Failed to encode resized image. Reason: %s", err)
+		return nil, false
+	}
+
+	return buffer.Bytes(), true
+}
+
+// scaleDown averages every block of source pixels that maps onto a destination pixel.
+func scaleDown(src image.Image, width int) (dst *image.RGBA64) {
+	bounds := src.Bounds()
+
+	height := bounds.Dy() * width / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	dst = image.NewRGBA64(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := bounds.Min.Y + (y+1)*bounds.Dy()/height
+		if y1 == y0 {
+			y1++
+		}
+
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := bounds.Min.X + (x+1)*bounds.Dx()/width
+			if x1 == x0 {
+				x1++
+			}
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r += uint64(cr)
+					g += uint64(cg)
+					b += uint64(cb)
+					a += uint64(ca)
+					n++
+				}
+			}
+
+			dst.SetRGBA64(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+
+	return dst
+}
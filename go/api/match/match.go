@@ -0,0 +1,292 @@
+package match
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jakubruminski/FYP/go/api/classify"
+	"github.com/jakubruminski/FYP/go/api/product"
+
+	"github.com/jakubruminski/FYP/go/utils/env"
+	"github.com/jakubruminski/FYP/go/utils/logger"
+	"github.com/jakubruminski/FYP/go/utils/unit"
+)
+
+
+type Group struct {
+	Name            string              `json:"name"`
+	Brand           string              `json:"brand"`
+	PackSize        string              `json:"pack_size"`
+	Confidence      float64             `json:"confidence"`       // 0 to 1, average score of the links that formed the group
+	CheapestSeller  string              `json:"cheapest_seller"`
+	CheapestID      int64               `json:"cheapest_id"`
+	Items           []*product.Product  `json:"items"`
+}
+
+// Pack sizes within this fraction of each other are the same size, e.g. 454g and 450g butter.
+const packSizeTolerance = 0.02
+
+
+// Groups links equivalent products across sellers.
+//
+// Every pair of products from different sellers is scored, and the best pairs are merged
+// first as long as a group never holds two products from the same seller. Only groups with
+// more than one seller are returned, in the order their first product appears in products.
+//
+func Groups(logger *logger.Logger, products *[]*product.Product) (groups []*Group) {
+	threshold := env.GetFloatDefault(logger, "MATCH_THRESHOLD", 0.7)
+	taxonomy := classify.Default(logger)
+
+	items := make([]*features, len(*products))
+	for i, p := range *products {
+		items[i] = extract(taxonomy, p)
+	}
+
+	type link struct {
+		i, j  int
+		score float64
+	}
+
+	links := []link{}
+	for i := range items {
+		for j := i + 1; j < len(items); j++ {
+			if items[i].product.Seller == items[j].product.Seller {
+				continue
+			}
+			s := score(items[i], items[j])
+			if s >= threshold {
+				links = append(links, link{i, j, s})
+			}
+		}
+	}
+
+	sort.SliceStable(links, func(a, b int) bool { return links[a].score > links[b].score })
+
+	parent := make([]int, len(items))
+	sellers := make([]map[string]bool, len(items))
+	scores := make([][]float64, len(items))
+	for i := range items {
+		parent[i] = i
+		sellers[i] = map[string]bool{items[i].product.Seller: true}
+	}
+
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for _, l := range links {
+		ri, rj := find(l.i), find(l.j)
+		if ri == rj || overlaps(sellers[ri], sellers[rj]) {
+			continue
+		}
+		if rj < ri {
+			ri, rj = rj, ri
+		}
+
+		parent[rj] = ri
+		for seller := range sellers[rj] {
+			sellers[ri][seller] = true
+		}
+		scores[ri] = append(append(scores[ri], scores[rj]...), l.score)
+	}
+
+	members := map[int][]*features{}
+	roots := []int{}
+	for i := range items {
+		root := find(i)
+		if _, exists := members[root]; !exists {
+			roots = append(roots, root)
+		}
+		members[root] = append(members[root], items[i])
+	}
+
+	for _, root := range roots {
+		if len(members[root]) < 2 {
+			continue
+		}
+		groups = append(groups, newGroup(members[root], scores[root]))
+	}
+
+	logger.DEBUG("Matched %d products into %d comparison groups", len(items), len(groups))
+	return groups
+}
+
+// GroupOf returns the comparison group containing the product with the given ID.
+func GroupOf(groups []*Group, productID int64) (group *Group, ok bool) {
+	for _, g := range groups {
+		for _, p := range g.Items {
+			if p.ID == productID {
+				return g, true
+			}
+		}
+	}
+	return nil, false
+}
+
+
+type features struct {
+	product   *product.Product
+	tokens    map[string]bool
+	brand     string
+	ownBrand  bool
+	pack      unit.Quantity
+	hasPack   bool
+}
+
+func extract(taxonomy *classify.Taxonomy, p *product.Product) (f *features) {
+	f = &features{product: p, tokens: map[string]bool{}}
+
+	brand, name, _ := taxonomy.Brand(p.Name)
+	f.brand, f.ownBrand = brand.Name, brand.OwnBrand
+
+	pack, ok := unit.ParsePackSize(p.Name)
+	if ok {
+		f.pack = pack.Canonical()
+		f.hasPack = true
+	}
+
+	for _, token := range strings.Fields(name) {
+		if isPackToken(token) {
+			continue
+		}
+		f.tokens[token] = true
+	}
+
+	return f
+}
+
+// score is 1 for certainly the same product and 0 for certainly different.
+func score(a, b *features) float64 {
+	if a.product.EAN != "" && b.product.EAN != "" {
+		if a.product.EAN == b.product.EAN {
+			return 1.0
+		}
+		return 0.0
+	}
+
+	packScore := 0.5
+	if a.hasPack && b.hasPack {
+		if a.pack.Unit != b.pack.Unit || math.Abs(a.pack.Value-b.pack.Value) > packSizeTolerance*math.Max(a.pack.Value, b.pack.Value) {
+			return 0.0
+		}
+		packScore = 1.0
+	}
+
+	brandScore := 0.5
+	switch {
+	case a.brand != "" && a.brand == b.brand:
+		brandScore = 1.0
+	case a.ownBrand && b.ownBrand:
+		// Tesco milk and Dunnes milk are not the same product, but they are what shoppers compare
+		brandScore = 0.7
+	case a.brand != "" && b.brand != "":
+		return 0.0
+	}
+
+	return 0.6*jaccard(a.tokens, b.tokens) + 0.25*brandScore + 0.15*packScore
+}
+
+func newGroup(items []*features, scores []float64) (group *Group) {
+	group = &Group{}
+
+	total := 0.0
+	for _, s := range scores {
+		total += s
+	}
+	group.Confidence = total / float64(len(scores))
+
+	sameUnitType := true
+	for _, f := range items {
+		group.Items = append(group.Items, f.product)
+		if f.product.UnitType != items[0].product.UnitType {
+			sameUnitType = false
+		}
+		if group.Brand == "" {
+			group.Brand = f.brand
+		}
+		if group.PackSize == "" && f.hasPack {
+			group.PackSize = formatQuantity(f.pack)
+		}
+	}
+
+	cheapest := items[0].product
+	for _, f := range items[1:] {
+		if cost(f.product, sameUnitType) < cost(cheapest, sameUnitType) {
+			cheapest = f.product
+		}
+	}
+
+	group.Name = cheapest.Name
+	group.CheapestSeller = cheapest.Seller
+	group.CheapestID = cheapest.ID
+
+	return group
+}
+
+// cost compares by unit price when every item is priced per the same unit, otherwise by shelf price.
+func cost(p *product.Product, byUnit bool) float64 {
+	if byUnit {
+		if p.DiscountPricePerUnit != 0.0 {
+			return p.DiscountPricePerUnit
+		}
+		return p.PricePerUnit
+	}
+	if p.DiscountPrice != 0.0 {
+		return p.DiscountPrice
+	}
+	return p.Price
+}
+
+
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 0.0
+	}
+
+	intersection := 0
+	for token := range a {
+		if b[token] {
+			intersection++
+		}
+	}
+	union := len(a) + len(b) - intersection
+
+	return float64(intersection) / float64(union)
+}
+
+func overlaps(a, b map[string]bool) bool {
+	for key := range a {
+		if b[key] {
+			return true
+		}
+	}
+	return false
+}
+
+// isPackToken drops the parts of a name that describe size, they are compared separately.
+func isPackToken(token string) bool {
+	if token == "x" || strings.ContainsAny(token, "0123456789") {
+		return true
+	}
+	u, ok := unit.Lookup(token)
+	return ok && containsAlias(u, token)
+}
+
+func containsAlias(u *unit.Unit, token string) bool {
+	for _, alias := range u.Aliases {
+		if alias == token {
+			return true
+		}
+	}
+	return false
+}
+
+func formatQuantity(q unit.Quantity) string {
+	return strconv.FormatFloat(math.Round(q.Value*1000)/1000, 'f', -1, 64) + " " + q.Unit.Name
+}
@@ -0,0 +1,58 @@
+package match
+
+import (
+	"testing"
+
+	"github.com/jakubruminski/FYP/go/api/product"
+	"github.com/jakubruminski/FYP/go/utils/logger"
+)
+
+func TestGroups(t *testing.T) {
+	logger := &logger.Logger{}
+
+	products := &[]*product.Product{
+		{ID: 1, Seller: "Tesco",     Name: "Avonmore Fresh Milk 2L",        Price: 2.49, PricePerUnit: 1.245, UnitType: "litre"},
+		{ID: 2, Seller: "Dunnes",    Name: "avonmore fresh milk 2 litre",   Price: 2.39, PricePerUnit: 1.195, UnitType: "litre"},
+		{ID: 3, Seller: "SuperValu", Name: "Avonmore Fresh Milk (2L)",      Price: 2.55, PricePerUnit: 1.275, UnitType: "litre"},
+		{ID: 4, Seller: "Dunnes",    Name: "Avonmore Fresh Milk 1L",        Price: 1.45, PricePerUnit: 1.45,  UnitType: "litre"},
+		{ID: 5, Seller: "Tesco",     Name: "Cadbury Dairy Milk 110g",       Price: 1.99, PricePerUnit: 18.09, UnitType: "kilogram"},
+		{ID: 6, Seller: "SuperValu", Name: "Dawn Fresh Milk 2L",            Price: 2.29, PricePerUnit: 1.145, UnitType: "litre"},
+
+		// Same barcode wins over a different name
+		{ID: 7, Seller: "Tesco",     Name: "Kerrygold Butter 227g",         Price: 3.19, EAN: "5011038130227"},
+		{ID: 8, Seller: "Dunnes",    Name: "Kerrygold Pure Irish Butter",   Price: 2.99, EAN: "5011038130227"},
+	}
+
+	groups := Groups(logger, products)
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 groups, but got %d", len(groups))
+	}
+
+	milk := groups[0]
+	if len(milk.Items) != 3 {
+		t.Errorf("Expected 3 sellers in the milk group, but got %d", len(milk.Items))
+	}
+	for _, p := range milk.Items {
+		if p.ID == 4 || p.ID == 6 {
+			t.Errorf("Product %d '%s' should not be in the Avonmore 2L group", p.ID, p.Name)
+		}
+	}
+	if milk.CheapestSeller != "Dunnes" || milk.CheapestID != 2 {
+		t.Errorf("Expected Dunnes to be cheapest, but got %s (%d)", milk.CheapestSeller, milk.CheapestID)
+	}
+	if milk.PackSize != "2 litre" {
+		t.Errorf("Expected pack size '2 litre', but got '%s'", milk.PackSize)
+	}
+	if milk.Confidence < 0.9 {
+		t.Errorf("Expected high confidence, but got %f", milk.Confidence)
+	}
+
+	butter, ok := GroupOf(groups, 8)
+	if !ok || len(butter.Items) != 2 || butter.Confidence != 1.0 {
+		t.Errorf("Expected products 7 and 8 to be matched by EAN")
+	}
+
+	if _, ok := GroupOf(groups, 5); ok {
+		t.Errorf("Product 5 has no equivalent and should not be grouped")
+	}
+}
@@ -0,0 +1,195 @@
+package normalise
+
+import (
+	_ "embed"
+	"encoding/json"
+	"html"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jakubruminski/FYP/go/utils/env"
+	"github.com/jakubruminski/FYP/go/utils/logger"
+	"github.com/jakubruminski/FYP/go/utils/text"
+)
+
+
+// The built in dictionary, used unless SEARCH_DICTIONARY_FILE points at another one.
+//
+//go:embed dictionary.json
+var defaultDictionary []byte
+
+
+// Dictionary holds the words a search term is normalised with.
+//
+// Synonyms map the Irish, UK and US names of a grocery to one canonical name, the one Irish sellers
+// use, so "zucchini" and "courgettes" are cached as "courgette". Stopwords are dropped, unless
+// the term is nothing but stopwords.
+type Dictionary struct {
+	Stopwords []string   `json:"stopwords"`
+	Synonyms  []*Synonym `json:"synonyms"`
+
+	stopwords map[string]bool
+	variants  []variant
+}
+
+type Synonym struct {
+	Canonical string   `json:"canonical"`
+	Variants  []string `json:"variants"`
+}
+
+type variant struct {
+	words     []string  // normalised and stemmed
+	canonical []string
+}
+
+
+var (
+	once       sync.Once
+	dictionary *Dictionary
+)
+
+// Default returns the dictionary from SEARCH_DICTIONARY_FILE, or the built in one if the
+// variable is unset or the file can't be used. It is loaded once.
+func Default(logger *logger.Logger) *Dictionary {
+	once.Do(func() {
+		dictionary = load(logger)
+	})
+	return dictionary
+}
+
+func load(logger *logger.Logger) *Dictionary {
+	path := env.GetDefault(logger, "SEARCH_DICTIONARY_FILE", "")
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			logger.ERROR("Failed to read search dictionary %s, using the built in one. Reason: %s", path, err)
+		} else if d, ok := Parse(logger, data); ok {
+			logger.INFO("Loaded search dictionary with %d synonyms from %s", len(d.Synonyms), path)
+			return d
+		}
+	}
+
+	d, ok := Parse(logger, defaultDictionary)
+	if !ok {
+		logger.ERROR("Built in search dictionary is invalid")
+		return &Dictionary{stopwords: map[string]bool{}}
+	}
+	return d
+}
+
+// Parse reads a dictionary in the format of dictionary.json.
+func Parse(logger *logger.Logger, data []byte) (d *Dictionary, ok bool) {
+	d = &Dictionary{}
+
+	err := json.Unmarshal(data, d)
+	if err != nil {
+		logger.ERROR("Failed to parse search dictionary. Reason: %s", err)
+		return nil, false
+	}
+
+	d.stopwords = map[string]bool{}
+	for _, word := range d.Stopwords {
+		d.stopwords[text.Stem(text.Normalise(word))] = true
+	}
+
+	for _, s := range d.Synonyms {
+		canonical := stems(s.Canonical)
+		if len(canonical) == 0 {
+			logger.ERROR("Search dictionary synonym needs a canonical name, got '%s'", s.Canonical)
+			return nil, false
+		}
+		for _, v := range s.Variants {
+			if words := stems(v); len(words) > 0 {
+				d.variants = append(d.variants, variant{words, canonical})
+			}
+		}
+	}
+
+	// Longest first, so "green onion" is replaced before any single word of it
+	sort.SliceStable(d.variants, func(i, j int) bool {
+		return len(d.variants[i].words) > len(d.variants[j].words)
+	})
+
+	return d, true
+}
+
+
+// Key is the canonical form of a search term, as the API receives it or as it was typed. It is
+// what searches are cached under, so "Courgettes", "courgette " and "zucchini" share one cache
+// entry. Words are folded to lower case ASCII, stemmed, mapped to their canonical synonym and
+// stopwords are dropped, then joined with "%20" like the escaped terms sent to sellers.
+//
+// A quoted term asks for exactly that phrase, so it is only folded and stays quoted.
+func (d *Dictionary) Key(searchTerm string) string {
+	searchTerm = strings.ReplaceAll(searchTerm, "%20", " ")
+	searchTerm = strings.TrimSpace(html.UnescapeString(searchTerm))
+
+	if len(searchTerm) > 1 && strings.HasPrefix(searchTerm, "\"") && strings.HasSuffix(searchTerm, "\"") {
+		words := text.Tokens(searchTerm)
+		return "\"" + strings.Join(words, "%20") + "\""
+	}
+
+	words := d.synonyms(stems(searchTerm))
+
+	kept := []string{}
+	for _, word := range words {
+		if !d.stopwords[word] {
+			kept = append(kept, word)
+		}
+	}
+	if len(kept) == 0 {
+		kept = words
+	}
+
+	return strings.Join(kept, "%20")
+}
+
+// Key normalises with the default dictionary.
+func Key(logger *logger.Logger, searchTerm string) string {
+	return Default(logger).Key(searchTerm)
+}
+
+
+func (d *Dictionary) synonyms(words []string) (replaced []string) {
+	for i := 0; i < len(words); {
+		matched := false
+		for _, v := range d.variants {
+			if hasPrefix(words[i:], v.words) {
+				replaced = append(replaced, v.canonical...)
+				i += len(v.words)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			replaced = append(replaced, words[i])
+			i++
+		}
+	}
+	return replaced
+}
+
+// Apostrophes are dropped rather than split on, so "jerry's" stems to "jerry" and not "jerry s"
+var apostrophes = strings.NewReplacer("'", "", "’", "")
+
+func stems(phrase string) (words []string) {
+	for _, word := range text.Tokens(apostrophes.Replace(phrase)) {
+		words = append(words, text.Stem(word))
+	}
+	return words
+}
+
+func hasPrefix(words, prefix []string) bool {
+	if len(prefix) > len(words) {
+		return false
+	}
+	for i := range prefix {
+		if words[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+package normalise
+
+import (
+	"testing"
+
+	"github.com/jakubruminski/FYP/go/utils/logger"
+)
+
+func TestKey(t *testing.T) {
+	logger := &logger.Logger{}
+	d := Default(logger)
+
+	testCases := []struct {
+		searchTerm string
+		expected   string
+	}{
+		{"Courgette",                  "courgette"},
+		{"courgettes",                 "courgette"},
+		{"zucchini",                   "courgette"},
+		{"  Zucchinis ",               "courgette"},
+		{"chocolate%20milk",           "chocolate%20milk"},
+		{"milk   chocolate",           "milk%20chocolate"},
+		{"Crème Fraîche",              "creme%20fraiche"},
+		{"green onions",               "spring%20onion"},
+		{"a bag of green onions",      "bag%20spring%20onion"},
+		{"bicarbonate%20of%20soda",    "bread%20soda"},
+		{"ben &amp; jerry&#39;s",      "ben%20jerry"},
+		{"tomatoes",                   "tomato"},
+		{"the",                        "the"},
+		{"\"Free Range  Eggs\"",       "\"free%20range%20eggs\""},
+	}
+
+	for _, tc := range testCases {
+		if key := d.Key(tc.searchTerm); key != tc.expected {
+			t.Errorf("Expected '%s', but got '%s' for '%s'", tc.expected, key, tc.searchTerm)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	logger := &logger.Logger{}
+
+	d, ok := Parse(logger, []byte(`{"stopwords": ["of"], "synonyms": [{"canonical": "sweets", "variants": ["candy"]}]}`))
+	if !ok {
+		t.Fatalf("Expected the dictionary to parse")
+	}
+	if key := d.Key("bag of candy"); key != "bag%20sweet" {
+		t.Errorf("Expected 'bag%%20sweet', but got '%s'", key)
+	}
+
+	_, ok = Parse(logger, []byte(`{"synonyms": [{"canonical": "", "variants": ["candy"]}]}`))
+	if ok {
+		t.Errorf("Expected a synonym without a canonical name to fail")
+	}
+}
@@ -0,0 +1,75 @@
+package product
+
+import (
+	"strconv"
+	"strings"
+)
+
+
+// Change is a field of a stored product that a re-scrape found different.
+type Change struct {
+	ProductID int64  `json:"product_id"`
+	Field     string `json:"field"`   // column name
+	Old       string `json:"old"`
+	New       string `json:"new"`
+}
+
+func float(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// Changes lists the fields that differ between a stored product and a fresh scrape of it. An EAN
+// missing from the scrape isn't a change, sellers only publish it on some pages.
+func Changes(stored, scraped *Product) (changes []*Change) {
+	fields := []struct {
+		name     string
+		old, new string
+	}{
+		{"seller",                  stored.Seller,                      scraped.Seller},
+		{"name",                    stored.Name,                        scraped.Name},
+		{"currency",                stored.Currency,                    scraped.Currency},
+		{"price",                   float(stored.Price),                float(scraped.Price)},
+		{"price_per_unit",          float(stored.PricePerUnit),         float(scraped.PricePerUnit)},
+		{"discount_price",          float(stored.DiscountPrice),        float(scraped.DiscountPrice)},
+		{"discount_price_per_unit", float(stored.DiscountPricePerUnit), float(scraped.DiscountPricePerUnit)},
+		{"discount_price_in_words", stored.DiscountPriceInWords,        scraped.DiscountPriceInWords},
+		{"unit_type",               stored.UnitType,                    scraped.UnitType},
+		{"img_url",                 stored.ImgURL,                      scraped.ImgURL},
+		{"brand",                   stored.Brand,                       scraped.Brand},
+		{"own_brand",               strconv.FormatBool(stored.OwnBrand), strconv.FormatBool(scraped.OwnBrand)},
+		{"category",                stored.Category,                    scraped.Category},
+		{"in_stock",                strconv.FormatBool(stored.InStock), strconv.FormatBool(scraped.InStock)},
+	}
+	if scraped.EAN != "" {
+		fields = append(fields, struct {
+			name     string
+			old, new string
+		}{"ean", stored.EAN, scraped.EAN})
+	}
+
+	for _, f := range fields {
+		if f.old != f.new {
+			changes = append(changes, &Change{ProductID: stored.ID, Field: f.name, Old: f.old, New: f.new})
+		}
+	}
+	return changes
+}
+
+// Missing returns the products a search found before that it didn't find this time. Only sellers
+// with results this time count, a seller that failed to answer says nothing about its products.
+// Products are compared by ID, so scraped ones must already be stored.
+func Missing(before, scraped []*Product) (missing []*Product) {
+	sellers := map[string]bool{}
+	found := map[int64]bool{}
+	for _, p := range scraped {
+		sellers[strings.ToLower(p.Seller)] = true
+		found[p.ID] = true
+	}
+
+	for _, p := range before {
+		if sellers[strings.ToLower(p.Seller)] && !found[p.ID] {
+			missing = append(missing, p)
+		}
+	}
+	return missing
+}
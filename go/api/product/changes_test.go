@@ -0,0 +1,61 @@
+package product
+
+import (
+	"testing"
+)
+
+func TestChanges(t *testing.T) {
+	stored := &Product{ID: 7, Seller: "Tesco", Name: "Milk 2L", Currency: "EUR", Price: 2.50, PricePerUnit: 1.25, ImgURL: "a.jpg", EAN: "5000000000001", InStock: true}
+
+	testCases := []struct {
+		scraped  Product
+		expected []string   // changed fields, in order
+	}{
+		{*stored, nil},
+		{Product{Seller: "Tesco", Name: "Milk 2L", Currency: "EUR", Price: 2.20, PricePerUnit: 1.10, DiscountPriceInWords: "Clubcard Price", ImgURL: "a.jpg", InStock: true},
+			[]string{"price", "price_per_unit", "discount_price_in_words"}},
+		{Product{Seller: "Tesco", Name: "Milk 2L", Currency: "EUR", Price: 2.50, PricePerUnit: 1.25, ImgURL: "b.jpg", EAN: "5000000000002"},
+			[]string{"img_url", "in_stock", "ean"}},
+	}
+
+	for i, tc := range testCases {
+		changes := Changes(stored, &tc.scraped)
+		if len(changes) != len(tc.expected) {
+			t.Errorf("Test case %d: expected %d changes, but got %d", i, len(tc.expected), len(changes))
+			continue
+		}
+		for j, c := range changes {
+			if c.Field != tc.expected[j] || c.ProductID != 7 {
+				t.Errorf("Test case %d: expected change %d to be %s of product 7, but got %s of product %d", i, j, tc.expected[j], c.Field, c.ProductID)
+			}
+		}
+	}
+
+	changes := Changes(stored, &testCases[1].scraped)
+	if changes[0].Old != "2.5" || changes[0].New != "2.2" {
+		t.Errorf("Expected price to change from 2.5 to 2.2, but got %s to %s", changes[0].Old, changes[0].New)
+	}
+}
+
+func TestMissing(t *testing.T) {
+	before := []*Product{
+		{ID: 1, Seller: "Tesco"},
+		{ID: 2, Seller: "Tesco"},
+		{ID: 3, Seller: "Dunnes"},
+		{ID: 4, Seller: "SuperValu"},
+	}
+	scraped := []*Product{
+		{ID: 1, Seller: "tesco"},
+		{ID: 5, Seller: "Dunnes"},
+	}
+
+	// SuperValu returned nothing, so product 4 isn't missing
+	missing := Missing(before, scraped)
+	if len(missing) != 2 || missing[0].ID != 2 || missing[1].ID != 3 {
+		t.Errorf("Expected products 2 and 3 to be missing, but got %v", missing)
+	}
+
+	if missing := Missing(nil, scraped); len(missing) != 0 {
+		t.Errorf("Expected nothing missing without products before, but got %d", len(missing))
+	}
+}
@@ -0,0 +1,228 @@
+package product
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/jakubruminski/FYP/go/utils/logger"
+)
+
+
+// Filter narrows search results. Zero values mean "don't filter on this".
+// Prices are compared with the discount applied, the way sorting compares them.
+type Filter struct {
+	Sellers        []string
+	Brands         []string
+	Categories     []string
+	MinPrice       float64
+	MaxPrice       float64
+	MinUnitPrice   float64
+	MaxUnitPrice   float64
+	UnitType       string
+	DiscountedOnly bool
+	InStockOnly    bool
+}
+
+// ParseFilter reads the filter query parameters of /api/search.
+//
+//  seller=Tesco&seller=Dunnes or seller=Tesco,Dunnes
+//  brand=Avonmore
+//  category=Dairy %26 Eggs, repeated for more than one, as category names can have commas
+//  min_price, max_price, min_unit_price, max_unit_price
+//  unit_type=kilogram
+//  discounted=true, in_stock=true
+//
+func ParseFilter(logger *logger.Logger, r *http.Request) (filter *Filter, ok bool) {
+	filter = &Filter{}
+
+	// FormValue parses the form, r.Form then has every repeated value
+	r.FormValue("seller")
+	filter.Sellers = listValues(r.Form["seller"])
+	filter.Brands = listValues(r.Form["brand"])
+	for _, category := range r.Form["category"] {
+		if category = strings.TrimSpace(category); category != "" {
+			filter.Categories = append(filter.Categories, category)
+		}
+	}
+	filter.UnitType = strings.ToLower(strings.TrimSpace(r.FormValue("unit_type")))
+
+	floats := map[string]*float64{
+		"min_price":      &filter.MinPrice,
+		"max_price":      &filter.MaxPrice,
+		"min_unit_price": &filter.MinUnitPrice,
+		"max_unit_price": &filter.MaxUnitPrice,
+	}
+	for key, value := range floats {
+		raw := strings.TrimSpace(r.FormValue(key))
+		if raw == "" {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil || parsed < 0 {
+			logger.ERROR("Invalid %s '%s'", key, raw)
+			return nil, false
+		}
+		*value = parsed
+	}
+
+	bools := map[string]*bool{
+		"discounted": &filter.DiscountedOnly,
+		"in_stock":   &filter.InStockOnly,
+	}
+	for key, value := range bools {
+		raw := strings.TrimSpace(r.FormValue(key))
+		if raw == "" {
+			continue
+		}
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			logger.ERROR("Invalid %s '%s'", key, raw)
+			return nil, false
+		}
+		*value = parsed
+	}
+
+	return filter, true
+}
+
+func (f *Filter) IsEmpty() bool {
+	return f == nil ||
+		(len(f.Sellers) == 0 && len(f.Brands) == 0 && len(f.Categories) == 0 && f.UnitType == "" &&
+			f.MinPrice == 0 && f.MaxPrice == 0 && f.MinUnitPrice == 0 && f.MaxUnitPrice == 0 &&
+			!f.DiscountedOnly && !f.InStockOnly)
+}
+
+
+// Matches is the in memory version of Where, for freshly scraped products.
+func (f *Filter) Matches(p *Product) bool {
+	if f.IsEmpty() {
+		return true
+	}
+
+	switch {
+	case len(f.Sellers) > 0 && !containsFold(f.Sellers, p.Seller):
+		return false
+	case len(f.Brands) > 0 && !containsFold(f.Brands, p.Brand):
+		return false
+	case len(f.Categories) > 0 && !containsFold(f.Categories, p.Category):
+		return false
+	case f.UnitType != "" && f.UnitType != strings.ToLower(p.UnitType):
+		return false
+	case f.MinPrice != 0 && p.EffectivePrice() < f.MinPrice:
+		return false
+	case f.MaxPrice != 0 && p.EffectivePrice() > f.MaxPrice:
+		return false
+	case f.MinUnitPrice != 0 && p.EffectivePricePerUnit() < f.MinUnitPrice:
+		return false
+	case f.MaxUnitPrice != 0 && p.EffectivePricePerUnit() > f.MaxUnitPrice:
+		return false
+	case f.DiscountedOnly && !p.IsDiscounted():
+		return false
+	case f.InStockOnly && !p.InStock:
+		return false
+	}
+
+	return true
+}
+
+// Apply removes the products that don't match, keeping the order of the rest.
+func (f *Filter) Apply(products *[]*Product) {
+	if f.IsEmpty() {
+		return
+	}
+
+	kept := (*products)[:0]
+	for _, p := range *products {
+		if f.Matches(p) {
+			kept = append(kept, p)
+		}
+	}
+	*products = kept
+}
+
+// Where turns the filter into SQL conditions on the products table, to be added to a query
+// with AND. Placeholders are numbered from firstArg, so the query's own arguments come first.
+func (f *Filter) Where(firstArg int) (conditions string, args []interface{}) {
+	if f.IsEmpty() {
+		return "", nil
+	}
+
+	clauses := []string{}
+	add := func(clause string, arg interface{}) {
+		args = append(args, arg)
+		clauses = append(clauses, fmt.Sprintf(clause, firstArg+len(args)-1))
+	}
+
+	if len(f.Sellers) > 0 {
+		add("LOWER(seller) = ANY($%d)", pq.Array(lowered(f.Sellers)))
+	}
+	if len(f.Brands) > 0 {
+		add("LOWER(brand) = ANY($%d)", pq.Array(lowered(f.Brands)))
+	}
+	if len(f.Categories) > 0 {
+		add("LOWER(category) = ANY($%d)", pq.Array(lowered(f.Categories)))
+	}
+	if f.UnitType != "" {
+		add("LOWER(unit_type) = $%d", f.UnitType)
+	}
+	if f.MinPrice != 0 {
+		add("COALESCE(NULLIF(discount_price, 0), price) >= $%d", f.MinPrice)
+	}
+	if f.MaxPrice != 0 {
+		add("COALESCE(NULLIF(discount_price, 0), price) <= $%d", f.MaxPrice)
+	}
+	if f.MinUnitPrice != 0 {
+		add("COALESCE(NULLIF(discount_price_per_unit, 0), price_per_unit) >= $%d", f.MinUnitPrice)
+	}
+	if f.MaxUnitPrice != 0 {
+		add("COALESCE(NULLIF(discount_price_per_unit, 0), price_per_unit) <= $%d", f.MaxUnitPrice)
+	}
+	if f.DiscountedOnly {
+		clauses = append(clauses, "(discount_price <> 0 OR discount_price_in_words <> '')")
+	}
+	if f.InStockOnly {
+		clauses = append(clauses, "COALESCE(in_stock, TRUE)")
+	}
+
+	return strings.Join(clauses, " AND "), args
+}
+
+
+// IsDiscounted is true for a reduced price as well as for offers only given in words, like "Any 3 for €10".
+func (p *Product) IsDiscounted() bool {
+	return p.DiscountPrice != 0.0 || p.DiscountPriceInWords != ""
+}
+
+
+// listValues splits comma separated values and drops empty ones.
+func listValues(values []string) (result []string) {
+	for _, value := range values {
+		for _, v := range strings.Split(value, ",") {
+			v = strings.TrimSpace(v)
+			if v != "" {
+				result = append(result, v)
+			}
+		}
+	}
+	return result
+}
+
+func lowered(values []string) (result []string) {
+	for _, v := range values {
+		result = append(result, strings.ToLower(v))
+	}
+	return result
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
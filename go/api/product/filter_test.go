@@ -0,0 +1,89 @@
+package product
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jakubruminski/FYP/go/utils/logger"
+)
+
+func TestFilter(t *testing.T) {
+	logger := &logger.Logger{}
+
+	products := []*Product{
+		{ID: 1, Seller: "Tesco",     Brand: "Avonmore", Category: "Dairy & Eggs", Price: 2.50, PricePerUnit: 1.25, UnitType: "litre", InStock: true},
+		{ID: 2, Seller: "Dunnes",    Brand: "Avonmore", Category: "Dairy & Eggs", Price: 1.50, PricePerUnit: 1.50, DiscountPrice: 1.00, DiscountPricePerUnit: 1.00, UnitType: "litre", InStock: true},
+		{ID: 3, Seller: "SuperValu", Brand: "Dawn",     Price: 3.30, PricePerUnit: 1.10, UnitType: "litre", DiscountPriceInWords: "Any 2 for €6"},
+		{ID: 4, Seller: "Tesco",     Brand: "Kerrygold", Category: "Beer, Wine & Spirits", Price: 4.00, PricePerUnit: 17.62, UnitType: "kilogram", InStock: true},
+	}
+
+	testCases := []struct {
+		query       string
+		expectedIDs []int64
+		expectedOk  bool
+	}{
+		{"",                                  []int64{1, 2, 3, 4}, true},
+		{"seller=tesco",                      []int64{1, 4},       true},
+		{"seller=Tesco,Dunnes",               []int64{1, 2, 4},    true},
+		{"seller=Dunnes&seller=SuperValu",    []int64{2, 3},       true},
+		{"brand=avonmore",                    []int64{1, 2},       true},
+		{"min_price=1.5&max_price=3.3",       []int64{1, 3},       true},
+		{"max_unit_price=1.2",                []int64{2, 3},       true},
+		{"unit_type=Kilogram",                []int64{4},          true},
+		{"category=dairy+%26+eggs",           []int64{1, 2},       true},
+		{"category=Beer,+Wine+%26+Spirits",   []int64{4},          true},
+		{"discounted=true",                   []int64{2, 3},       true},
+		{"in_stock=1&unit_type=litre",        []int64{1, 2},       true},
+
+		// These should fail
+		{"min_price=cheap",                   nil,                 false},
+		{"max_unit_price=-1",                 nil,                 false},
+		{"discounted=maybe",                  nil,                 false},
+	}
+
+	for _, tc := range testCases {
+		r := httptest.NewRequest("GET", "/api/search?"+tc.query, nil)
+
+		filter, ok := ParseFilter(logger, r)
+		if ok != tc.expectedOk {
+			t.Errorf("Expected ok to be %v, but got %v for '%s'", tc.expectedOk, ok, tc.query)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		filtered := append([]*Product{}, products...)
+		filter.Apply(&filtered)
+
+		if len(filtered) != len(tc.expectedIDs) {
+			t.Errorf("Expected %v, but got %d products for '%s'", tc.expectedIDs, len(filtered), tc.query)
+			continue
+		}
+		for i, p := range filtered {
+			if p.ID != tc.expectedIDs[i] {
+				t.Errorf("Expected %v, but got product %d at %d for '%s'", tc.expectedIDs, p.ID, i, tc.query)
+				break
+			}
+		}
+	}
+}
+
+func TestFilterWhere(t *testing.T) {
+	filter := &Filter{Sellers: []string{"Tesco"}, MaxUnitPrice: 2.0, DiscountedOnly: true}
+
+	conditions, args := filter.Where(2)
+
+	expected := "LOWER(seller) = ANY($2) AND COALESCE(NULLIF(discount_price_per_unit, 0), price_per_unit) <= $3 AND (discount_price <> 0 OR discount_price_in_words <> '')"
+	if conditions != expected {
+		t.Errorf("Expected '%s', but got '%s'", expected, conditions)
+	}
+	if len(args) != 2 {
+		t.Errorf("Expected 2 arguments, but got %d", len(args))
+	}
+
+	conditions, args = (&Filter{}).Where(2)
+	if conditions != "" || args != nil {
+		t.Errorf("Expected no conditions for an empty filter, but got '%s'", conditions)
+	}
+}
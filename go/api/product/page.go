@@ -0,0 +1,121 @@
+package product
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/jakubruminski/FYP/go/utils/logger"
+)
+
+
+// Cursor marks where the previous page ended.
+//
+// It holds the sort keys of the last product sent rather than an offset, so the next page
+// starts right after that product wherever it now sits. Re-sorting the same cached results
+// gives the same pages, and a refresh that adds or drops products doesn't repeat or skip
+// the ones around the page boundary.
+type Cursor struct {
+	Sorting string        `json:"s"`   // SortingName the cursor was made with
+	Last    cursorProduct `json:"l"`
+}
+
+// cursorProduct is everything the comparators look at. A field a comparator starts to read has
+// to be added here too, TestCursorKeepsSortKeys fails until it is.
+type cursorProduct struct {
+	ID                   int64   `json:"i"`
+	Seller               string  `json:"s"`
+	Name                 string  `json:"n"`
+	Price                float64 `json:"p"`
+	PricePerUnit         float64 `json:"u"`
+	DiscountPrice        float64 `json:"d"`
+	DiscountPricePerUnit float64 `json:"du"`
+	UnitType             string  `json:"ut"`
+	Relevance            float64 `json:"r"`
+	Score                float64 `json:"sc"`
+}
+
+
+// Paginate cuts the page after cursor out of products, which must already be sorted with comparator.
+// A nil cursor is the first page, a pageSize of 0 or less is everything that is left.
+// next is the cursor for the following page, empty on the last one.
+func Paginate(products *[]*Product, comparator Comparator, sorting string, cursor *Cursor, pageSize int) (next string) {
+	start := 0
+	if cursor != nil {
+		last := cursor.Last.product()
+		for start < len(*products) && comparator((*products)[start], last) <= 0 {
+			start++
+		}
+	}
+
+	end := len(*products)
+	if pageSize > 0 && start+pageSize < end {
+		end = start + pageSize
+	}
+
+	hasMore := end < len(*products)
+	*products = (*products)[start:end]
+
+	if !hasMore || len(*products) == 0 {
+		return ""
+	}
+	return EncodeCursor(sorting, (*products)[len(*products)-1])
+}
+
+func EncodeCursor(sorting string, last *Product) string {
+	cursor := Cursor{
+		Sorting: sorting,
+		Last: cursorProduct{
+			ID:                   last.ID,
+			Seller:               last.Seller,
+			Name:                 last.Name,
+			Price:                last.Price,
+			PricePerUnit:         last.PricePerUnit,
+			DiscountPrice:        last.DiscountPrice,
+			DiscountPricePerUnit: last.DiscountPricePerUnit,
+			UnitType:             last.UnitType,
+			Relevance:            last.Relevance,
+			Score:                last.Score,
+		},
+	}
+
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseCursor decodes a cursor from the query string. An empty string is no cursor.
+func ParseCursor(logger *logger.Logger, raw string) (cursor *Cursor, ok bool) {
+	if raw == "" {
+		return nil, true
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		logger.ERROR("Failed to decode cursor. Reason: %s", err)
+		return nil, false
+	}
+
+	cursor = &Cursor{}
+	err = json.Unmarshal(data, cursor)
+	if err != nil || cursor.Sorting == "" {
+		logger.ERROR("Invalid cursor '%s'", raw)
+		return nil, false
+	}
+
+	return cursor, true
+}
+
+
+func (c cursorProduct) product() *Product {
+	return &Product{
+		ID:                   c.ID,
+		Seller:               c.Seller,
+		Name:                 c.Name,
+		Price:                c.Price,
+		PricePerUnit:         c.PricePerUnit,
+		DiscountPrice:        c.DiscountPrice,
+		DiscountPricePerUnit: c.DiscountPricePerUnit,
+		UnitType:             c.UnitType,
+		Relevance:            c.Relevance,
+		Score:                c.Score,
+	}
+}
@@ -0,0 +1,156 @@
+package product
+
+import (
+	"testing"
+
+	"github.com/jakubruminski/FYP/go/utils/logger"
+)
+
+func TestPaginate(t *testing.T) {
+	logger := &logger.Logger{}
+
+	newProducts := func() []*Product {
+		return []*Product{
+			{ID: 5, Seller: "Tesco",     Name: "E", PricePerUnit: 5},
+			{ID: 1, Seller: "Dunnes",    Name: "A", PricePerUnit: 1},
+			{ID: 4, Seller: "SuperValu", Name: "D", PricePerUnit: 4},
+			{ID: 2, Seller: "Tesco",     Name: "B", PricePerUnit: 2},
+			{ID: 3, Seller: "Dunnes",    Name: "C", PricePerUnit: 2},
+		}
+	}
+
+	comparator, _ := Sorting("", "")
+	sorting := SortingName("", "")
+
+	pages := collectPages(t, logger, newProducts, comparator, sorting, 2)
+	expectPages(t, [][]int64{{1, 2}, {3, 4}, {5}}, pages)
+
+	// The last product of the first page is gone after a refresh, the second page still starts at 3
+	cursor, _ := ParseCursor(logger, EncodeCursor(sorting, &Product{ID: 2, Seller: "Tesco", Name: "B", PricePerUnit: 2}))
+	products := newProducts()
+	products = append(products[:3], products[4:]...)
+	SortBy(&products, comparator)
+
+	Paginate(&products, comparator, sorting, cursor, 2)
+	if len(products) != 2 || products[0].ID != 3 || products[1].ID != 4 {
+		t.Errorf("Expected products 3 and 4 after the cursor")
+	}
+
+	if _, ok := ParseCursor(logger, "not a cursor"); ok {
+		t.Errorf("Expected an invalid cursor to fail")
+	}
+}
+
+// The cursor keeps the unit type, ByUnitPrice groups by dimension before it compares prices.
+func TestPaginateAcrossDimensions(t *testing.T) {
+	logger := &logger.Logger{}
+
+	newProducts := func() []*Product {
+		return []*Product{
+			{ID: 1, Seller: "Tesco",     Name: "A", PricePerUnit: 5,   UnitType: "kilogram"},
+			{ID: 2, Seller: "Dunnes",    Name: "B", PricePerUnit: 1,   UnitType: "litre"},
+			{ID: 3, Seller: "SuperValu", Name: "C", PricePerUnit: 0.3, UnitType: "each"},
+			{ID: 4, Seller: "Tesco",     Name: "D", PricePerUnit: 2,   UnitType: "kilogram"},
+			{ID: 5, Seller: "Dunnes",    Name: "E", PricePerUnit: 0.2, UnitType: "each"},
+			{ID: 6, Seller: "SuperValu", Name: "F", PricePerUnit: 3,   UnitType: "litre"},
+			{ID: 7, Seller: "Tesco",     Name: "G", PricePerUnit: 9,   UnitType: "kilogram"},
+		}
+	}
+
+	comparator, _ := Sorting("", "")
+	pages := collectPages(t, logger, newProducts, comparator, SortingName("", ""), 2)
+	expectPages(t, [][]int64{{4, 1}, {7, 2}, {6, 5}, {3}}, pages)
+
+	comparator, _ = Sorting(SORT_NAME, ORDER_DESC)
+	pages = collectPages(t, logger, newProducts, comparator, SortingName(SORT_NAME, ORDER_DESC), 3)
+	expectPages(t, [][]int64{{7, 6, 5}, {4, 3, 2}, {1}}, pages)
+}
+
+
+// A product read back from its cursor compares equal to it in every sort, so the next page starts
+// right after it and nothing is skipped or repeated.
+func TestCursorKeepsSortKeys(t *testing.T) {
+	logger := &logger.Logger{}
+
+	original := &Product{
+		ID:                   42,
+		Seller:               "SuperValu",
+		Name:                 "Avonmore Fresh Milk 2L",
+		Currency:             "EUR",
+		Price:                2.49,
+		PricePerUnit:         1.245,
+		DiscountPrice:        1.99,
+		DiscountPricePerUnit: 0.995,
+		UnitType:             "litre",
+		Relevance:            0.8,
+		Score:                0.65,
+	}
+
+	for mode := range sortModes {
+		for _, order := range []string{ORDER_ASC, ORDER_DESC} {
+			comparator, _ := Sorting(mode, order)
+			comparator = Then(RelevantFirst(0.5), comparator)
+			sorting := SortingName(mode, order)
+
+			cursor, ok := ParseCursor(logger, EncodeCursor(sorting, original))
+			if !ok {
+				t.Fatalf("Failed to parse the cursor for %s", sorting)
+			}
+
+			if result := comparator(cursor.Last.product(), original); result != 0 {
+				t.Errorf("Expected the product read back from the cursor to equal the original for %s, but got %d", sorting, result)
+			}
+		}
+	}
+}
+
+// collectPages asks for page after page until there are no more. Every request re-sorts the
+// cached results from scratch.
+func collectPages(t *testing.T, logger *logger.Logger, newProducts func() []*Product, comparator Comparator, sorting string, pageSize int) (pages [][]int64) {
+	t.Helper()
+
+	var cursor *Cursor
+	for {
+		products := newProducts()
+		SortBy(&products, comparator)
+
+		next := Paginate(&products, comparator, sorting, cursor, pageSize)
+
+		ids := []int64{}
+		for _, p := range products {
+			ids = append(ids, p.ID)
+		}
+		pages = append(pages, ids)
+
+		if next == "" {
+			return pages
+		}
+		if len(pages) > len(newProducts()) {
+			t.Fatalf("Expected the pages to end, but got %v", pages)
+		}
+
+		var ok bool
+		cursor, ok = ParseCursor(logger, next)
+		if !ok {
+			t.Fatalf("Failed to parse cursor '%s'", next)
+		}
+	}
+}
+
+func expectPages(t *testing.T, expected, pages [][]int64) {
+	t.Helper()
+
+	if len(pages) != len(expected) {
+		t.Fatalf("Expected pages %v, but got %v", expected, pages)
+	}
+	for i := range expected {
+		if len(pages[i]) != len(expected[i]) {
+			t.Fatalf("Expected pages %v, but got %v", expected, pages)
+		}
+		for j := range expected[i] {
+			if pages[i][j] != expected[i][j] {
+				t.Fatalf("Expected pages %v, but got %v", expected, pages)
+			}
+		}
+	}
+}
@@ -4,8 +4,8 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
-	"sort"
 
+	currency_utils "github.com/jakubruminski/FYP/go/utils/currency"
 	"github.com/jakubruminski/FYP/go/utils/logger"
 )
 
@@ -21,35 +21,63 @@ type Product struct {
 	DiscountPricePerUnit float64 `json:"discount_price_per_unit"`
 	DiscountPriceInWords string  `json:"discount_price_in_words"`
 	UnitType             string  `json:"unit_type"`
+	ConvertedFrom        string  `json:"converted_from,omitempty"`  // unit type the seller priced it in, when ConvertUnits changed it
 
 	URL                  string  `json:"url"`
 	ImgURL               string  `json:"img_url"`
+	EAN                  string  `json:"ean,omitempty"`   // barcode, when a seller publishes it
+
+	Brand                string  `json:"brand"`
+	OwnBrand             bool    `json:"own_brand"`       // the seller's own label, e.g. Tesco Finest
+	Category             string  `json:"category"`
+	InStock              bool    `json:"in_stock"`
+
+	Relevance            float64 `json:"relevance,omitempty"`  // how well the name matches the search, 0 to 1
+	Score                float64 `json:"score,omitempty"`      // relevance blended with unit price, for "best_match"
+	Promotion            string  `json:"promotion,omitempty"`  // kind of offer, set by the deals feed
+
+	LastSeen             int64   `json:"last_seen,omitempty"`      // unix seconds, when its seller last listed it
+	MissingSince         int64   `json:"missing_since,omitempty"`  // unix seconds, when a re-scrape no longer found it
+
+	Converted            *ConvertedPrice `json:"converted,omitempty"`  // prices in the currency the client asked for
 }
 
-func ProductCreateQuery() (query string) {
-	return `
-	CREATE TABLE IF NOT EXISTS products (
-		id                                  SERIAL PRIMARY KEY,
-		seller                              VARCHAR(255),
-		name                                VARCHAR(255),
-		currency                            VARCHAR(10),
-		price                               DOUBLE PRECISION,
-		price_per_unit                      DOUBLE PRECISION,
-		discount_price                      DOUBLE PRECISION,
-		discount_price_per_unit             DOUBLE PRECISION,
-		discount_price_in_words             VARCHAR(255),
-		unit_type                           VARCHAR(30),
-		url                                 VARCHAR(255),
-		img_url                             VARCHAR(255)
-	)	
-	`
+type ConvertedPrice struct {
+	Currency             string  `json:"currency"`
+	Rate                 float64 `json:"rate"`
+	Price                float64 `json:"price"`
+	PricePerUnit         float64 `json:"price_per_unit"`
+	DiscountPrice        float64 `json:"discount_price"`
+	DiscountPricePerUnit float64 `json:"discount_price_per_unit"`
 }
 
+// ProductInsertQuery adds a product, or refreshes the one already stored under its URL with what
+// was scraped. Either way it returns the product's id. A missing EAN keeps the stored one.
+// An empty category is stored as it is, the product was classified and matched none. NULL is
+// left for products stored before they were classified, see query_products.Classify.
 func ProductInsertQuery() (query string) {
 	query = `
     INSERT INTO products
-    (seller, name, currency, price, price_per_unit, discount_price, discount_price_per_unit, discount_price_in_words, unit_type, url, img_url)
-    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+    (seller, name, currency, price, price_per_unit, discount_price, discount_price_per_unit, discount_price_in_words, unit_type, url, img_url, ean, brand, own_brand, category, in_stock, last_seen)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), $11, NULLIF($12, ''), NULLIF($13, ''), $14, $15, $16, $17)
+    ON CONFLICT (url) DO UPDATE SET
+        seller                  = EXCLUDED.seller,
+        name                    = EXCLUDED.name,
+        currency                = EXCLUDED.currency,
+        price                   = EXCLUDED.price,
+        price_per_unit          = EXCLUDED.price_per_unit,
+        discount_price          = EXCLUDED.discount_price,
+        discount_price_per_unit = EXCLUDED.discount_price_per_unit,
+        discount_price_in_words = EXCLUDED.discount_price_in_words,
+        unit_type               = EXCLUDED.unit_type,
+        img_url                 = EXCLUDED.img_url,
+        ean                     = COALESCE(EXCLUDED.ean, products.ean),
+        brand                   = EXCLUDED.brand,
+        own_brand               = EXCLUDED.own_brand,
+        category                = EXCLUDED.category,
+        in_stock                = EXCLUDED.in_stock,
+        last_seen               = EXCLUDED.last_seen,
+        missing_since           = NULL
 	RETURNING id
     `
 	return query
@@ -70,7 +98,7 @@ func NewProduct(logger                     *logger.Logger,
 				imgURL                     string) (product *Product, ok bool) {
 
 
-	product = initProduct(logger, currency, seller, name, price, pricePerUnit, discountPrice, discountPricePerUnit, DiscountPriceInWords, pricePerUnitUnitType, url, imgURL)
+	product = initProduct(logger, currency_utils.Code(currency), seller, name, price, pricePerUnit, discountPrice, discountPricePerUnit, DiscountPriceInWords, pricePerUnitUnitType, url, imgURL)
 
 	return product, true
 }
@@ -98,6 +126,8 @@ func ParseProduct(logger *logger.Logger, r *http.Request) (product *Product, ok
     }
 
     product = result.Result
+    product.Currency = currency_utils.Code(product.Currency)
+    product.Converted = nil
 
     logger.DEBUG("p.ID: %d", product.ID)
     logger.DEBUG("p.Name: %s", product.Name)
@@ -110,6 +140,8 @@ func ParseProduct(logger *logger.Logger, r *http.Request) (product *Product, ok
     logger.DEBUG("p.UnitType: %s", product.UnitType)
     logger.DEBUG("p.URL: %s", product.URL)
     logger.DEBUG("p.ImgURL: %s", product.ImgURL)
+    logger.DEBUG("p.Brand: %s", product.Brand)
+    logger.DEBUG("p.Category: %s", product.Category)
 
     return product, true
 }
@@ -131,6 +163,7 @@ func initProduct(logger *logger.Logger, currency, seller, name string, price, pr
 
 	product.URL = url
 	product.ImgURL = imgURL
+	product.InStock = true
 	return product
 }
 
@@ -141,32 +174,7 @@ func Sort(logger *logger.Logger, products *[]*Product) (ok bool) {
 		return true
 	}
 
-	sort.SliceStable((*products), func(i, j int) bool {
-		Product_i_PricePerUnit := (*products)[i].PricePerUnit
-		Product_i_DiscountPricePerUnit := (*products)[i].DiscountPricePerUnit
-		Product_j_PricePerUnit := (*products)[j].PricePerUnit
-		Product_j_DiscountPricePerUnit := (*products)[j].DiscountPricePerUnit
-
-		bothHaveDiscount := (Product_i_DiscountPricePerUnit != 0.0 && Product_j_DiscountPricePerUnit != 0.0)
-		firstProductHasDiscount := Product_i_DiscountPricePerUnit != 0.0
-		secondProductHasDiscount := Product_j_DiscountPricePerUnit != 0.0
-
-		if bothHaveDiscount {
-			return Product_i_DiscountPricePerUnit < Product_j_DiscountPricePerUnit
-		}
-		if firstProductHasDiscount {
-			return Product_i_DiscountPricePerUnit < Product_j_PricePerUnit
-		}
-		if secondProductHasDiscount {
-			return Product_i_PricePerUnit < Product_j_DiscountPricePerUnit
-		}
-
-		if Product_i_PricePerUnit == Product_j_PricePerUnit {
-			return false
-		}
-		
-		return Product_i_PricePerUnit < Product_j_PricePerUnit
-	})
+	SortBy(products, ByUnitPrice)
 
 	for i, product := range *products {
 		if product.DiscountPricePerUnit != 0.0 {
@@ -0,0 +1,94 @@
+package product
+
+import (
+	"github.com/jakubruminski/FYP/go/utils/unit"
+)
+
+
+// Section holds the products whose unit prices can be compared with each other.
+type Section struct {
+	Dimension unit.Dimension `json:"dimension"`            // "" for products without a known unit
+	UnitType  string         `json:"unit_type"`
+	Label     string         `json:"label"`                // e.g. "per kg"
+	Results   []*Product     `json:"results"`
+}
+
+var sectionLabels = map[unit.Dimension]string{
+	unit.Mass:   "per kg",
+	unit.Volume: "per litre",
+	unit.Count:  "per item",
+	unit.Length: "per metre",
+	unit.Area:   "per m²",
+	unit.Washes: "per wash",
+	unit.Sheets: "per sheet",
+}
+
+
+// Sections splits products by the dimension of their unit price, keeping their order
+// within each section. Sections follow unit.Dimensions, products without a known unit come last.
+func Sections(products *[]*Product) (sections []*Section) {
+	byDimension := map[unit.Dimension]*Section{}
+	other := &Section{Label: "other"}
+
+	for _, p := range *products {
+		dimension, ok := unit.DimensionOf(p.UnitType)
+		if !ok {
+			other.Results = append(other.Results, p)
+			continue
+		}
+
+		section, exists := byDimension[dimension]
+		if !exists {
+			section = &Section{Dimension: dimension, UnitType: unit.Canonical(dimension).Name, Label: sectionLabels[dimension]}
+			byDimension[dimension] = section
+		}
+		section.Results = append(section.Results, p)
+	}
+
+	for _, dimension := range unit.Dimensions {
+		if section, exists := byDimension[dimension]; exists {
+			sections = append(sections, section)
+		}
+	}
+	if len(other.Results) > 0 {
+		sections = append(sections, other)
+	}
+
+	return sections
+}
+
+
+// ConvertUnits reprices products per the canonical unit of another dimension when the
+// pack size in the name is in that dimension, e.g. "Flour 1.5kg" priced each becomes per kg.
+// The original unit type is kept in ConvertedFrom. Products already in that dimension,
+// or without a usable pack size, are left as they are.
+func ConvertUnits(products *[]*Product, to unit.Dimension) (converted int) {
+	for _, p := range *products {
+		dimension, _ := unit.DimensionOf(p.UnitType)
+		if dimension == to {
+			continue
+		}
+
+		pack, ok := unit.ParsePackSize(p.Name)
+		if !ok || pack.Unit.Dimension != to {
+			continue
+		}
+
+		pricePerUnit, ok := unit.PricePerCanonical(p.Price, pack)
+		if !ok {
+			continue
+		}
+		discountPricePerUnit := 0.0
+		if p.DiscountPrice != 0.0 {
+			discountPricePerUnit, _ = unit.PricePerCanonical(p.DiscountPrice, pack)
+		}
+
+		p.ConvertedFrom = p.UnitType
+		p.UnitType = unit.Canonical(to).Name
+		p.PricePerUnit = pricePerUnit
+		p.DiscountPricePerUnit = discountPricePerUnit
+		converted++
+	}
+
+	return converted
+}
@@ -0,0 +1,67 @@
+package product
+
+import (
+	"math"
+	"testing"
+
+	"github.com/jakubruminski/FYP/go/utils/unit"
+)
+
+func TestSections(t *testing.T) {
+	products := []*Product{
+		{ID: 1, Name: "Free Range Eggs 6 Pack", Price: 1.80, PricePerUnit: 0.30, UnitType: "each"},
+		{ID: 2, Name: "Odlums Plain Flour 2kg", Price: 4.00, PricePerUnit: 2.00, UnitType: "kilogram"},
+		{ID: 3, Name: "Avonmore Milk 2L",       Price: 2.40, PricePerUnit: 1.20, UnitType: "litre"},
+		{ID: 4, Name: "Tesco Plain Flour 1kg",  Price: 1.10, PricePerUnit: 1.10, UnitType: "kilogram"},
+		{ID: 5, Name: "Gift Card",              Price: 10.0},
+	}
+
+	SortBy(&products, ByUnitPrice)
+
+	// Eggs at €0.30 each must not sort ahead of flour at €1.10 per kg
+	expected := []int64{4, 2, 3, 1, 5}
+	for i, p := range products {
+		if p.ID != expected[i] {
+			t.Fatalf("Expected order %v, but got product %d at %d", expected, p.ID, i)
+		}
+	}
+
+	sections := Sections(&products)
+	labels := []string{"per kg", "per litre", "per item", "other"}
+	if len(sections) != len(labels) {
+		t.Fatalf("Expected %d sections, but got %d", len(labels), len(sections))
+	}
+	for i, section := range sections {
+		if section.Label != labels[i] {
+			t.Errorf("Expected section %d to be '%s', but got '%s'", i, labels[i], section.Label)
+		}
+	}
+	if len(sections[0].Results) != 2 || sections[0].UnitType != "kilogram" {
+		t.Errorf("Expected both flours per kilogram in the first section")
+	}
+}
+
+func TestConvertUnits(t *testing.T) {
+	products := []*Product{
+		{ID: 1, Name: "Odlums Plain Flour 1.5kg", Price: 3.00, DiscountPrice: 2.40, PricePerUnit: 3.00, DiscountPricePerUnit: 2.40, UnitType: "each"},
+		{ID: 2, Name: "Free Range Eggs 6 Pack",   Price: 1.80, PricePerUnit: 0.30, UnitType: "each"},
+		{ID: 3, Name: "Tesco Plain Flour 1kg",    Price: 1.10, PricePerUnit: 1.10, UnitType: "kilogram"},
+	}
+
+	converted := ConvertUnits(&products, unit.Mass)
+	if converted != 1 {
+		t.Fatalf("Expected 1 product to be converted, but got %d", converted)
+	}
+
+	flour := products[0]
+	if flour.UnitType != "kilogram" || flour.ConvertedFrom != "each" {
+		t.Errorf("Expected flour to be priced per kilogram, converted from each, but got %s from '%s'", flour.UnitType, flour.ConvertedFrom)
+	}
+	if math.Abs(flour.PricePerUnit-2.0) > 1e-9 || math.Abs(flour.DiscountPricePerUnit-1.6) > 1e-9 {
+		t.Errorf("Expected €2.00 and €1.60 per kilogram, but got %f and %f", flour.PricePerUnit, flour.DiscountPricePerUnit)
+	}
+
+	if products[1].UnitType != "each" || products[2].ConvertedFrom != "" {
+		t.Errorf("Expected eggs and the flour already per kilogram to be left alone")
+	}
+}
@@ -0,0 +1,240 @@
+package product
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/jakubruminski/FYP/go/utils/unit"
+)
+
+
+// Comparator returns a negative number when a sorts before b, a positive one when after,
+// and 0 when they are equal for this comparison.
+type Comparator func(a, b *Product) int
+
+const (
+	SORT_UNIT_PRICE     = "unit_price"
+	SORT_CHEAPEST       = "cheapest"     // same as unit_price
+	SORT_BEST_MATCH     = "best_match"
+	SORT_PRICE          = "price"
+	SORT_DISCOUNT_DEPTH = "discount_depth"
+	SORT_SAVING         = "saving"
+	SORT_NAME           = "name"
+	SORT_SELLER         = "seller"
+
+	ORDER_ASC  = "asc"
+	ORDER_DESC = "desc"
+)
+
+// sortModes maps the sort query parameter to its comparator and the order used when none is given.
+var sortModes = map[string]struct {
+	comparator   Comparator
+	defaultOrder string
+}{
+	SORT_UNIT_PRICE:     {ByUnitPrice, ORDER_ASC},
+	SORT_CHEAPEST:       {ByUnitPrice, ORDER_ASC},
+	SORT_BEST_MATCH:     {ByScore, ORDER_DESC},
+	SORT_PRICE:          {ByPrice, ORDER_ASC},
+	SORT_DISCOUNT_DEPTH: {ByDiscountDepth, ORDER_DESC},
+	SORT_SAVING:         {BySaving, ORDER_DESC},
+	SORT_NAME:           {ByName, ORDER_ASC},
+	SORT_SELLER:         {BySeller, ORDER_ASC},
+}
+
+
+// Sorting builds the comparator for the sort and order query parameters.
+// An empty sort is unit_price, an empty order is the default for the mode.
+// Ties are always broken by unit price, name, seller and finally ID, so no two stored
+// products compare equal and the order is the same every time.
+func Sorting(mode, order string) (comparator Comparator, ok bool) {
+	mode, order, ok = normaliseSorting(mode, order)
+	if !ok {
+		return nil, false
+	}
+
+	comparator = sortModes[mode].comparator
+	if order == ORDER_DESC {
+		comparator = Reverse(comparator)
+	}
+
+	return Then(comparator, ByUnitPrice, ByName, BySeller, ByID), true
+}
+
+// SortingName is the sort and order with defaults filled in, e.g. "unit_price asc".
+func SortingName(mode, order string) string {
+	mode, order, _ = normaliseSorting(mode, order)
+	return mode + " " + order
+}
+
+func normaliseSorting(mode, order string) (normalisedMode, normalisedOrder string, ok bool) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	order = strings.ToLower(strings.TrimSpace(order))
+
+	if mode == "" || mode == SORT_CHEAPEST {
+		mode = SORT_UNIT_PRICE
+	}
+	m, ok := sortModes[mode]
+	if !ok {
+		return mode, order, false
+	}
+
+	if order == "" {
+		order = m.defaultOrder
+	}
+	if order != ORDER_ASC && order != ORDER_DESC {
+		return mode, order, false
+	}
+
+	return mode, order, true
+}
+
+
+// SortBy sorts products in place. Products that compare equal keep their order.
+func SortBy(products *[]*Product, comparator Comparator) {
+	sort.SliceStable(*products, func(i, j int) bool {
+		return comparator((*products)[i], (*products)[j]) < 0
+	})
+}
+
+
+// Then compares by each comparator in turn until one of them tells the products apart.
+func Then(comparators ...Comparator) Comparator {
+	return func(a, b *Product) int {
+		for _, c := range comparators {
+			if result := c(a, b); result != 0 {
+				return result
+			}
+		}
+		return 0
+	}
+}
+
+func Reverse(comparator Comparator) Comparator {
+	return func(a, b *Product) int {
+		return comparator(b, a)
+	}
+}
+
+// RelevantFirst puts products at or above the relevance threshold before the rest,
+// whatever they are sorted by after that.
+func RelevantFirst(threshold float64) Comparator {
+	return func(a, b *Product) int {
+		aRelevant, bRelevant := a.Relevance >= threshold, b.Relevance >= threshold
+		switch {
+		case aRelevant && !bRelevant:
+			return -1
+		case bRelevant && !aRelevant:
+			return 1
+		}
+		return 0
+	}
+}
+
+
+// ByUnitPrice compares the discounted price per unit when there is one, otherwise the regular one.
+// Only products priced in the same dimension are compared by price, so €0.30 each never sorts
+// against €2 per kg. Across dimensions, products are grouped like ByDimension.
+func ByUnitPrice(a, b *Product) int {
+	if result := ByDimension(a, b); result != 0 {
+		return result
+	}
+	return compareFloats(a.EffectivePricePerUnit(), b.EffectivePricePerUnit())
+}
+
+// ByDimension groups products by what their unit price is per, in unit.Dimensions order.
+// Unknown unit types come last.
+func ByDimension(a, b *Product) int {
+	return dimensionRank(a.UnitType) - dimensionRank(b.UnitType)
+}
+
+// ByPrice compares the shelf price, discounted when there is a discount.
+func ByPrice(a, b *Product) int {
+	return compareFloats(a.EffectivePrice(), b.EffectivePrice())
+}
+
+// ByDiscountDepth compares how much of the regular price the discount takes off.
+func ByDiscountDepth(a, b *Product) int {
+	return compareFloats(a.DiscountDepth(), b.DiscountDepth())
+}
+
+// BySaving compares how much the discount takes off, in money.
+func BySaving(a, b *Product) int {
+	return compareFloats(a.Saving(), b.Saving())
+}
+
+// ByScore compares relevance blended with unit price, see the relevance package.
+func ByScore(a, b *Product) int {
+	return compareFloats(a.Score, b.Score)
+}
+
+func ByName(a, b *Product) int {
+	return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+}
+
+func BySeller(a, b *Product) int {
+	return strings.Compare(strings.ToLower(a.Seller), strings.ToLower(b.Seller))
+}
+
+func ByID(a, b *Product) int {
+	switch {
+	case a.ID < b.ID:
+		return -1
+	case a.ID > b.ID:
+		return 1
+	}
+	return 0
+}
+
+
+func (p *Product) EffectivePrice() float64 {
+	if p.DiscountPrice != 0.0 {
+		return p.DiscountPrice
+	}
+	return p.Price
+}
+
+func (p *Product) EffectivePricePerUnit() float64 {
+	if p.DiscountPricePerUnit != 0.0 {
+		return p.DiscountPricePerUnit
+	}
+	return p.PricePerUnit
+}
+
+// DiscountDepth is the fraction of the regular price saved, e.g. 0.25 for €3 down to €2.25.
+func (p *Product) DiscountDepth() float64 {
+	if p.DiscountPrice == 0.0 || p.Price <= 0.0 || p.DiscountPrice >= p.Price {
+		return 0.0
+	}
+	return (p.Price - p.DiscountPrice) / p.Price
+}
+
+// Saving is the regular price less the discounted one, e.g. 0.75 for €3 down to €2.25.
+func (p *Product) Saving() float64 {
+	if p.DiscountDepth() == 0.0 {
+		return 0.0
+	}
+	return p.Price - p.DiscountPrice
+}
+
+
+func dimensionRank(unitType string) int {
+	dimension, ok := unit.DimensionOf(unitType)
+	if ok {
+		for i, d := range unit.Dimensions {
+			if d == dimension {
+				return i
+			}
+		}
+	}
+	return len(unit.Dimensions)
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
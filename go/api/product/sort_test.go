@@ -0,0 +1,54 @@
+package product
+
+import (
+	"testing"
+)
+
+func TestSorting(t *testing.T) {
+	products := []*Product{
+		{ID: 1, Seller: "Tesco",     Name: "Milk 2L",    Price: 2.50, PricePerUnit: 1.25},
+		{ID: 2, Seller: "Dunnes",    Name: "milk 1L",    Price: 1.50, PricePerUnit: 1.50, DiscountPrice: 1.00, DiscountPricePerUnit: 1.00},
+		{ID: 3, Seller: "SuperValu", Name: "Milk 3L",    Price: 3.30, PricePerUnit: 1.10},
+		{ID: 4, Seller: "Tesco",     Name: "Butter",     Price: 4.00, PricePerUnit: 8.00, DiscountPrice: 3.00, DiscountPricePerUnit: 6.00},
+	}
+
+	testCases := []struct {
+		sort        string
+		order       string
+		expectedIDs []int64
+		expectedOk  bool
+	}{
+		{"",               "",     []int64{2, 3, 1, 4}, true},
+		{"unit_price",     "desc", []int64{4, 1, 3, 2}, true},
+		{"price",          "",     []int64{2, 1, 4, 3}, true},
+		{"discount_depth", "",     []int64{2, 4, 3, 1}, true},
+		{"saving",         "",     []int64{4, 2, 3, 1}, true},
+		{"name",           "asc",  []int64{4, 2, 1, 3}, true},
+		{"SELLER",         "",     []int64{2, 3, 1, 4}, true},
+
+		// These should fail
+		{"popularity",     "",     nil, false},
+		{"price",          "up",   nil, false},
+	}
+
+	for _, tc := range testCases {
+		comparator, ok := Sorting(tc.sort, tc.order)
+		if ok != tc.expectedOk {
+			t.Errorf("Expected ok to be %v, but got %v for sort '%s' order '%s'", tc.expectedOk, ok, tc.sort, tc.order)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		sorted := append([]*Product{}, products...)
+		SortBy(&sorted, comparator)
+
+		for i, p := range sorted {
+			if p.ID != tc.expectedIDs[i] {
+				t.Errorf("Expected %v, but got product %d at %d for sort '%s' order '%s'", tc.expectedIDs, p.ID, i, tc.sort, tc.order)
+				break
+			}
+		}
+	}
+}
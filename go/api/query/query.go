@@ -1,35 +1,116 @@
 package query
 
 import (
-	"database/sql"
+	"context"
+	"os"
 	"time"
 
+	"github.com/jakubruminski/FYP/go/api/fuzzy"
+	"github.com/jakubruminski/FYP/go/api/history"
+	"github.com/jakubruminski/FYP/go/migrations"
 	"github.com/jakubruminski/FYP/go/api/product"
 	"github.com/jakubruminski/FYP/go/api/query/query_clients"
+	"github.com/jakubruminski/FYP/go/api/query/query_observations"
 	"github.com/jakubruminski/FYP/go/api/query/query_products"
 	"github.com/jakubruminski/FYP/go/api/query/query_searchs"
+	"github.com/jakubruminski/FYP/go/api/query/query_watches"
+	"github.com/jakubruminski/FYP/go/api/suggest"
+	"github.com/jakubruminski/FYP/go/api/watch"
 	"github.com/jakubruminski/FYP/go/utils/env"
 	"github.com/jakubruminski/FYP/go/utils/logger"
+	"github.com/jakubruminski/FYP/go/utils/postgres"
+	"github.com/jakubruminski/FYP/go/utils/postgres/migrate"
 )
 
+// INITIALISE_DATABASE applies the migrations in go/migrations through the pool postgres.Open
+// created. Every instance does this on startup, the migration lock lets one migrate while the
+// others wait.
+//
+// With MIGRATE_ON_STARTUP=false pending migrations are only warned about, and "migrate up" has
+// to be run before the new build is deployed.
 func INITIALISE_DATABASE(logger *logger.Logger) (ok bool) {
-    if !query_products.INIT(logger) {
-        logger.ERROR("Failed to initialize products")
+    all, err := migrate.Load(migrations.Files)
+    if err != nil {
+        logger.ERROR("Failed to load migrations. Reason: %s", err)
         return false
     }
-    if !query_clients.INIT(logger) {
-        logger.ERROR("Failed to initialize clients")
+
+    db := postgres.DB()
+    if db == nil {
+        logger.ERROR("The database pool isn't open")
         return false
     }
-    if !query_searchs.INIT(logger) {
-        logger.ERROR("Failed to initialize searches")
+
+    if !env.GetBoolDefault(logger, "MIGRATE_ON_STARTUP", true) {
+        statusList, ok := migrate.GetStatus(logger, db, all)
+        if !ok {
+            logger.ERROR("Failed to get migration status")
+            return false
+        }
+        for _, s := range statusList {
+            if !s.Applied {
+                logger.WARN("Migration %d %s is pending, run migrate up", s.Version, s.Name)
+            }
+        }
+        return true
+    }
+
+    _, ok = migrate.Up(logger, db, all, 0)
+    if !ok {
+        logger.ERROR("Failed to migrate the database")
         return false
     }
 
+    return classifyProducts(logger)
+}
+
+// classifyProducts sets the brand and category of the products stored before products were
+// classified, in batches of CLASSIFY_BATCH_SIZE. Once they all are it is a single query that
+// finds none.
+func classifyProducts(logger *logger.Logger) (ok bool) {
+    batchSize := env.GetIntDefault(logger, "CLASSIFY_BATCH_SIZE", 500)
+
+    total := 0
+    for {
+        classified, ok := postgres.InTransaction(logger, context.Background(), nil, func(tx *postgres.Tx) (int, bool) {
+            return query_products.Classify(logger, tx, batchSize)
+        })
+        if !ok {
+            logger.ERROR("Failed to classify stored products")
+            return false
+        }
+
+        total += classified
+        if classified < batchSize {
+            break
+        }
+    }
+
+    if total > 0 {
+        logger.INFO("Classified %d stored products", total)
+    }
     return true
 }
 
-func Products(logger *logger.Logger, tx *sql.Tx, products *[]*product.Product, searchTerm string) (found, expired, ok bool) {
+// Migrate runs the migrate command line, args being what follows "migrate".
+func Migrate(logger *logger.Logger, args []string) (ok bool) {
+    all, err := migrate.Load(migrations.Files)
+    if err != nil {
+        logger.ERROR("Failed to load migrations. Reason: %s", err)
+        return false
+    }
+
+    ok = postgres.Open(logger, 1)
+    if !ok {
+        logger.ERROR("Failed to connect to the database")
+        return false
+    }
+    defer postgres.Close()
+
+    return migrate.Command(logger, postgres.DB(), all, args, os.Stdout)
+}
+
+func Products(logger *logger.Logger, tx *postgres.Tx, products *[]*product.Product, searchTerm string, filter *product.Filter) (found, expired, ok bool) {
 
     ProductIDs, ok := query_searchs.GetIDs(logger, tx, searchTerm)
     if !ok {
@@ -38,10 +119,11 @@ func Products(logger *logger.Logger, tx *sql.Tx, products *[]*product.Product, s
     }
     if len(*ProductIDs) == 0 {
         logger.DEBUG_WARN("No products found")
-        return false, false, true
+        found, ok = fuzzyProducts(logger, tx, products, searchTerm, filter)
+        return found, false, ok
     }
 
-    ok = query_products.Get(logger, tx, products, ProductIDs)
+    ok = query_products.GetFiltered(logger, tx, products, ProductIDs, filter)
     if !ok {
         logger.ERROR("Failed to get products")
         return false, false, false
@@ -68,17 +150,165 @@ func Products(logger *logger.Logger, tx *sql.Tx, products *[]*product.Product, s
 
 }
 
-func AddProducts(logger *logger.Logger, tx *sql.Tx, query string, oldProducts, productsToAdd *[]*product.Product) (ok bool) {
+// CachedProducts returns every product stored for a search term, unfiltered.
+func CachedProducts(logger *logger.Logger, tx *postgres.Tx, products *[]*product.Product, searchTerm string) (ok bool) {
+
+    productIDs, ok := query_searchs.GetIDs(logger, tx, searchTerm)
+    if !ok {
+        logger.ERROR("Failed to get product IDs")
+        return false
+    }
+    if len(*productIDs) == 0 {
+        return true
+    }
+
+    if !query_products.Get(logger, tx, products, productIDs) {
+        logger.ERROR("Failed to get products")
+        return false
+    }
+
+    return true
+}
+
+// fuzzyProducts serves a search term that was never searched for from stored products with close
+// names, when there are enough confident matches across sellers. Otherwise found is false and the
+// sellers are scraped.
+func fuzzyProducts(logger *logger.Logger, tx *postgres.Tx, products *[]*product.Product, searchTerm string, filter *product.Filter) (found, ok bool) {
+
+    if !fuzzy.Enabled(logger) {
+        return false, true
+    }
+    text, ok := fuzzy.Text(searchTerm)
+    if !ok {
+        return false, true
+    }
+
+    expiry_offset, ok := env.GetInt(logger, "SEARCH_EXPIRY_IN_DAYS")
+    if !ok { return false, false }
+
+    options := fuzzy.DefaultOptions(logger)
+    since := time.Now().Unix() - int64(expiry_offset * 24 * 60 * 60)
+
+    matches := &[]*fuzzy.Match{}
+    if !query_products.Search(logger, tx, text, since, options.Limit, matches) {
+        logger.ERROR("Failed to search products")
+        return false, false
+    }
+
+    productIDs, confident := fuzzy.Confident(*matches, options)
+    if !confident {
+        logger.DEBUG_WARN("%d products close to '%s', not enough to skip scraping", len(*matches), text)
+        return false, true
+    }
+
+    ids := &[]*int64{}
+    for i := range productIDs {
+        *ids = append(*ids, &productIDs[i])
+    }
+    if !query_products.GetFiltered(logger, tx, products, ids, filter) {
+        logger.ERROR("Failed to get products")
+        return false, false
+    }
+
+    logger.INFO("Serving '%s' from %d stored products with close names", text, len(productIDs))
+    return true, true
+}
+
+// AddProducts stores a scrape. Stored products are refreshed with it, and ones the search found
+// before, in oldProducts, that their seller no longer lists are marked missing.
+func AddProducts(logger *logger.Logger, tx *postgres.Tx, oldProducts, productsToAdd *[]*product.Product) (ok bool) {
 
     if !query_products.Add(logger, tx, oldProducts, productsToAdd) {
         logger.ERROR("Failed to add products")
         return false
     }
 
+    missing := product.Missing(*oldProducts, *productsToAdd)
+    missingIDs := []int64{}
+    for _, p := range missing {
+        missingIDs = append(missingIDs, p.ID)
+    }
+    if !query_products.MarkMissing(logger, tx, missingIDs, time.Now().Unix()) {
+        logger.ERROR("Failed to mark missing products")
+        return false
+    }
+    if len(missing) > 0 {
+        logger.INFO("%d products found before are no longer listed", len(missing))
+    }
+
+    // Every scrape is recorded, including products that were already stored
+    if !query_observations.Add(logger, tx, productsToAdd) {
+        logger.ERROR("Failed to record prices")
+        return false
+    }
+
 	return true
 }
 
-func AddSearchTerm(logger *logger.Logger, tx *sql.Tx, searchTerm string, products *[]*product.Product) (ok bool) {
+func PriceHistory(logger *logger.Logger, tx *postgres.Tx, productID, since int64, observations *[]*history.Observation) (ok bool) {
+
+    if !query_observations.Get(logger, tx, productID, since, observations) {
+        logger.ERROR("Failed to get price history of product %d", productID)
+        return false
+    }
+
+    return true
+}
+
+// Deals returns the discounted products found by searches since the given time, with when each
+// was last fetched.
+func Deals(logger *logger.Logger, tx *postgres.Tx, since int64, products *[]*product.Product, lastFetched map[int64]int64) (ok bool) {
+
+    if !query_searchs.GetRecent(logger, tx, since, lastFetched) {
+        logger.ERROR("Failed to get recent searches")
+        return false
+    }
+    if len(lastFetched) == 0 {
+        return true
+    }
+
+    productIDs := &[]*int64{}
+    for productID := range lastFetched {
+        productID := productID
+        *productIDs = append(*productIDs, &productID)
+    }
+
+    if !query_products.GetFiltered(logger, tx, products, productIDs, &product.Filter{DiscountedOnly: true}) {
+        logger.ERROR("Failed to get discounted products")
+        return false
+    }
+
+    return true
+}
+
+// SuggestionEntries returns what autocomplete suggests: up to limit popular searches, each fetch
+// worth searchWeight, and up to limit product names, each seller stocking one worth 1.
+func SuggestionEntries(logger *logger.Logger, tx *postgres.Tx, limit int, searchWeight float64, entries *[]*suggest.Entry) (ok bool) {
+
+    searches := map[string]int{}
+    if !query_searchs.GetPopular(logger, tx, limit, searches) {
+        logger.ERROR("Failed to get popular searches")
+        return false
+    }
+    for searchTerm, count := range searches {
+        if text := suggest.SearchText(searchTerm); text != "" {
+            *entries = append(*entries, &suggest.Entry{Text: text, Kind: suggest.KIND_SEARCH, Weight: float64(count) * searchWeight})
+        }
+    }
+
+    names := map[string]int{}
+    if !query_products.GetNames(logger, tx, limit, names) {
+        logger.ERROR("Failed to get product names")
+        return false
+    }
+    for name, count := range names {
+        *entries = append(*entries, &suggest.Entry{Text: name, Kind: suggest.KIND_PRODUCT, Weight: float64(count)})
+    }
+
+    return true
+}
+
+func AddSearchTerm(logger *logger.Logger, tx *postgres.Tx, searchTerm string, products *[]*product.Product) (ok bool) {
     
     if !query_searchs.Add(logger, tx, searchTerm, products) {
         logger.ERROR("Failed to add search term")
@@ -88,7 +318,26 @@ func AddSearchTerm(logger *logger.Logger, tx *sql.Tx, searchTerm string, product
     return true
 }
 
-func AddToBaskets(logger *logger.Logger, tx *sql.Tx, clientID string, product product.Product) (ok bool) {
+// CollectGarbage removes searches that expired before expiredBefore, then the products nothing
+// refers to any more that weren't seen since unseenSince.
+func CollectGarbage(logger *logger.Logger, tx *postgres.Tx, expiredBefore, unseenSince int64) (searches, products int64, ok bool) {
+
+    searches, ok = query_searchs.RemoveExpired(logger, tx, expiredBefore)
+    if !ok {
+        logger.ERROR("Failed to remove expired searches")
+        return 0, 0, false
+    }
+
+    products, ok = query_products.RemoveOrphans(logger, tx, unseenSince)
+    if !ok {
+        logger.ERROR("Failed to remove orphaned products")
+        return 0, 0, false
+    }
+
+    return searches, products, true
+}
+
+func AddToBaskets(logger *logger.Logger, tx *postgres.Tx, clientID string, product product.Product) (ok bool) {
 
     if !query_clients.Add(logger, tx, clientID, product.ID) {
         logger.ERROR("Failed to add product to basket")
@@ -98,7 +347,7 @@ func AddToBaskets(logger *logger.Logger, tx *sql.Tx, clientID string, product pr
     return true
 }
 
-func Baskets(logger *logger.Logger, tx *sql.Tx, clientID string, products *[]*product.Product) (ok bool) {
+func Baskets(logger *logger.Logger, tx *postgres.Tx, clientID string, products *[]*product.Product) (ok bool) {
 
 	if !query_clients.GetByID(logger, tx, clientID, products) {
         logger.ERROR("Failed to get products from basket")
@@ -108,7 +357,7 @@ func Baskets(logger *logger.Logger, tx *sql.Tx, clientID string, products *[]*pr
     return true
 }
 
-func RemoveFromBasket(logger *logger.Logger, tx *sql.Tx, clientID string, product product.Product) (ok bool) {
+func RemoveFromBasket(logger *logger.Logger, tx *postgres.Tx, clientID string, product product.Product) (ok bool) {
     
     if !query_clients.Remove(logger, tx, clientID, product.ID) {
         logger.ERROR("Failed to remove product from basket")
@@ -117,3 +366,109 @@ func RemoveFromBasket(logger *logger.Logger, tx *sql.Tx, clientID string, produc
 
     return true
 }
+
+
+// CheckWatches queues a notification for every watch that a refresh of searchTerm brought under its target.
+func CheckWatches(logger *logger.Logger, tx *postgres.Tx, searchTerm string, products *[]*product.Product) (ok bool) {
+
+    productIDs := []int64{}
+    for _, p := range *products {
+        productIDs = append(productIDs, p.ID)
+    }
+
+    watches := &[]*watch.Watch{}
+    if !query_watches.GetMatching(logger, tx, searchTerm, productIDs, watches) {
+        logger.ERROR("Failed to get watches")
+        return false
+    }
+
+    now := time.Now().Unix()
+    for _, w := range *watches {
+        notification, changed := w.Check(searchTerm, products, now)
+        if !changed {
+            continue
+        }
+
+        if !query_watches.SetLastNotifiedPrice(logger, tx, w) {
+            return false
+        }
+        if notification == nil {
+            continue
+        }
+
+        if !query_watches.AddNotification(logger, tx, notification) {
+            return false
+        }
+        logger.INFO("Watch %d: %s is %f per %s", w.ID, notification.ProductName, notification.UnitPrice, notification.UnitType)
+    }
+
+    return true
+}
+
+func AddWatch(logger *logger.Logger, tx *postgres.Tx, w *watch.Watch) (ok bool) {
+
+    if !query_watches.Add(logger, tx, w) {
+        logger.ERROR("Failed to add watch")
+        return false
+    }
+
+    return true
+}
+
+func Watches(logger *logger.Logger, tx *postgres.Tx, clientID string, watches *[]*watch.Watch) (ok bool) {
+
+    if !query_watches.GetByClient(logger, tx, clientID, watches) {
+        logger.ERROR("Failed to get watches")
+        return false
+    }
+
+    return true
+}
+
+func RemoveWatch(logger *logger.Logger, tx *postgres.Tx, clientID string, watchID int64) (ok bool) {
+
+    if !query_watches.Remove(logger, tx, clientID, watchID) {
+        logger.ERROR("Failed to remove watch")
+        return false
+    }
+
+    return true
+}
+
+func Inbox(logger *logger.Logger, tx *postgres.Tx, clientID string, limit int, markRead bool, notifications *[]*watch.Notification) (ok bool) {
+
+    if !query_watches.Inbox(logger, tx, clientID, limit, notifications) {
+        logger.ERROR("Failed to get inbox")
+        return false
+    }
+
+    if markRead && !query_watches.MarkRead(logger, tx, clientID) {
+        logger.ERROR("Failed to mark inbox as read")
+        return false
+    }
+
+    return true
+}
+
+// ClaimNotifications takes up to limit queued notifications to send, see query_watches.Claim.
+func ClaimNotifications(logger *logger.Logger, tx *postgres.Tx, limit int, notifications *[]*watch.Notification) (ok bool) {
+
+    if !query_watches.Claim(logger, tx, limit, time.Now().Unix(), notifications) {
+        logger.ERROR("Failed to claim undelivered notifications")
+        return false
+    }
+
+    return true
+}
+
+// SetDelivered records which of the claimed notifications were sent.
+func SetDelivered(logger *logger.Logger, tx *postgres.Tx, notifications []*watch.Notification, delivered map[int64]bool) (ok bool) {
+
+    for _, n := range notifications {
+        if !query_watches.SetDelivered(logger, tx, n.ID, delivered[n.ID]) {
+            return false
+        }
+    }
+
+    return true
+}
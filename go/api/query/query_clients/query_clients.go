@@ -1,8 +1,6 @@
 package query_clients
 
 import (
-	"context"
-	"database/sql"
 	"time"
 
 	"github.com/jakubruminski/FYP/go/api/product"
@@ -20,40 +18,20 @@ type Client struct {
 	ProductExists bool `json:"product_exists"` // This is a flag allowing to check if the product exists
 }
 
-func INIT(logger *logger.Logger) (ok bool) {
-
-	query := `
-		CREATE TABLE IF NOT EXISTS clients
-		(
-			id SERIAL PRIMARY KEY,
-			client_id  VARCHAR(255),
-			last_fetch INT,
-			product_id INT,
-			product_exists BOOLEAN
-		)
-	`
-
-	ok = postgres.ExecuteCreateTableQuery(logger, tableName, query)
-	if !ok {
-		logger.ERROR("Couldn't create the clients table")
-		return false
-	}
-
-	return true
-}
-
-
-func Add(logger *logger.Logger, tx *sql.Tx, clientID string, productID int64) (ok bool) {
+func Add(logger *logger.Logger, tx *postgres.Tx, clientID string, productID int64) (ok bool) {
 
 	lastFetched := time.Now().Unix()
 	productExists := true
 
+	// Adding a product already in the basket only updates when it was added
 	query := `
 		INSERT INTO clients (client_id, last_fetch, product_id, product_exists)
 		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (client_id, product_id) DO UPDATE
+		SET last_fetch = EXCLUDED.last_fetch, product_exists = EXCLUDED.product_exists
 	`
 
-	ok = postgres.ExecuteContextChangeQuery(logger, tx, add, query, clientID, lastFetched, productID, productExists)
+	_, ok = postgres.Exec(logger, tx, query, clientID, lastFetched, productID, productExists)
 	if !ok {
 		logger.ERROR("Failed to add client")
 		return false
@@ -62,49 +40,14 @@ func Add(logger *logger.Logger, tx *sql.Tx, clientID string, productID int64) (o
 	return true
 }
 
-func add(logger *logger.Logger, tx *sql.Tx, ctx context.Context, query string, args ...interface{}) (ok bool) {
-
-	clientID, ok := args[0].(string)
-	if !ok {
-		logger.ERROR("Failed to get client ID")
-		return false
-	}
-
-	lastFetched, ok := args[1].(int64)
-	if !ok {
-		logger.ERROR("Failed to get last fetched")
-		return false
-	}
-
-	productID, ok := args[2].(int64)
-	if !ok {
-		logger.ERROR("Failed to get product ID")
-		return false
-	}
-
-	productExists, ok := args[3].(bool)
-	if !ok {
-		logger.ERROR("Failed to get product exists")
-		return false
-	}
-
-	_, err := tx.ExecContext(ctx, query, clientID, lastFetched, productID, productExists)
-	if err != nil {
-		logger.ERROR("Failed to add client: %s", err)
-		return false
-	}
-
-	return true
-}
-
-func Remove(logger *logger.Logger, tx *sql.Tx, clientID string, productID int64) (ok bool) {
+func Remove(logger *logger.Logger, tx *postgres.Tx, clientID string, productID int64) (ok bool) {
 	
 	query := `
 		DELETE FROM clients
 		WHERE client_id = $1 AND product_id = $2
 	`
 
-	ok = postgres.ExecuteContextChangeQuery(logger, tx, remove, query, clientID, productID)
+	_, ok = postgres.Exec(logger, tx, query, clientID, productID)
 	if !ok {
 		logger.ERROR("Failed to remove client")
 		return false
@@ -114,44 +57,23 @@ func Remove(logger *logger.Logger, tx *sql.Tx, clientID string, productID int64)
 }
 
 
-func remove(logger *logger.Logger, tx *sql.Tx, ctx context.Context, query string, args ...interface{}) (ok bool) {
-
-	clientID, ok := args[0].(string)
-	if !ok {
-		logger.ERROR("Failed to get client ID")
-		return false
-	}
-
-	productID, ok := args[1].(int64)
-	if !ok {
-		logger.ERROR("Failed to get product ID")
-		return false
-	}
-
-	_, err := tx.ExecContext(ctx, query, clientID, productID)
-	if err != nil {
-		logger.ERROR("Failed to remove client: %s", err)
-		return false
-	}
-
-	return true
-}
-
-
-func GetByID(logger *logger.Logger, tx *sql.Tx, clientID string, products *[]*product.Product) (ok bool) {
+func GetByID(logger *logger.Logger, tx *postgres.Tx, clientID string, products *[]*product.Product) (ok bool) {
 	
 	query := `
 		SELECT product_id FROM clients
 		WHERE client_id = $1
 	`
 
-	productIDs := &[]*int64{}
-	ok = postgres.ExecuteContextLookUpQuery(logger, tx, getByID, query, clientID, productIDs)
+	ids, ok := postgres.Query(logger, tx, postgres.Value[int64], query, clientID)
 	if !ok {
 		logger.ERROR("Failed to get clients")
 		return false
 	}
 
+	productIDs := &[]*int64{}
+	for i := range ids {
+		*productIDs = append(*productIDs, &ids[i])
+	}
 
 	ok = query_products.Get(logger, tx, products, productIDs)
 	if !ok {
@@ -161,37 +83,3 @@ func GetByID(logger *logger.Logger, tx *sql.Tx, clientID string, products *[]*pr
 
 	return true
 }
-
-func getByID(logger *logger.Logger, tx *sql.Tx, ctx context.Context, query string, args ...interface{}) (ok bool) {
-	
-	clientID, ok := args[0].(string)
-	if !ok {
-		logger.ERROR("Failed to get client ID")
-		return false
-	}
-
-	productIDs, ok := args[1].(*[]*int64)
-	if !ok {
-		logger.ERROR("Failed to get products")
-		return false
-	}
-
-	rows, err := tx.QueryContext(ctx, query, clientID)
-	if err != nil {
-		logger.ERROR("Failed to get clients: %s", err)
-		return false
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		productID := new(int64)
-		err := rows.Scan(&productID)
-		if err != nil {
-			logger.ERROR("Failed to scan client: %s", err)
-			return false
-		}
-		*productIDs = append(*productIDs, productID)
-	}
-
-	return true
-}
\ No newline at end of file
@@ -0,0 +1,93 @@
+package query_observations
+
+import (
+	"time"
+
+	"github.com/jakubruminski/FYP/go/api/history"
+	"github.com/jakubruminski/FYP/go/api/product"
+
+	"github.com/jakubruminski/FYP/go/utils/logger"
+	"github.com/jakubruminski/FYP/go/utils/postgres"
+)
+
+var tableName = "price_observations"
+
+// Add records the current price of every product. Products must already have their IDs.
+func Add(logger *logger.Logger, tx *postgres.Tx, products *[]*product.Product) (ok bool) {
+
+	if len(*products) == 0 {
+		return true
+	}
+
+	query := history.ObservationInsertQuery()
+	observedAt := time.Now().Unix()
+
+	for _, p := range *products {
+		if p.ID < 0 {
+			logger.DEBUG_WARN("Product '%s' has no ID, not recording its price", p.Name)
+			continue
+		}
+
+		o := history.NewObservation(p, observedAt)
+		_, ok = postgres.Exec(
+			logger,
+			tx,
+			query,
+			o.ProductID,
+			o.Seller,
+			o.ObservedAt,
+			o.Currency,
+			o.Price,
+			o.PricePerUnit,
+			o.DiscountPrice,
+			o.DiscountPricePerUnit,
+			o.DiscountPriceInWords,
+			o.UnitType,
+		)
+		if !ok {
+			logger.ERROR("Failed to add price observations")
+			return false
+		}
+	}
+
+	logger.DEBUG("Recorded %d price observations", len(*products))
+	return true
+}
+
+
+// Get returns the observations of a product since a unix time, oldest first.
+func Get(logger *logger.Logger, tx *postgres.Tx, productID, since int64, observations *[]*history.Observation) (ok bool) {
+
+	query := `
+	SELECT product_id, seller, observed_at, currency, price, price_per_unit, discount_price, discount_price_per_unit, discount_price_in_words, unit_type
+	FROM price_observations
+	WHERE product_id = $1 AND observed_at >= $2
+	ORDER BY observed_at
+	`
+
+	found, ok := postgres.Query(logger, tx, scan, query, productID, since)
+	if !ok {
+		logger.ERROR("Failed to get price observations")
+		return false
+	}
+
+	*observations = append(*observations, found...)
+	return true
+}
+
+func scan(row postgres.Scanner) (o *history.Observation, err error) {
+	o = &history.Observation{}
+	err = row.Scan(
+		&o.ProductID,
+		&o.Seller,
+		&o.ObservedAt,
+		&o.Currency,
+		&o.Price,
+		&o.PricePerUnit,
+		&o.DiscountPrice,
+		&o.DiscountPricePerUnit,
+		&o.DiscountPriceInWords,
+		&o.UnitType,
+	)
+	return o, err
+}
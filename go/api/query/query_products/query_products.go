@@ -1,9 +1,11 @@
 package query_products
 
 import (
-	"context"
-	"database/sql"
+	"strings"
+	"time"
 
+	"github.com/jakubruminski/FYP/go/api/classify"
+	"github.com/jakubruminski/FYP/go/api/fuzzy"
 	"github.com/jakubruminski/FYP/go/api/product"
 	"github.com/lib/pq"
 
@@ -13,69 +15,104 @@ import (
 
 var tableName = "products"
 
-func INIT(logger *logger.Logger) (ok bool) {
+var selectQuery = `SELECT id, seller, name, currency, price, price_per_unit, discount_price, discount_price_per_unit, discount_price_in_words, unit_type, COALESCE(url, ''), img_url, COALESCE(ean, ''), COALESCE(brand, ''), COALESCE(own_brand, FALSE), COALESCE(category, ''), COALESCE(in_stock, TRUE), COALESCE(last_seen, 0), COALESCE(missing_since, 0) FROM products WHERE id = ANY($1)`
 
-	query := product.ProductCreateQuery()
+func Get(logger *logger.Logger, tx *postgres.Tx, products *[]*product.Product, productIDs *[]*int64) (ok bool) {
 
-	ok = postgres.ExecuteCreateTableQuery(logger, tableName, query)
-	if !ok {
-		logger.ERROR("Couldn't create the products table")
-		return false
-	}
+    ok = get(logger, tx, selectQuery, products, pq.Array(*productIDs))
+    if !ok {
+        logger.ERROR("Failed to get products")
+        return false
+    }
 
 	return true
 }
 
-func Get(logger *logger.Logger, tx *sql.Tx, products *[]*product.Product, productIDs *[]*int64) (ok bool) {
+// GetFiltered is Get with the filter applied by Postgres, so cached searches are never filtered in memory.
+func GetFiltered(logger *logger.Logger, tx *postgres.Tx, products *[]*product.Product, productIDs *[]*int64, filter *product.Filter) (ok bool) {
+
+    query := selectQuery
+    conditions, filterArgs := filter.Where(2)
+    if conditions != "" {
+        query += " AND " + conditions
+    }
 
-    query := `SELECT id, seller, name, currency, price, price_per_unit, discount_price, discount_price_per_unit, discount_price_in_words, unit_type, url, img_url FROM products WHERE id = ANY($1)`
-    ok = postgres.ExecuteContextLookUpQuery(logger, tx, get, query, productIDs, products)
+    ok = get(logger, tx, query, products, append([]interface{}{pq.Array(*productIDs)}, filterArgs...)...)
     if !ok {
-        logger.ERROR("Failed to get products")
+        logger.ERROR("Failed to get filtered products")
         return false
     }
 
 	return true
 }
 
-func get(logger *logger.Logger, tx *sql.Tx, ctx context.Context, query string, args ...interface{}) (ok bool) {
+// Search finds products found by searches since the given time whose name is close to text, by full
+// text search, which handles plurals like "apples" and extra words like "cheddar cheese", or by
+// trigram word similarity, which handles typos like "aspargus".
+func Search(logger *logger.Logger, tx *postgres.Tx, text string, since int64, limit int, matches *[]*fuzzy.Match) (ok bool) {
+
+    query := `
+    SELECT id, seller,
+        CASE WHEN to_tsvector('english', name) @@ plainto_tsquery('english', $1) THEN 1
+             ELSE word_similarity($1, LOWER(name)) END AS confidence
+    FROM products
+    WHERE (to_tsvector('english', name) @@ plainto_tsquery('english', $1) OR $1 <% LOWER(name))
+      AND id IN (SELECT product_id FROM searches WHERE last_fetch >= $2)
+    ORDER BY confidence DESC, id
+    LIMIT $3
+    `
+
+    found, ok := postgres.Query(logger, tx, scanMatch, query, text, since, limit)
+    if !ok {
+        logger.ERROR("Failed to search products for '%s'", text)
+        return false
+    }
+
+    *matches = append(*matches, found...)
+    return true
+}
+
+func scanMatch(row postgres.Scanner) (m *fuzzy.Match, err error) {
+    m = &fuzzy.Match{}
+    err = row.Scan(&m.ProductID, &m.Seller, &m.Confidence)
+    return m, err
+}
+
+// GetNames counts the sellers stocking each of the most common product names.
+func GetNames(logger *logger.Logger, tx *postgres.Tx, limit int, counts map[string]int) (ok bool) {
+
+    query := `SELECT MIN(name), COUNT(*) FROM products GROUP BY LOWER(name) ORDER BY 2 DESC, 1 LIMIT $1`
 
-    productIDs, ok := args[0].(*[]*int64)
+    names, ok := postgres.Query(logger, tx, scanName, query, limit)
     if !ok {
-        logger.ERROR("Failed to get product IDs")
+        logger.ERROR("Failed to get product names")
         return false
     }
 
-    rows, err := tx.QueryContext(ctx, query, pq.Array(*productIDs))
-    if err != nil {
-        logger.ERROR("Failed to get products: %s", err)
+    for _, n := range names {
+        counts[n.name] = n.count
+    }
+    return true
+}
+
+type name struct {
+    name  string
+    count int
+}
+
+func scanName(row postgres.Scanner) (n name, err error) {
+    err = row.Scan(&n.name, &n.count)
+    return n, err
+}
+
+func get(logger *logger.Logger, tx *postgres.Tx, query string, products *[]*product.Product, args ...interface{}) (ok bool) {
+
+    found, ok := postgres.Query(logger, tx, scan, query, args...)
+    if !ok {
         return false
     }
-    defer rows.Close()
-
-    products, ok := args[1].(*[]*product.Product)
-
-    i := 0
-    for rows.Next() {
-        product := &product.Product{}
-        err := rows.Scan(
-            &product.ID,
-            &product.Seller,
-            &product.Name,
-            &product.Currency,
-            &product.Price,
-            &product.PricePerUnit,
-            &product.DiscountPrice,
-            &product.DiscountPricePerUnit,
-            &product.DiscountPriceInWords,
-            &product.UnitType,
-            &product.URL,
-            &product.ImgURL,
-        )
-        if err != nil {
-            logger.ERROR("Failed to scan product: %s", err)
-            return false
-        }
+
+    for i, product := range found {
         *products = append(*products, product)
         
         logger.DEBUG("%d: Product: --------------------------", i)
@@ -91,14 +128,72 @@ func get(logger *logger.Logger, tx *sql.Tx, ctx context.Context, query string, a
         logger.DEBUG("%d: p.UnitType: %s", i, product.UnitType)
         logger.DEBUG("%d: p.URL: %s", i, product.URL)
         logger.DEBUG("%d: p.ImgURL: %s", i, product.ImgURL)
-        i++
+        logger.DEBUG("%d: p.Brand: %s", i, product.Brand)
+        logger.DEBUG("%d: p.Category: %s", i, product.Category)
     }
 
     return true
 }
 
+func scan(row postgres.Scanner) (p *product.Product, err error) {
+    p = &product.Product{}
+    err = row.Scan(
+        &p.ID,
+        &p.Seller,
+        &p.Name,
+        &p.Currency,
+        &p.Price,
+        &p.PricePerUnit,
+        &p.DiscountPrice,
+        &p.DiscountPricePerUnit,
+        &p.DiscountPriceInWords,
+        &p.UnitType,
+        &p.URL,
+        &p.ImgURL,
+        &p.EAN,
+        &p.Brand,
+        &p.OwnBrand,
+        &p.Category,
+        &p.InStock,
+        &p.LastSeen,
+        &p.MissingSince,
+    )
+    return p, err
+}
+
+
+// Classify sets the brand and category of up to limit products stored before products were
+// classified, which have no category at all. Products that match none are stored with an empty
+// one, so every product is classified once. classified is how many were.
+func Classify(logger *logger.Logger, tx *postgres.Tx, limit int) (classified int, ok bool) {
 
-func Add(logger *logger.Logger, tx *sql.Tx, oldProducts, products *[]*product.Product) bool {
+    query := strings.Replace(selectQuery, "WHERE id = ANY($1)", "WHERE category IS NULL ORDER BY id LIMIT $1", 1)
+
+    unclassified := &[]*product.Product{}
+    ok = get(logger, tx, query, unclassified, limit)
+    if !ok {
+        logger.ERROR("Failed to get unclassified products")
+        return 0, false
+    }
+
+    update := `UPDATE products SET brand = $2, own_brand = $3, category = $4 WHERE id = $1`
+
+    taxonomy := classify.Default(logger)
+    for _, p := range *unclassified {
+        taxonomy.Product(p)
+
+        _, ok = postgres.Exec(logger, tx, update, p.ID, p.Brand, p.OwnBrand, p.Category)
+        if !ok {
+            logger.ERROR("Failed to classify product %d", p.ID)
+            return 0, false
+        }
+    }
+
+    return len(*unclassified), true
+}
+
+
+func Add(logger *logger.Logger, tx *postgres.Tx, oldProducts, products *[]*product.Product) bool {
 
 	// Check if there are products to insert
 	if len(*products) == 0 {
@@ -108,184 +203,171 @@ func Add(logger *logger.Logger, tx *sql.Tx, oldProducts, products *[]*product.Pr
 
     query := product.ProductInsertQuery()
 
-	ok := postgres.ExecuteContextChangeQuery(logger, tx, add, query, oldProducts, products)
-	if !ok {
-		logger.ERROR("Failed to add products")
-		return false
-	}
-
-	return true
-}
-
-
-func add(logger *logger.Logger, tx *sql.Tx, ctx context.Context, query string, args ...interface{}) (ok bool) {
-
-    products, ok := args[1].(*[]*product.Product)
-    if !ok {
-        logger.ERROR("Failed to get products")
-        return false
+    // oldProducts are what the search found last time, filtered for the client. Products found by
+    // other searches are stored too, so what is stored is looked up by URL instead.
+    urls := []string{}
+    for _, p := range *products {
+        if p.URL != "" {
+            urls = append(urls, p.URL)
+        }
     }
 
-    // Accesses oldProducts
-    _, ok = args[0].(*[]*product.Product)
+    stored := &[]*product.Product{}
+    ok := getByURL(logger, tx, urls, stored)
     if !ok {
-        logger.ERROR("Failed to get oldProducts")
+        logger.ERROR("Failed to get stored products")
         return false
     }
 
-    nextAvailableID, ok := getNextAvailableID(logger, tx)
-    if !ok {
-        logger.ERROR("Failed to get the next available ID")
-        return false
+    storedByURL := map[string]*product.Product{}
+    for _, p := range *stored {
+        storedByURL[p.URL] = p
     }
 
-    rowsAffected := int64(0)
-    for _, product := range *products {
+    now := time.Now().Unix()
+    changes := []*product.Change{}
 
-        // TODO: Possibly check oldProducts if match and just return it's ID.
+    for _, p := range *products {
 
-        id, exists, ok := productUrlAlreadyExists(logger, tx, product.URL)
-        if !ok {
-            logger.ERROR("Failed to check if the product URL exists")
-            return false
-        }
-        if exists {
-            product.ID = id
-            logger.DEBUG("Product URL already exists at ID: %d", product.ID)
-            continue
+        if old, found := storedByURL[p.URL]; found {
+            changes = append(changes, product.Changes(old, p)...)
         }
 
-        result, err := tx.ExecContext(
-            ctx,
+        p.ID, _, ok = postgres.QueryRow(
+            logger,
+            tx,
+            postgres.Value[int64],
             query,
-            product.Seller,
-            product.Name,
-            product.Currency,
-            product.Price,
-            product.PricePerUnit,
-            product.DiscountPrice,
-            product.DiscountPricePerUnit,
-            product.DiscountPriceInWords,
-            product.UnitType,
-            product.URL,
-            product.ImgURL,
+            p.Seller,
+            p.Name,
+            p.Currency,
+            p.Price,
+            p.PricePerUnit,
+            p.DiscountPrice,
+            p.DiscountPricePerUnit,
+            p.DiscountPriceInWords,
+            p.UnitType,
+            p.URL,
+            p.ImgURL,
+            p.EAN,
+            p.Brand,
+            p.OwnBrand,
+            p.Category,
+            p.InStock,
+            now,
         )
-        if err != nil {
-            logger.ERROR("Failed to execute the query. Reason: %s", err)
-            return false
-        }
-        rowsAffected, err = result.RowsAffected()
-        if err != nil {
-            logger.ERROR("Failed to get the number of rows affected. Reason: %s", err)
-            return false
-        }
-
-        if rowsAffected != 1 {
-            logger.ERROR("Expected 1 row to be affected, got %d", rowsAffected)
+        if !ok {
+            logger.ERROR("Failed to add products")
             return false
         }
+        p.LastSeen = now
 
-        product.ID = nextAvailableID
         logger.DEBUG("Added product to the database")
-        logger.DEBUG("ID: %d", product.ID)
-        logger.DEBUG("Seller: %s", product.Seller)
-        logger.DEBUG("Name: %s", product.Name)
-        logger.DEBUG("Currency: %s", product.Currency)
-        logger.DEBUG("Price: %f", product.Price)
-        logger.DEBUG("PricePerUnit: %f", product.PricePerUnit)
-        logger.DEBUG("DiscountPrice: %f", product.DiscountPrice)
-        logger.DEBUG("DiscountPricePerUnit: %f", product.DiscountPricePerUnit)
-        logger.DEBUG("DiscountPriceInWords: %s", product.DiscountPriceInWords)
-        logger.DEBUG("UnitType: %s", product.UnitType)
-        logger.DEBUG("URL: %s", product.URL)
-        logger.DEBUG("ImgURL: %s", product.ImgURL)
-        
-        nextAvailableID++
+        logger.DEBUG("ID: %d", p.ID)
+        logger.DEBUG("Seller: %s", p.Seller)
+        logger.DEBUG("Name: %s", p.Name)
+        logger.DEBUG("Currency: %s", p.Currency)
+        logger.DEBUG("Price: %f", p.Price)
+        logger.DEBUG("PricePerUnit: %f", p.PricePerUnit)
+        logger.DEBUG("DiscountPrice: %f", p.DiscountPrice)
+        logger.DEBUG("DiscountPricePerUnit: %f", p.DiscountPricePerUnit)
+        logger.DEBUG("DiscountPriceInWords: %s", p.DiscountPriceInWords)
+        logger.DEBUG("UnitType: %s", p.UnitType)
+        logger.DEBUG("URL: %s", p.URL)
+        logger.DEBUG("ImgURL: %s", p.ImgURL)
+        logger.DEBUG("Brand: %s", p.Brand)
+        logger.DEBUG("Category: %s", p.Category)
+    }
+
+    ok = addChanges(logger, tx, changes, now)
+    if !ok {
+        logger.ERROR("Failed to record product changes")
+        return false
     }
 
     return true
 }
 
 
-func productUrlAlreadyExists(logger *logger.Logger, tx *sql.Tx, url string) (id int64, exists, ok bool) {
+func getByURL(logger *logger.Logger, tx *postgres.Tx, urls []string, products *[]*product.Product) (ok bool) {
 
-    query := `SELECT id FROM products WHERE url = $1`
-    ok = postgres.ExecuteContextLookUpQuery(logger, tx, existsQuery, query, url, &id, &exists)
-    if !ok {
-        logger.ERROR("Failed to check if the product URL exists")
-        return -1, false, false
+    if len(urls) == 0 {
+        return true
     }
 
-    return id, exists, true
-}
+    query := strings.Replace(selectQuery, "WHERE id = ANY($1)", "WHERE url = ANY($1)", 1)
 
-func existsQuery(logger *logger.Logger, tx *sql.Tx, ctx context.Context, query string, args ...interface{}) (ok bool) {
-        
-    url, ok := args[0].(string)
+    ok = get(logger, tx, query, products, pq.Array(urls))
     if !ok {
-        logger.ERROR("Failed to get the URL")
+        logger.ERROR("Failed to get products by URL")
         return false
     }
 
-    id, ok := args[1].(*int64)
-    if !ok {
-        logger.ERROR("Failed to get the ID")
-        return false
-    }
+    return true
+}
 
-    exists, ok := args[2].(*bool)
-    if !ok {
-        logger.ERROR("Failed to get the exists")
-        return false
-    }
 
-    err := tx.QueryRowContext(ctx, query, url).Scan(id)
-    if err == sql.ErrNoRows {
-        logger.DEBUG("Product URL doesn't exist")
-        *exists = false
-        return true
-    }
+// addChanges records what re-scrapes changed about stored products.
+func addChanges(logger *logger.Logger, tx *postgres.Tx, changes []*product.Change, changedAt int64) (ok bool) {
 
-    if err != nil {
-        logger.ERROR("Failed to check if the product URL exists. Reason: %s", err)
-        return false
+    query := `INSERT INTO product_changes (product_id, changed_at, field, old_value, new_value) VALUES ($1, $2, $3, $4, $5)`
+
+    changed := map[int64]bool{}
+    for _, c := range changes {
+        _, ok = postgres.Exec(logger, tx, query, c.ProductID, changedAt, c.Field, c.Old, c.New)
+        if !ok {
+            logger.ERROR("Failed to record change of product %d", c.ProductID)
+            return false
+        }
+        changed[c.ProductID] = true
+        logger.DEBUG("Product %d %s changed from '%s' to '%s'", c.ProductID, c.Field, c.Old, c.New)
     }
 
-    logger.DEBUG("Product URL exists at ID: %d", *id)
-    *exists = true
+    if len(changed) > 0 {
+        logger.INFO("Refreshed %d changed products", len(changed))
+    }
     return true
 }
 
 
-func getNextAvailableID(logger *logger.Logger, tx *sql.Tx) (id int64, ok bool) {
+// MarkMissing records that the products' sellers no longer list them. Products already missing
+// keep the time they went missing.
+func MarkMissing(logger *logger.Logger, tx *postgres.Tx, productIDs []int64, missingSince int64) (ok bool) {
 
-    query := `SELECT nextval('products_id_seq')`
-    ok = postgres.ExecuteContextLookUpQuery(logger, tx, getID, query, &id)
-    if !ok {
-        logger.ERROR("Failed to get the next available ID")
-        return -1, false
+    if len(productIDs) == 0 {
+        return true
     }
 
-    logger.DEBUG("Next available ID: %d", id)
-
-    return id, true
-}
+    query := `UPDATE products SET missing_since = $2 WHERE id = ANY($1) AND missing_since IS NULL`
 
-func getID(logger *logger.Logger, tx *sql.Tx, ctx context.Context, query string, args ...interface{}) (ok bool) {
-    
-    var id int64
-    err := tx.QueryRowContext(ctx, query).Scan(&id)
-    if err != nil {
-        logger.ERROR("Failed to get the next available ID. Reason: %s", err)
+    _, ok = postgres.Exec(logger, tx, query, pq.Array(productIDs), missingSince)
+    if !ok {
+        logger.ERROR("Failed to mark products missing")
         return false
     }
 
-    idPtr, ok := args[0].(*int64)
+    return true
+}
+
+
+// RemoveOrphans removes the products that no search, basket or watch refers to and that weren't
+// seen since the given time, with their price history. The grace period keeps products a scrape
+// is storing right now, its searches aren't committed yet.
+func RemoveOrphans(logger *logger.Logger, tx *postgres.Tx, unseenSince int64) (removed int64, ok bool) {
+
+    query := `
+    DELETE FROM products p
+    WHERE COALESCE(p.last_seen, 0) < $1
+      AND NOT EXISTS (SELECT 1 FROM searches s WHERE s.product_id = p.id)
+      AND NOT EXISTS (SELECT 1 FROM clients  c WHERE c.product_id = p.id)
+      AND NOT EXISTS (SELECT 1 FROM watches  w WHERE w.product_id = p.id)
+    `
+
+    removed, ok = postgres.Exec(logger, tx, query, unseenSince)
     if !ok {
-        logger.ERROR("Failed to get the next available ID")
-        return false
+        logger.ERROR("Failed to remove orphaned products")
+        return 0, false
     }
-    *idPtr = id
 
-    return true
-}
\ No newline at end of file
+    return removed, true
+}
@@ -0,0 +1,41 @@
+package query_products
+
+import (
+	"testing"
+
+	"github.com/jakubruminski/FYP/go/api/product"
+
+	"github.com/jakubruminski/FYP/go/utils/logger"
+	"github.com/jakubruminski/FYP/go/utils/postgres"
+	"github.com/jakubruminski/FYP/go/utils/postgres/postgrestest"
+)
+
+// A product is classified once, a re-scrape that matches no category doesn't make it unclassified again.
+func TestClassify(t *testing.T) {
+	logger := &logger.Logger{}
+	postgrestest.Open(t, logger)
+
+	postgrestest.RolledBack(logger, func(tx *postgres.Tx) {
+		// Stored before products were classified
+		_, ok := postgres.Exec(logger, tx, `INSERT INTO products (seller, name, currency, price, url) VALUES ('Tesco', 'Tesco Gift Card', 'EUR', 10, 'test://gift-card')`)
+		if !ok {
+			t.Fatalf("Failed to add an unclassified product")
+		}
+
+		classified, ok := Classify(logger, tx, 1000000)
+		if !ok || classified == 0 {
+			t.Fatalf("Expected the first pass to classify the product, but it classified %d (%t)", classified, ok)
+		}
+
+		// Scraped again, it matches no category
+		scraped := &[]*product.Product{{Seller: "Tesco", Name: "Tesco Gift Card", Currency: "EUR", Price: 10, URL: "test://gift-card", Brand: "Tesco", OwnBrand: true, InStock: true}}
+		if !Add(logger, tx, &[]*product.Product{}, scraped) {
+			t.Fatalf("Failed to store the scraped product")
+		}
+
+		classified, ok = Classify(logger, tx, 1000000)
+		if !ok || classified != 0 {
+			t.Errorf("Expected the second pass to find nothing to classify, but it classified %d (%t)", classified, ok)
+		}
+	})
+}
@@ -1,8 +1,6 @@
 package query_searchs
 
 import (
-	"context"
-	"database/sql"
 	"strings"
 	"time"
 
@@ -14,181 +12,172 @@ import (
 
 var tableName = "searches"
 
+// SearchTerm is a row of search_terms, pointing at the current result set of a term. Each refresh
+// of the term stores its products under the next generation and moves Generation to it.
 type SearchTerm struct {
 	SearchTerm          string     `json:"search_term"`
-	ProductID		    int        `json:"product_id"`
+	Generation          int        `json:"generation"`
 
 	FetchCount          int        `json:"fetch_count"`
 	LastFetch           int        `json:"last_fetch"`
 	Expiry 			    int        `json:"expiry"`
 }
 
-func INIT(logger *logger.Logger) (ok bool) {
-	
+func GetIDs(logger *logger.Logger, tx *postgres.Tx, searchTerm string) (productIDs *[]*int64, ok bool) {
+	searchTerm = strings.ToLower(searchTerm)
+
 	query := `
-		CREATE TABLE IF NOT EXISTS searches
-		(
-			search_term      VARCHAR(255),
-			product_id       INT,
-			fetch_count      INT,
-			last_fetch       INT,
-			expiry           INT
-		)
+	SELECT s.product_id FROM searches s
+	JOIN search_terms t ON t.search_term = s.search_term AND t.generation = s.generation
+	WHERE s.search_term = $1
 	`
 
-	ok = postgres.ExecuteCreateTableQuery(logger, tableName, query)
+	ids, ok := postgres.Query(logger, tx, postgres.Value[int64], query, searchTerm)
 	if !ok {
-		logger.ERROR("Couldn't create the searches table")
-		return false
+		logger.ERROR("Failed to get product IDs")
+		return nil, false
 	}
 
-	return true	
+	productIDs = &[]*int64{}
+	for i := range ids {
+		*productIDs = append(*productIDs, &ids[i])
+	}
+	return productIDs, true
 }
 
-func GetIDs(logger *logger.Logger, tx *sql.Tx, searchTerm string) (productIDs *[]*int64, ok bool) {
+
+// GetExpiry returns when searchTerm was last fetched, 0 when it never was.
+func GetExpiry(logger *logger.Logger, tx *postgres.Tx, searchTerm string) (expiry int, ok bool) {
 	searchTerm = strings.ToLower(searchTerm)
 
-	query := `SELECT product_id FROM searches WHERE search_term = $1`
+	query := `SELECT last_fetch FROM search_terms WHERE search_term = $1`
 
-	productIDs = &[]*int64{}
-	ok = postgres.ExecuteContextLookUpQuery(logger, tx, getIDs, query, searchTerm, productIDs)
+	expiry, _, ok = postgres.QueryRow(logger, tx, postgres.Value[int], query, searchTerm)
 	if !ok {
-		logger.ERROR("Failed to get product IDs")
-		return nil, false
+		logger.ERROR("Failed to get expiry")
+		return 0, false
 	}
 
-
-	return productIDs, true
+	return expiry, true
 }
 
 
-func getIDs(logger *logger.Logger, tx *sql.Tx, ctx context.Context, query string, args ...interface{}) (ok bool) {
+// Add stores the products a fetch of searchTerm found as its next generation and swaps it in,
+// removing the generation it replaces. Readers see the swap when the transaction commits.
+func Add(logger *logger.Logger, tx *postgres.Tx, searchTerm string, products *[]*product.Product) (ok bool) {
 
-	searchTerm, ok := args[0].(string)
+	expiry, ok := env.GetInt(logger, "SEARCH_EXPIRY_IN_DAYS")
 	if !ok {
-		logger.ERROR("Failed to get search term")
+		logger.ERROR("Failed to get search expiry")
 		return false
 	}
+	searchTerm = strings.ToLower(searchTerm)
+	
+	now := int(time.Now().Unix()) 
+	lastFetched := now
+	expiry = now + (expiry * 24 * 60 * 60)
 
-	rows, err := tx.QueryContext(ctx, query, searchTerm)
-	if err != nil {
-		logger.ERROR("Failed to execute the query. Reason: %s", err)
-		return false
-	}
+	// Locks the term's row, so refreshes of one term running at once swap in one after the other
+	termQuery := `
+	INSERT INTO search_terms (search_term, generation, fetch_count, last_fetch, expiry) VALUES ($1, 1, 1, $2, $3)
+	ON CONFLICT (search_term) DO UPDATE
+	SET generation = search_terms.generation + 1, fetch_count = search_terms.fetch_count + 1, last_fetch = EXCLUDED.last_fetch, expiry = EXCLUDED.expiry
+	RETURNING generation
+	`
 
-	productIDs, ok := args[1].(*[]*int64)
+	generation, _, ok := postgres.QueryRow(logger, tx, postgres.Value[int], termQuery, searchTerm, lastFetched, expiry)
 	if !ok {
-		logger.ERROR("Failed to get product IDs")
+		logger.ERROR("Failed to start the next generation of '%s'", searchTerm)
 		return false
 	}
 
-	for rows.Next() {
-		productID := new(int64)
-		err := rows.Scan(productID)
-		if err != nil {
-			logger.ERROR("Failed to scan product ID")
+	query := `INSERT INTO searches (search_term, product_id, generation, last_fetch) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING`
+
+	// A seller can list a product twice in one search
+	added := map[int64]bool{}
+	for _, product := range *products {
+		if added[product.ID] {
+			continue
+		}
+		added[product.ID] = true
+
+		_, ok = postgres.Exec(logger, tx, query, searchTerm, product.ID, generation, lastFetched)
+		if !ok {
+			logger.ERROR("Failed to add search term")
 			return false
 		}
-		*productIDs = append(*productIDs, productID)
 	}
+
+	query = `DELETE FROM searches WHERE search_term = $1 AND generation < $2`
+
+	removed, ok := postgres.Exec(logger, tx, query, searchTerm, generation)
+	if !ok {
+		logger.ERROR("Failed to remove the previous generation of '%s'", searchTerm)
+		return false
+	}
+
+	logger.DEBUG("Swapped in generation %d of '%s', replacing %d results", generation, searchTerm, removed)
 	return true
 }
 
 
-func GetExpiry(logger *logger.Logger, tx *sql.Tx, searchTerm string) (expiry int, ok bool) {
-	searchTerm = strings.ToLower(searchTerm)
+// RemoveExpired removes the search terms that expired before the given time, with their results.
+func RemoveExpired(logger *logger.Logger, tx *postgres.Tx, before int64) (removed int64, ok bool) {
 
-	query := `SELECT last_fetch FROM searches WHERE search_term = $1`
+	query := `DELETE FROM search_terms WHERE expiry < $1`
 
-	ok = postgres.ExecuteContextLookUpQuery(logger, tx, getExpiry, query, searchTerm, &expiry)
+	removed, ok = postgres.Exec(logger, tx, query, before)
 	if !ok {
-		logger.ERROR("Failed to get expiry")
+		logger.ERROR("Failed to remove expired searches")
 		return 0, false
 	}
 
-	return expiry, true
+	return removed, true
 }
 
 
-func getExpiry(logger *logger.Logger, tx *sql.Tx, ctx context.Context, query string, args ...interface{}) (ok bool) {
-	
-	searchTerm, ok := args[0].(string)
-	if !ok {
-		logger.ERROR("Failed to get search term")
-		return false
-	}
+// GetRecent returns when every product found by a search since the given time was last fetched.
+func GetRecent(logger *logger.Logger, tx *postgres.Tx, since int64, lastFetched map[int64]int64) (ok bool) {
 
-	expiry, ok := args[1].(*int)
+	query := `SELECT product_id, MAX(last_fetch) FROM searches WHERE last_fetch >= $1 GROUP BY product_id`
+
+	recent, ok := postgres.Query(logger, tx, scanCount[int64, int64], query, since)
 	if !ok {
-		logger.ERROR("Failed to get expiry")
+		logger.ERROR("Failed to get recent searches")
 		return false
 	}
 
-	err := tx.QueryRowContext(ctx, query, searchTerm).Scan(expiry)
-	if err != nil {
-		logger.ERROR("Failed to execute the query. Reason: %s", err)
-		return false
+	for _, r := range recent {
+		lastFetched[r.key] = r.count
 	}
 	return true
 }
 
 
-func Add(logger *logger.Logger, tx *sql.Tx, searchTerm string, products *[]*product.Product) (ok bool) {
+// GetPopular counts how many times each of the most fetched search terms was fetched.
+func GetPopular(logger *logger.Logger, tx *postgres.Tx, limit int, counts map[string]int) (ok bool) {
 
-	expiry, ok := env.GetInt(logger, "SEARCH_EXPIRY_IN_DAYS")
-	if !ok {
-		logger.ERROR("Failed to get search expiry")
-		return false
-	}
-	searchTerm = strings.ToLower(searchTerm)
-	
-	now := int(time.Now().Unix()) 
-	lastFetched := now
-	expiry = now + (expiry * 24 * 60 * 60)
-	query := `INSERT INTO searches (search_term, product_id, fetch_count, last_fetch, expiry) VALUES ($1, $2, 1, $3, $4)`
+	query := `SELECT search_term, fetch_count FROM search_terms ORDER BY fetch_count DESC LIMIT $1`
 
-	ok = postgres.ExecuteContextChangeQuery(logger, tx, add, query, searchTerm, products, lastFetched, expiry)
+	popular, ok := postgres.Query(logger, tx, scanCount[string, int], query, limit)
 	if !ok {
-		logger.ERROR("Failed to add search term")
+		logger.ERROR("Failed to get popular searches")
 		return false
 	}
 
+	for _, p := range popular {
+		counts[p.key] = p.count
+	}
 	return true
 }
 
 
-func add(logger *logger.Logger, tx *sql.Tx, ctx context.Context, query string, args ...interface{}) (ok bool) {
-	
-	searchTerm, ok := args[0].(string)
-	if !ok {
-		logger.ERROR("Failed to get search term")
-		return false
-	}
-
-	products, ok := args[1].(*[]*product.Product)
-	if !ok {
-		logger.ERROR("Failed to get product IDs")
-		return false
-	}
-
-	lastFetched, ok := args[2].(int)
-	if !ok {
-		logger.ERROR("Failed to get last fetched")
-		return false
-	}
-
-	expiry, ok := args[3].(int)
-	if !ok {
-		logger.ERROR("Failed to get expiry")
-		return false
-	}
+type count[K comparable, V any] struct {
+	key   K
+	count V
+}
 
-	for _, product := range *products {
-		_, err := tx.ExecContext(ctx, query, searchTerm, product.ID, lastFetched, expiry)
-		if err != nil {
-			logger.ERROR("Failed to execute the query. Reason: %s", err)
-			return false
-		}
-	}
-	return true
-}
\ No newline at end of file
+func scanCount[K comparable, V any](row postgres.Scanner) (c count[K, V], err error) {
+	err = row.Scan(&c.key, &c.count)
+	return c, err
+}
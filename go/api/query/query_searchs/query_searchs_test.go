@@ -3,15 +3,54 @@ package query_searchs
 import (
 	"testing"
 
+	"github.com/jakubruminski/FYP/go/api/product"
+
 	"github.com/jakubruminski/FYP/go/utils/logger"
+	"github.com/jakubruminski/FYP/go/utils/postgres"
+	"github.com/jakubruminski/FYP/go/utils/postgres/postgrestest"
 )
 
 
-func TestInit(t *testing.T) {
+// The migrations set up the search tables, a search is stored and replaced by the next refresh.
+func TestSearches(t *testing.T) {
 	logger := &logger.Logger{}
+	t.Setenv("SEARCH_EXPIRY_IN_DAYS", "1")
+	postgrestest.Open(t, logger)
+
+	postgrestest.RolledBack(logger, func(tx *postgres.Tx) {
+		query := `INSERT INTO products (seller, name, url) VALUES ($1, $2, $3) RETURNING id`
+
+		products := &[]*product.Product{}
+		for _, url := range []string{"test://milk", "test://skimmed-milk"} {
+			id, _, ok := postgres.QueryRow(logger, tx, postgres.Value[int64], query, "Tesco", "Milk", url)
+			if !ok {
+				t.Fatalf("Failed to add product %s", url)
+			}
+			*products = append(*products, &product.Product{ID: id})
+		}
+
+		// A seller can list a product twice
+		listed := &[]*product.Product{(*products)[0], (*products)[1], (*products)[0]}
+		if !Add(logger, tx, "Test Milk", listed) {
+			t.Fatalf("Failed to add search")
+		}
+
+		productIDs, ok := GetIDs(logger, tx, "test milk")
+		if !ok || len(*productIDs) != 2 {
+			t.Fatalf("Expected 2 products for the search, but got %v", productIDs)
+		}
+		expiry, ok := GetExpiry(logger, tx, "test milk")
+		if !ok || expiry == 0 {
+			t.Errorf("Expected the search to have been fetched, but got %d", expiry)
+		}
 
-	ok := INIT(logger)
-	if !ok {
-		t.Errorf("Failed to initialize searches")
-	}
-}
\ No newline at end of file
+		// The refresh replaces the results
+		if !Add(logger, tx, "test milk", &[]*product.Product{(*products)[1]}) {
+			t.Fatalf("Failed to refresh search")
+		}
+		productIDs, ok = GetIDs(logger, tx, "test milk")
+		if !ok || len(*productIDs) != 1 || *(*productIDs)[0] != (*products)[1].ID {
+			t.Errorf("Expected only product %d after the refresh, but got %v", (*products)[1].ID, productIDs)
+		}
+	})
+}
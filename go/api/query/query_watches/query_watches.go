@@ -0,0 +1,191 @@
+package query_watches
+
+import (
+	"github.com/lib/pq"
+
+	"github.com/jakubruminski/FYP/go/api/watch"
+
+	"github.com/jakubruminski/FYP/go/utils/logger"
+	"github.com/jakubruminski/FYP/go/utils/postgres"
+)
+
+var tableName = "watches"
+
+func Add(logger *logger.Logger, tx *postgres.Tx, w *watch.Watch) (ok bool) {
+
+	query := `
+	INSERT INTO watches (client_id, product_id, search_term, target_unit_price, unit_type, channel, address, created_at)
+	VALUES ($1, NULLIF($2, 0), NULLIF($3, ''), $4, NULLIF($5, ''), $6, NULLIF($7, ''), $8)
+	RETURNING id
+	`
+
+	w.ID, _, ok = postgres.QueryRow(logger, tx, postgres.Value[int64], query, w.ClientID, w.ProductID, w.SearchTerm, w.TargetUnitPrice, w.UnitType, w.Channel, w.Address, w.CreatedAt)
+	if !ok {
+		logger.ERROR("Failed to add watch")
+		return false
+	}
+
+	return true
+}
+
+
+func Remove(logger *logger.Logger, tx *postgres.Tx, clientID string, watchID int64) (ok bool) {
+
+	query := `DELETE FROM watches WHERE client_id = $1 AND id = $2`
+
+	_, ok = postgres.Exec(logger, tx, query, clientID, watchID)
+	if !ok {
+		logger.ERROR("Failed to remove watch")
+		return false
+	}
+
+	return true
+}
+
+
+// GetByClient returns the watches of a client.
+func GetByClient(logger *logger.Logger, tx *postgres.Tx, clientID string, watches *[]*watch.Watch) (ok bool) {
+
+	query := selectWatches + ` WHERE client_id = $1 ORDER BY id`
+
+	found, ok := postgres.Query(logger, tx, scanWatch, query, clientID)
+	if !ok {
+		logger.ERROR("Failed to get watches")
+		return false
+	}
+
+	*watches = append(*watches, found...)
+	return true
+}
+
+// GetMatching returns the watches on a search term or on any of the products.
+func GetMatching(logger *logger.Logger, tx *postgres.Tx, searchTerm string, productIDs []int64, watches *[]*watch.Watch) (ok bool) {
+
+	query := selectWatches + ` WHERE search_term = $1 OR product_id = ANY($2) FOR UPDATE`
+
+	found, ok := postgres.Query(logger, tx, scanWatch, query, searchTerm, pq.Array(productIDs))
+	if !ok {
+		logger.ERROR("Failed to get matching watches")
+		return false
+	}
+
+	*watches = append(*watches, found...)
+	return true
+}
+
+var selectWatches = `SELECT id, client_id, COALESCE(product_id, 0), COALESCE(search_term, ''), target_unit_price, COALESCE(unit_type, ''), channel, COALESCE(address, ''), created_at, COALESCE(last_notified_price, 0) FROM watches`
+
+func scanWatch(row postgres.Scanner) (w *watch.Watch, err error) {
+	w = &watch.Watch{}
+	err = row.Scan(&w.ID, &w.ClientID, &w.ProductID, &w.SearchTerm, &w.TargetUnitPrice, &w.UnitType, &w.Channel, &w.Address, &w.CreatedAt, &w.LastNotifiedPrice)
+	return w, err
+}
+
+func SetLastNotifiedPrice(logger *logger.Logger, tx *postgres.Tx, w *watch.Watch) (ok bool) {
+
+	query := `UPDATE watches SET last_notified_price = $2 WHERE id = $1`
+
+	_, ok = postgres.Exec(logger, tx, query, w.ID, w.LastNotifiedPrice)
+	if !ok {
+		logger.ERROR("Failed to update watch %d", w.ID)
+		return false
+	}
+
+	return true
+}
+
+
+func AddNotification(logger *logger.Logger, tx *postgres.Tx, n *watch.Notification) (ok bool) {
+
+	query := `
+	INSERT INTO notifications (watch_id, client_id, product_id, product_name, seller, url, currency, unit_price, unit_type, target, channel, address, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`
+
+	_, ok = postgres.Exec(logger, tx, query,
+		n.WatchID, n.ClientID, n.ProductID, n.ProductName, n.Seller, n.URL, n.Currency, n.UnitPrice, n.UnitType, n.Target, n.Channel, n.Address, n.CreatedAt)
+	if !ok {
+		logger.ERROR("Failed to add notification")
+		return false
+	}
+
+	return true
+}
+
+// Inbox returns a client's notifications, newest first.
+func Inbox(logger *logger.Logger, tx *postgres.Tx, clientID string, limit int, notifications *[]*watch.Notification) (ok bool) {
+
+	query := selectNotifications + ` WHERE client_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2`
+
+	found, ok := postgres.Query(logger, tx, scanNotification, query, clientID, limit)
+	if !ok {
+		logger.ERROR("Failed to get inbox")
+		return false
+	}
+
+	*notifications = append(*notifications, found...)
+	return true
+}
+
+func MarkRead(logger *logger.Logger, tx *postgres.Tx, clientID string) (ok bool) {
+
+	query := `UPDATE notifications SET read = TRUE WHERE client_id = $1 AND NOT read`
+
+	_, ok = postgres.Exec(logger, tx, query, clientID)
+	if !ok {
+		logger.ERROR("Failed to mark notifications as read")
+		return false
+	}
+
+	return true
+}
+
+// Claim takes up to limit notifications still waiting for their channel, counting an attempt at
+// each. Once the transaction commits, other instances leave them alone until SetDelivered releases
+// them or the claim times out, so they can be sent outside any transaction.
+func Claim(logger *logger.Logger, tx *postgres.Tx, limit int, now int64, notifications *[]*watch.Notification) (ok bool) {
+
+	query := `
+	UPDATE notifications SET claimed_at = $1, attempts = attempts + 1
+	WHERE id IN (
+		SELECT id FROM notifications
+		WHERE NOT delivered AND attempts < $2 AND (claimed_at IS NULL OR claimed_at < $3)
+		ORDER BY id LIMIT $4
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING ` + notificationColumns
+
+	found, ok := postgres.Query(logger, tx, scanNotification, query, now, watch.MAX_ATTEMPTS, now-watch.CLAIM_TIMEOUT, limit)
+	if !ok {
+		logger.ERROR("Failed to claim undelivered notifications")
+		return false
+	}
+
+	*notifications = append(*notifications, found...)
+	return true
+}
+
+// SetDelivered records how sending a claimed notification went and releases it. One that failed
+// is claimed again while it has attempts left.
+func SetDelivered(logger *logger.Logger, tx *postgres.Tx, notificationID int64, delivered bool) (ok bool) {
+
+	query := `UPDATE notifications SET delivered = $2, claimed_at = NULL WHERE id = $1`
+
+	_, ok = postgres.Exec(logger, tx, query, notificationID, delivered)
+	if !ok {
+		logger.ERROR("Failed to update notification %d", notificationID)
+		return false
+	}
+
+	return true
+}
+
+var notificationColumns = `id, COALESCE(watch_id, 0), client_id, COALESCE(product_id, 0), COALESCE(product_name, ''), COALESCE(seller, ''), COALESCE(url, ''), COALESCE(currency, ''), COALESCE(unit_price, 0), COALESCE(unit_type, ''), COALESCE(target, 0), COALESCE(channel, ''), COALESCE(address, ''), created_at, read, attempts`
+
+var selectNotifications = `SELECT ` + notificationColumns + ` FROM notifications`
+
+func scanNotification(row postgres.Scanner) (n *watch.Notification, err error) {
+	n = &watch.Notification{}
+	err = row.Scan(&n.ID, &n.WatchID, &n.ClientID, &n.ProductID, &n.ProductName, &n.Seller, &n.URL, &n.Currency, &n.UnitPrice, &n.UnitType, &n.Target, &n.Channel, &n.Address, &n.CreatedAt, &n.Read, &n.Attempts)
+	return n, err
+}
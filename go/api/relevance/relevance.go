@@ -0,0 +1,196 @@
+package relevance
+
+import (
+	"html"
+	"sort"
+	"strings"
+
+	"github.com/jakubruminski/FYP/go/api/product"
+
+	"github.com/jakubruminski/FYP/go/utils/env"
+	"github.com/jakubruminski/FYP/go/utils/logger"
+	"github.com/jakubruminski/FYP/go/utils/text"
+	"github.com/jakubruminski/FYP/go/utils/unit"
+)
+
+
+// How much each kind of match between a search word and a word of the name is worth.
+const (
+	exactMatch  = 1.0
+	stemMatch   = 0.9   // "egg" and "eggs"
+	prefixMatch = 0.6   // "choc" and "chocolate"
+)
+
+// Words after these describe what comes with the product, not what it is,
+// e.g. "Chicken Breast with Garlic Butter" is not butter.
+var qualifiers = map[string]bool{"with": true, "in": true, "and": true, "for": true}
+
+
+// Threshold is the relevance below which a product is shown after every relevant one.
+func Threshold(logger *logger.Logger) float64 {
+	return env.GetFloatDefault(logger, "RELEVANCE_THRESHOLD", 0.6)
+}
+
+// Score sets Relevance and Score on every product.
+//
+// Relevance is 0 to 1 and says how well the name matches the search term on its own.
+// Score blends it with how cheap the product is per unit compared with the other results
+// priced in the same unit, weighted by RELEVANCE_WEIGHT, and is what "best_match" sorts by.
+//
+func Score(logger *logger.Logger, searchTerm string, products *[]*product.Product) {
+	weight := env.GetFloatDefault(logger, "RELEVANCE_WEIGHT", 0.7)
+	terms := Terms(searchTerm)
+
+	for _, p := range *products {
+		p.Relevance = Relevance(terms, p.Name)
+	}
+
+	cheapness := cheapness(products)
+	for _, p := range *products {
+		p.Score = weight*p.Relevance + (1-weight)*cheapness[p]
+	}
+}
+
+// Terms splits a search term as the API receives it, escaped and with "%20" for spaces, into words.
+func Terms(searchTerm string) []string {
+	searchTerm = strings.ReplaceAll(searchTerm, "%20", " ")
+	searchTerm = html.UnescapeString(searchTerm)
+	return text.Tokens(searchTerm)
+}
+
+
+// Relevance is the average of how well each search word matches the name.
+//
+// A word counts most when it is the last word that describes the product, which in product
+// names is nearly always what the product is: "milk" matches "Avonmore Fresh Milk 2L" fully,
+// "Milk Chocolate" by half, and "Shampoo with Milk Protein" hardly at all. Search words found
+// next to each other and in order are a phrase, and the whole phrase counts from where it ends,
+// so "chocolate milk" matches "Chocolate Milk" fully but "Milk Chocolate" only partly.
+//
+func Relevance(terms []string, name string) float64 {
+	if len(terms) == 0 {
+		return 1.0
+	}
+
+	words := descriptiveWords(name)
+	if len(words) == 0 {
+		return 0.0
+	}
+
+	head := len(words) - 1
+	for i, w := range words {
+		if qualifiers[w] && i > 0 {
+			head = i - 1
+			break
+		}
+	}
+
+	distanceFromHead := func(position int) int {
+		if position > head {
+			// After "with", "in" and so on
+			return len(words)
+		}
+		return head - position
+	}
+
+	total, matches := 0.0, 0.0
+	positions := make([]int, len(terms))
+	for i, term := range terms {
+		best, bestMatch, bestPosition := 0.0, 0.0, -1
+
+		for position, word := range words {
+			match := matchQuality(term, word)
+			if match == 0.0 {
+				continue
+			}
+
+			s := match / float64(1+distanceFromHead(position))
+			if s > best {
+				best, bestMatch, bestPosition = s, match, position
+			}
+		}
+
+		total += best
+		matches += bestMatch
+		positions[i] = bestPosition
+	}
+
+	if len(terms) > 1 && isPhrase(positions) {
+		last := positions[len(positions)-1]
+		return matches / float64(len(terms)) / float64(1+distanceFromHead(last))
+	}
+
+	return total / float64(len(terms))
+}
+
+func matchQuality(term, word string) float64 {
+	switch {
+	case term == word:
+		return exactMatch
+	case text.Stem(term) == text.Stem(word):
+		return stemMatch
+	case len(term) >= 3 && strings.HasPrefix(word, term):
+		return prefixMatch
+	}
+	return 0.0
+}
+
+// descriptiveWords drops sizes and units, so "Milk 2L" ends in "milk".
+func descriptiveWords(name string) (words []string) {
+	for _, token := range text.Tokens(name) {
+		if token == "x" || strings.ContainsAny(token, "0123456789") {
+			continue
+		}
+		if u, ok := unit.Lookup(token); ok && isAlias(u, token) {
+			continue
+		}
+		words = append(words, token)
+	}
+	return words
+}
+
+func isAlias(u *unit.Unit, token string) bool {
+	for _, alias := range u.Aliases {
+		if alias == token {
+			return true
+		}
+	}
+	return false
+}
+
+func isPhrase(positions []int) bool {
+	for i := 1; i < len(positions); i++ {
+		if positions[i-1] < 0 || positions[i] != positions[i-1]+1 {
+			return false
+		}
+	}
+	return true
+}
+
+
+// cheapness ranks products by unit price against the others with the same UnitType,
+// 1 for the cheapest down to 0 for the most expensive.
+func cheapness(products *[]*product.Product) (result map[*product.Product]float64) {
+	result = map[*product.Product]float64{}
+
+	byUnitType := map[string][]*product.Product{}
+	for _, p := range *products {
+		byUnitType[p.UnitType] = append(byUnitType[p.UnitType], p)
+	}
+
+	for _, group := range byUnitType {
+		sort.SliceStable(group, func(i, j int) bool {
+			return product.ByUnitPrice(group[i], group[j]) < 0
+		})
+
+		for i, p := range group {
+			if len(group) == 1 {
+				result[p] = 1.0
+				continue
+			}
+			result[p] = 1.0 - float64(i)/float64(len(group)-1)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,59 @@
+package relevance
+
+import (
+	"testing"
+
+	"github.com/jakubruminski/FYP/go/api/product"
+	"github.com/jakubruminski/FYP/go/utils/logger"
+)
+
+func TestRelevance(t *testing.T) {
+	testCases := []struct {
+		searchTerm  string
+		name        string
+		expectedMin float64
+		expectedMax float64
+	}{
+		{"milk",               "Avonmore Fresh Milk 2L",                 1.0,  1.0},
+		{"milk",               "Tesco Semi Skimmed Milk 1 Litre",        1.0,  1.0},
+		{"milk",               "Cadbury Dairy Milk Chocolate 110g",      0.5,  0.5},
+		{"milk",               "Dove Shampoo with Milk Protein 250ml",   0.0,  0.3},
+		{"egg",                "Free Range Eggs 12 Pack",                0.9,  0.9},
+		{"choc",               "Tesco Dark Chocolate 100g",              0.6,  0.6},
+		{"chocolate%20milk",   "Avonmore Chocolate Milk 500ml",          1.0,  1.0},
+		{"chocolate%20milk",   "Milk Chocolate Buttons",                 0.4,  0.45},
+		{"strawberries",       "Strawberry Yogurt 4 x 125g",             0.4,  0.5},
+		{"milk",               "Bananas Loose",                          0.0,  0.0},
+	}
+
+	for _, tc := range testCases {
+		relevance := Relevance(Terms(tc.searchTerm), tc.name)
+		if relevance < tc.expectedMin-1e-9 || relevance > tc.expectedMax+1e-9 {
+			t.Errorf("Expected relevance between %f and %f, but got %f for '%s' in '%s'", tc.expectedMin, tc.expectedMax, relevance, tc.searchTerm, tc.name)
+		}
+	}
+}
+
+func TestBestMatch(t *testing.T) {
+	logger := &logger.Logger{}
+
+	products := &[]*product.Product{
+		{ID: 1, Name: "Milk Chocolate Buttons", PricePerUnit: 0.90, UnitType: "kilogram"},
+		{ID: 2, Name: "Dawn Fresh Milk 2L",     PricePerUnit: 1.15, UnitType: "litre"},
+		{ID: 3, Name: "Avonmore Milk 2L",       PricePerUnit: 1.25, UnitType: "litre"},
+		{ID: 4, Name: "Shampoo with Milk",      PricePerUnit: 0.50, UnitType: "litre"},
+	}
+
+	Score(logger, "milk", products)
+
+	comparator, _ := product.Sorting("best_match", "")
+	comparator = product.Then(product.RelevantFirst(0.6), comparator)
+	product.SortBy(products, comparator)
+
+	expected := []int64{2, 3, 1, 4}
+	for i, p := range *products {
+		if p.ID != expected[i] {
+			t.Fatalf("Expected order %v, but got product %d at %d", expected, p.ID, i)
+		}
+	}
+}
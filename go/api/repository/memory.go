@@ -0,0 +1,526 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jakubruminski/FYP/go/api/fuzzy"
+	"github.com/jakubruminski/FYP/go/api/history"
+	"github.com/jakubruminski/FYP/go/api/product"
+	"github.com/jakubruminski/FYP/go/api/watch"
+	"github.com/jakubruminski/FYP/go/utils/env"
+	"github.com/jakubruminski/FYP/go/utils/logger"
+	"github.com/jakubruminski/FYP/go/utils/postgres"
+	"github.com/jakubruminski/FYP/go/utils/text"
+)
+
+
+// Memory keeps everything in maps, for development, demos and tests. It is empty again on every
+// restart.
+type Memory struct {
+	mu       sync.RWMutex
+	products map[int64]*product.Product
+	byURL    map[string]int64
+	nextID   int64
+	searches map[string]*search
+	baskets  map[string][]int64   // product IDs, in the order they were added
+
+	observations  map[int64][]*history.Observation   // by product ID, oldest first
+	watches       map[int64]*watch.Watch
+	nextWatchID   int64
+	notifications []*notification                   // oldest first
+}
+
+type search struct {
+	productIDs []int64
+	lastFetch  int64
+}
+
+type notification struct {
+	watch.Notification
+	delivered bool
+	claimedAt int64   // 0 when not claimed
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		products:     map[int64]*product.Product{},
+		byURL:        map[string]int64{},
+		nextID:       1,
+		searches:     map[string]*search{},
+		baskets:      map[string][]int64{},
+		observations: map[int64][]*history.Observation{},
+		watches:      map[int64]*watch.Watch{},
+		nextWatchID:  1,
+	}
+}
+
+// InTransaction doesn't isolate anything. Each call on the repositories is atomic on its own,
+// nothing is undone when transactionFunction fails and nothing is tried again.
+func (m *Memory) InTransaction(
+	logger *logger.Logger,
+	ctx context.Context,
+	options *postgres.TxOptions,
+	transactionFunction TransactionFunction,
+) bool {
+
+	repos := &Repositories{
+		Products:     &memoryProducts{m},
+		Searches:     &memorySearches{m},
+		Baskets:      &memoryBaskets{m},
+		Watches:      &memoryWatches{m},
+		Observations: &memoryObservations{m},
+	}
+	return transactionFunction(repos)
+}
+
+// stored is what the database would keep of a product.
+func stored(p *product.Product) *product.Product {
+	copied := *p
+	copied.Converted = nil
+	copied.ConvertedFrom = ""
+	copied.Relevance, copied.Score = 0, 0
+	copied.Promotion = ""
+	return &copied
+}
+
+// get returns a copy of a stored product, handlers change the products they serve.
+func (m *Memory) get(productID int64) (p *product.Product, found bool) {
+	p, found = m.products[productID]
+	if !found {
+		return nil, false
+	}
+	copied := *p
+	return &copied, true
+}
+
+func expiryOffset(logger *logger.Logger) int64 {
+	return int64(env.GetIntDefault(logger, "SEARCH_EXPIRY_IN_DAYS", 1) * 24 * 60 * 60)
+}
+
+
+type memoryProducts struct {
+	m *Memory
+}
+
+func (r *memoryProducts) Add(logger *logger.Logger, oldProducts, products *[]*product.Product) (ok bool) {
+	m := r.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().Unix()
+	for _, p := range *products {
+		id, found := m.byURL[p.URL]
+		if !found || p.URL == "" {
+			id = m.nextID
+			m.nextID++
+		}
+		p.ID = id
+
+		refreshed := stored(p)
+		if existing, found := m.products[id]; found && refreshed.EAN == "" {
+			refreshed.EAN = existing.EAN
+		}
+		refreshed.LastSeen = now
+		refreshed.MissingSince = 0
+
+		m.products[id] = refreshed
+		if p.URL != "" {
+			m.byURL[p.URL] = id
+		}
+
+		// Every scrape is recorded, including products that were already stored
+		m.observations[id] = append(m.observations[id], history.NewObservation(p, now))
+	}
+
+	missing := product.Missing(*oldProducts, *products)
+	for _, p := range missing {
+		if s, found := m.products[p.ID]; found && s.MissingSince == 0 {
+			s.MissingSince = now
+		}
+	}
+	if len(missing) > 0 {
+		logger.INFO("%d products found before are no longer listed", len(missing))
+	}
+
+	return true
+}
+
+func (r *memoryProducts) Get(logger *logger.Logger, products *[]*product.Product, productIDs []int64) (ok bool) {
+	m := r.m
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, id := range productIDs {
+		if p, found := m.get(id); found {
+			*products = append(*products, p)
+		}
+	}
+	return true
+}
+
+
+type memorySearches struct {
+	m *Memory
+}
+
+func (r *memorySearches) Products(logger *logger.Logger, products *[]*product.Product, searchTerm string, filter *product.Filter) (found, expired, ok bool) {
+	m := r.m
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, cached := m.searches[searchTerm]
+	if !cached || len(s.productIDs) == 0 {
+		logger.DEBUG_WARN("No products found")
+		return m.fuzzyProducts(logger, products, searchTerm, filter), false, true
+	}
+
+	for _, id := range s.productIDs {
+		if p, found := m.get(id); found && filter.Matches(p) {
+			*products = append(*products, p)
+		}
+	}
+
+	if time.Now().Unix() > s.lastFetch + expiryOffset(logger) {
+		logger.DEBUG_WARN("Expiry time has passed")
+		return false, true, true
+	}
+
+	return true, false, true
+}
+
+// fuzzyProducts is the in memory version of the fuzzy search Postgres does. Only names holding
+// every word of the term, stemmed, match, there are no trigrams to catch typos.
+func (m *Memory) fuzzyProducts(logger *logger.Logger, products *[]*product.Product, searchTerm string, filter *product.Filter) (found bool) {
+	if !fuzzy.Enabled(logger) {
+		return false
+	}
+	searchText, ok := fuzzy.Text(searchTerm)
+	if !ok {
+		return false
+	}
+
+	words := []string{}
+	for _, token := range text.Tokens(searchText) {
+		words = append(words, text.Stem(token))
+	}
+
+	// Like Postgres, only products that searches found recently
+	since := time.Now().Unix() - expiryOffset(logger)
+	recent := map[int64]bool{}
+	for _, s := range m.searches {
+		if s.lastFetch >= since {
+			for _, id := range s.productIDs {
+				recent[id] = true
+			}
+		}
+	}
+
+	productIDs := []int64{}
+	for id := range recent {
+		if p, found := m.products[id]; found && containsWords(p.Name, words) {
+			productIDs = append(productIDs, id)
+		}
+	}
+	sort.Slice(productIDs, func(i, j int) bool { return productIDs[i] < productIDs[j] })
+
+	options := fuzzy.DefaultOptions(logger)
+	matches := []*fuzzy.Match{}
+	for _, id := range productIDs {
+		if len(matches) == options.Limit {
+			break
+		}
+		matches = append(matches, &fuzzy.Match{ProductID: id, Seller: m.products[id].Seller, Confidence: 1})
+	}
+
+	confidentIDs, confident := fuzzy.Confident(matches, options)
+	if !confident {
+		logger.DEBUG_WARN("%d products close to '%s', not enough to skip scraping", len(matches), searchText)
+		return false
+	}
+
+	for _, id := range confidentIDs {
+		if p, found := m.get(id); found && filter.Matches(p) {
+			*products = append(*products, p)
+		}
+	}
+
+	logger.INFO("Serving '%s' from %d stored products with close names", searchText, len(confidentIDs))
+	return true
+}
+
+func containsWords(name string, words []string) bool {
+	stems := map[string]bool{}
+	for _, token := range text.Tokens(name) {
+		stems[text.Stem(token)] = true
+	}
+	for _, word := range words {
+		if !stems[word] {
+			return false
+		}
+	}
+	return len(words) > 0
+}
+
+func (r *memorySearches) Cached(logger *logger.Logger, products *[]*product.Product, searchTerm string) (ok bool) {
+	m := r.m
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, cached := m.searches[searchTerm]
+	if !cached {
+		return true
+	}
+
+	for _, id := range s.productIDs {
+		if p, found := m.get(id); found {
+			*products = append(*products, p)
+		}
+	}
+	return true
+}
+
+func (r *memorySearches) Add(logger *logger.Logger, searchTerm string, products *[]*product.Product) (ok bool) {
+	m := r.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	seen := map[int64]bool{}
+	productIDs := []int64{}
+	for _, p := range *products {
+		if _, found := m.products[p.ID]; !found {
+			logger.ERROR("Product %d of '%s' isn't stored", p.ID, searchTerm)
+			return false
+		}
+		if !seen[p.ID] {
+			seen[p.ID] = true
+			productIDs = append(productIDs, p.ID)
+		}
+	}
+
+	now := time.Now().Unix()
+	m.searches[searchTerm] = &search{productIDs: productIDs, lastFetch: now}
+
+	m.checkWatches(logger, searchTerm, products, now)
+	return true
+}
+
+// checkWatches queues a notification for every watch that a refresh of searchTerm brought under
+// its target, like query.CheckWatches.
+func (m *Memory) checkWatches(logger *logger.Logger, searchTerm string, products *[]*product.Product, now int64) {
+	productIDs := map[int64]bool{}
+	for _, p := range *products {
+		productIDs[p.ID] = true
+	}
+
+	for _, id := range m.watchIDs() {
+		w := m.watches[id]
+		if w.SearchTerm != searchTerm && !productIDs[w.ProductID] {
+			continue
+		}
+
+		// Check keeps the lowest price notified about on the stored watch
+		n, changed := w.Check(searchTerm, products, now)
+		if !changed || n == nil {
+			continue
+		}
+
+		n.ID = int64(len(m.notifications) + 1)
+		m.notifications = append(m.notifications, &notification{Notification: *n})
+		logger.INFO("Watch %d: %s is %f per %s", w.ID, n.ProductName, n.UnitPrice, n.UnitType)
+	}
+}
+
+// watchIDs are the IDs of every watch, in the order they were added.
+func (m *Memory) watchIDs() (ids []int64) {
+	for id := range m.watches {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+
+type memoryBaskets struct {
+	m *Memory
+}
+
+func (r *memoryBaskets) Add(logger *logger.Logger, clientID string, productID int64) (ok bool) {
+	m := r.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, found := m.products[productID]; !found {
+		logger.ERROR("Product %d isn't stored", productID)
+		return false
+	}
+
+	for _, id := range m.baskets[clientID] {
+		if id == productID {
+			return true
+		}
+	}
+	m.baskets[clientID] = append(m.baskets[clientID], productID)
+	return true
+}
+
+func (r *memoryBaskets) Remove(logger *logger.Logger, clientID string, productID int64) (ok bool) {
+	m := r.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := []int64{}
+	for _, id := range m.baskets[clientID] {
+		if id != productID {
+			kept = append(kept, id)
+		}
+	}
+	if len(kept) == 0 {
+		delete(m.baskets, clientID)
+		return true
+	}
+	m.baskets[clientID] = kept
+	return true
+}
+
+func (r *memoryBaskets) Get(logger *logger.Logger, clientID string, products *[]*product.Product) (ok bool) {
+	m := r.m
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, id := range m.baskets[clientID] {
+		if p, found := m.get(id); found {
+			*products = append(*products, p)
+		}
+	}
+	return true
+}
+
+
+type memoryWatches struct {
+	m *Memory
+}
+
+func (r *memoryWatches) Add(logger *logger.Logger, w *watch.Watch) (ok bool) {
+	m := r.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w.ID = m.nextWatchID
+	m.nextWatchID++
+
+	copied := *w
+	m.watches[w.ID] = &copied
+	return true
+}
+
+func (r *memoryWatches) Remove(logger *logger.Logger, clientID string, watchID int64) (ok bool) {
+	m := r.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if w, found := m.watches[watchID]; found && w.ClientID == clientID {
+		delete(m.watches, watchID)
+	}
+	return true
+}
+
+func (r *memoryWatches) Get(logger *logger.Logger, clientID string, watches *[]*watch.Watch) (ok bool) {
+	m := r.m
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, id := range m.watchIDs() {
+		if w := m.watches[id]; w.ClientID == clientID {
+			copied := *w
+			*watches = append(*watches, &copied)
+		}
+	}
+	return true
+}
+
+func (r *memoryWatches) Inbox(logger *logger.Logger, clientID string, limit int, markRead bool, notifications *[]*watch.Notification) (ok bool) {
+	m := r.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Newest first
+	found := 0
+	for i := len(m.notifications) - 1; i >= 0 && found < limit; i-- {
+		if n := m.notifications[i]; n.ClientID == clientID {
+			copied := n.Notification
+			*notifications = append(*notifications, &copied)
+			found++
+		}
+	}
+
+	if markRead {
+		for _, n := range m.notifications {
+			if n.ClientID == clientID {
+				n.Read = true
+			}
+		}
+	}
+	return true
+}
+
+func (r *memoryWatches) Claim(logger *logger.Logger, limit int, notifications *[]*watch.Notification) (ok bool) {
+	m := r.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().Unix()
+	claimed := 0
+	for _, n := range m.notifications {
+		if claimed == limit {
+			break
+		}
+		if n.delivered || n.Attempts >= watch.MAX_ATTEMPTS || (n.claimedAt != 0 && n.claimedAt >= now-watch.CLAIM_TIMEOUT) {
+			continue
+		}
+
+		n.claimedAt = now
+		n.Attempts++
+		copied := n.Notification
+		*notifications = append(*notifications, &copied)
+		claimed++
+	}
+	return true
+}
+
+func (r *memoryWatches) SetDelivered(logger *logger.Logger, notifications []*watch.Notification, delivered map[int64]bool) (ok bool) {
+	m := r.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, sent := range notifications {
+		for _, n := range m.notifications {
+			if n.ID == sent.ID {
+				n.delivered = delivered[sent.ID]
+				n.claimedAt = 0
+			}
+		}
+	}
+	return true
+}
+
+
+type memoryObservations struct {
+	m *Memory
+}
+
+func (r *memoryObservations) Get(logger *logger.Logger, productID, since int64, observations *[]*history.Observation) (ok bool) {
+	m := r.m
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, o := range m.observations[productID] {
+		if o.ObservedAt >= since {
+			copied := *o
+			*observations = append(*observations, &copied)
+		}
+	}
+	return true
+}
@@ -0,0 +1,255 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/jakubruminski/FYP/go/api/history"
+	"github.com/jakubruminski/FYP/go/api/product"
+	"github.com/jakubruminski/FYP/go/api/watch"
+	"github.com/jakubruminski/FYP/go/utils/logger"
+)
+
+func scrape() *[]*product.Product {
+	return &[]*product.Product{
+		{Seller: "Tesco", Name: "Milk 2L", Price: 2.50, URL: "tesco/milk", EAN: "5000000000001", InStock: true},
+		{Seller: "Tesco", Name: "Skimmed Milk 1L", Price: 1.20, URL: "tesco/skimmed", InStock: true},
+		{Seller: "Dunnes", Name: "Fresh Milk 2L", Price: 2.30, DiscountPrice: 2.00, URL: "dunnes/milk", Relevance: 0.9},
+	}
+}
+
+func TestMemoryProductsAndSearches(t *testing.T) {
+	logger := &logger.Logger{}
+	t.Setenv("SEARCH_EXPIRY_IN_DAYS", "1")
+	memory := NewMemory()
+	repos := &Repositories{&memoryProducts{memory}, &memorySearches{memory}, &memoryBaskets{memory}, &memoryWatches{memory}, &memoryObservations{memory}}
+
+	products := scrape()
+	if !repos.Products.Add(logger, &[]*product.Product{}, products) || !repos.Searches.Add(logger, "milk", products) {
+		t.Fatalf("Failed to store the scrape")
+	}
+	if (*products)[0].ID != 1 || (*products)[2].ID != 3 {
+		t.Fatalf("Expected IDs 1 to 3, but got %d and %d", (*products)[0].ID, (*products)[2].ID)
+	}
+
+	found := &[]*product.Product{}
+	ok, expired, _ := repos.Searches.Products(logger, found, "milk", &product.Filter{DiscountedOnly: true})
+	if !ok || expired || len(*found) != 1 || (*found)[0].Seller != "Dunnes" {
+		t.Fatalf("Expected the Dunnes milk, but got %d products (found %t, expired %t)", len(*found), ok, expired)
+	}
+	if (*found)[0].Relevance != 0 || (*found)[0].LastSeen == 0 {
+		t.Errorf("Expected stored products to keep what the database keeps, but got %+v", *(*found)[0])
+	}
+
+	// Served products are copies
+	(*found)[0].Price = 99
+	cached := &[]*product.Product{}
+	repos.Searches.Cached(logger, cached, "milk")
+	if len(*cached) != 3 || (*cached)[2].Price != 2.30 {
+		t.Errorf("Expected 3 cached products with the stored price, but got %d", len(*cached))
+	}
+
+	// A re-scrape refreshes by URL, keeps the EAN it lost and marks what's gone missing
+	rescrape := &[]*product.Product{
+		{Seller: "Tesco", Name: "Milk 2L", Price: 2.20, URL: "tesco/milk", InStock: true},
+	}
+	if !repos.Products.Add(logger, cached, rescrape) || !repos.Searches.Add(logger, "milk", rescrape) {
+		t.Fatalf("Failed to store the re-scrape")
+	}
+	stored := &[]*product.Product{}
+	repos.Products.Get(logger, stored, []int64{1, 2, 3, 42})
+	if len(*stored) != 3 {
+		t.Fatalf("Expected 3 stored products, but got %d", len(*stored))
+	}
+	if (*stored)[0].Price != 2.20 || (*stored)[0].EAN != "5000000000001" || (*stored)[0].MissingSince != 0 {
+		t.Errorf("Expected product 1 refreshed, but got %+v", *(*stored)[0])
+	}
+	if (*stored)[1].MissingSince == 0 {
+		t.Errorf("Expected product 2 missing")
+	}
+	if (*stored)[2].MissingSince != 0 {
+		t.Errorf("Expected product 3 not missing, Dunnes wasn't scraped")
+	}
+
+	found = &[]*product.Product{}
+	repos.Searches.Products(logger, found, "milk", nil)
+	if len(*found) != 1 {
+		t.Errorf("Expected the re-scrape to replace the results, but got %d products", len(*found))
+	}
+
+	if repos.Searches.Add(logger, "bread", &[]*product.Product{{ID: 42}}) {
+		t.Errorf("Expected results that aren't stored to fail")
+	}
+}
+
+func TestMemoryExpiry(t *testing.T) {
+	logger := &logger.Logger{}
+	memory := NewMemory()
+	searches := &memorySearches{memory}
+
+	products := scrape()
+	(&memoryProducts{memory}).Add(logger, &[]*product.Product{}, products)
+	searches.Add(logger, "milk", products)
+	memory.searches["milk"].lastFetch -= 2 * 24 * 60 * 60
+
+	t.Setenv("SEARCH_EXPIRY_IN_DAYS", "1")
+	found := &[]*product.Product{}
+	ok, expired, _ := searches.Products(logger, found, "milk", nil)
+	if ok || !expired {
+		t.Errorf("Expected results fetched two days ago to have expired")
+	}
+}
+
+func TestMemoryFuzzy(t *testing.T) {
+	logger := &logger.Logger{}
+	t.Setenv("SEARCH_EXPIRY_IN_DAYS", "1")
+	t.Setenv("FUZZY_MIN_RESULTS", "2")
+	t.Setenv("FUZZY_MIN_SELLERS", "2")
+	memory := NewMemory()
+	searches := &memorySearches{memory}
+
+	products := scrape()
+	(&memoryProducts{memory}).Add(logger, &[]*product.Product{}, products)
+	searches.Add(logger, "dairy", products)
+
+	testCases := []struct {
+		searchTerm string
+		expected   int   // products served, 0 when the sellers should be scraped
+	}{
+		{"milks", 3},
+		{"milk%202l", 2},
+		{"skimmed%20milk", 0},   // one seller
+		{"\"milk\"", 0},         // quoted
+		{"bread", 0},
+	}
+
+	for i, tc := range testCases {
+		found := &[]*product.Product{}
+		ok, expired, _ := searches.Products(logger, found, tc.searchTerm, nil)
+		if ok != (tc.expected > 0) || expired || len(*found) != tc.expected {
+			t.Errorf("Test case %d: expected %d products, but got %d (found %t)", i, tc.expected, len(*found), ok)
+		}
+	}
+}
+
+func TestMemoryBaskets(t *testing.T) {
+	logger := &logger.Logger{}
+	memory := NewMemory()
+	baskets := &memoryBaskets{memory}
+	(&memoryProducts{memory}).Add(logger, &[]*product.Product{}, scrape())
+
+	for _, id := range []int64{3, 1, 3, 2} {
+		if !baskets.Add(logger, "client", id) {
+			t.Errorf("Failed to add product %d", id)
+		}
+	}
+	if baskets.Add(logger, "client", 42) {
+		t.Errorf("Expected a product that isn't stored to fail")
+	}
+	baskets.Remove(logger, "client", 1)
+
+	products := &[]*product.Product{}
+	baskets.Get(logger, "client", products)
+	if len(*products) != 2 || (*products)[0].ID != 3 || (*products)[1].ID != 2 {
+		t.Errorf("Expected products 3 and 2, but got %d products", len(*products))
+	}
+
+	other := &[]*product.Product{}
+	baskets.Get(logger, "other", other)
+	if len(*other) != 0 {
+		t.Errorf("Expected another client's basket to be empty, but got %d products", len(*other))
+	}
+}
+
+func TestMemoryWatches(t *testing.T) {
+	logger := &logger.Logger{}
+	memory := NewMemory()
+	products := &memoryProducts{memory}
+	searches := &memorySearches{memory}
+	watches := &memoryWatches{memory}
+
+	milk := &watch.Watch{ClientID: "client", SearchTerm: "milk", TargetUnitPrice: 1.10, UnitType: "litre", Channel: watch.CHANNEL_WEBHOOK, Address: "https://example.com/hook"}
+	bread := &watch.Watch{ClientID: "client", ProductID: 42, TargetUnitPrice: 1, Channel: watch.CHANNEL_INBOX}
+	other := &watch.Watch{ClientID: "other", SearchTerm: "milk", TargetUnitPrice: 5, UnitType: "litre", Channel: watch.CHANNEL_INBOX}
+	for _, w := range []*watch.Watch{milk, bread, other} {
+		if !watches.Add(logger, w) {
+			t.Fatalf("Failed to add watch")
+		}
+	}
+	if milk.ID != 1 || other.ID != 3 {
+		t.Fatalf("Expected IDs 1 to 3, but got %d and %d", milk.ID, other.ID)
+	}
+
+	watches.Remove(logger, "other", bread.ID)   // not theirs
+	watches.Remove(logger, "client", bread.ID)
+	found := &[]*watch.Watch{}
+	watches.Get(logger, "client", found)
+	if len(*found) != 1 || (*found)[0].ID != milk.ID {
+		t.Fatalf("Expected the milk watch to be left, but got %d watches", len(*found))
+	}
+
+	// A refresh of the term brings milk under both targets
+	scraped := &[]*product.Product{
+		{Seller: "Tesco", Name: "Milk 2L", Price: 2.00, PricePerUnit: 1.00, UnitType: "litre", URL: "tesco/milk"},
+	}
+	products.Add(logger, &[]*product.Product{}, scraped)
+	searches.Add(logger, "milk", scraped)
+
+	// The same price again isn't notified twice
+	searches.Add(logger, "milk", scraped)
+
+	inbox := &[]*watch.Notification{}
+	watches.Inbox(logger, "client", 10, true, inbox)
+	if len(*inbox) != 1 || (*inbox)[0].UnitPrice != 1.00 || (*inbox)[0].Read {
+		t.Fatalf("Expected one unread notification at 1.00, but got %d", len(*inbox))
+	}
+	inbox = &[]*watch.Notification{}
+	watches.Inbox(logger, "client", 10, false, inbox)
+	if len(*inbox) != 1 || !(*inbox)[0].Read {
+		t.Errorf("Expected the notification to be read")
+	}
+
+	// Both are claimed once, a failed one is claimed again after it is released
+	claimed := &[]*watch.Notification{}
+	watches.Claim(logger, 10, claimed)
+	if len(*claimed) != 2 || (*claimed)[0].Attempts != 1 {
+		t.Fatalf("Expected two notifications claimed, but got %d", len(*claimed))
+	}
+	again := &[]*watch.Notification{}
+	watches.Claim(logger, 10, again)
+	if len(*again) != 0 {
+		t.Errorf("Expected claimed notifications to be left alone, but got %d", len(*again))
+	}
+
+	watches.SetDelivered(logger, *claimed, map[int64]bool{(*claimed)[0].ID: true})
+	watches.Claim(logger, 10, again)
+	if len(*again) != 1 || (*again)[0].ID != (*claimed)[1].ID || (*again)[0].Attempts != 2 {
+		t.Errorf("Expected the failed notification to be claimed again, but got %d", len(*again))
+	}
+}
+
+func TestMemoryObservations(t *testing.T) {
+	logger := &logger.Logger{}
+	memory := NewMemory()
+	products := &memoryProducts{memory}
+	observations := &memoryObservations{memory}
+
+	products.Add(logger, &[]*product.Product{}, scrape())
+	memory.observations[1][0].ObservedAt -= 2 * 24 * 60 * 60
+
+	rescrape := &[]*product.Product{
+		{Seller: "Tesco", Name: "Milk 2L", Price: 2.20, URL: "tesco/milk", InStock: true},
+	}
+	products.Add(logger, &[]*product.Product{}, rescrape)
+
+	found := &[]*history.Observation{}
+	observations.Get(logger, 1, 0, found)
+	if len(*found) != 2 || (*found)[0].Price != 2.50 || (*found)[1].Price != 2.20 {
+		t.Fatalf("Expected both prices of product 1, oldest first, but got %d observations", len(*found))
+	}
+
+	recent := &[]*history.Observation{}
+	observations.Get(logger, 1, (*found)[1].ObservedAt, recent)
+	if len(*recent) != 1 {
+		t.Errorf("Expected the observation before since to be left out, but got %d", len(*recent))
+	}
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jakubruminski/FYP/go/api/history"
+	"github.com/jakubruminski/FYP/go/api/product"
+	"github.com/jakubruminski/FYP/go/api/query"
+	"github.com/jakubruminski/FYP/go/api/query/query_products"
+	"github.com/jakubruminski/FYP/go/api/watch"
+
+	"github.com/jakubruminski/FYP/go/utils/logger"
+	"github.com/jakubruminski/FYP/go/utils/postgres"
+)
+
+
+// Postgres keeps everything in the database of the pool postgres.Open created.
+type Postgres struct{}
+
+func NewPostgres() *Postgres {
+	return &Postgres{}
+}
+
+func (p *Postgres) InTransaction(
+	logger *logger.Logger,
+	ctx context.Context,
+	options *postgres.TxOptions,
+	transactionFunction TransactionFunction,
+) bool {
+
+	return postgres.ExecuteInTransaction(logger, ctx, options, func(tx *postgres.Tx) bool {
+		repos := &Repositories{
+			Products:     &postgresProducts{tx},
+			Searches:     &postgresSearches{tx},
+			Baskets:      &postgresBaskets{tx},
+			Watches:      &postgresWatches{tx},
+			Observations: &postgresObservations{tx},
+		}
+		return transactionFunction(repos)
+	})
+}
+
+
+type postgresProducts struct {
+	tx *postgres.Tx
+}
+
+func (r *postgresProducts) Add(logger *logger.Logger, oldProducts, products *[]*product.Product) (ok bool) {
+	return query.AddProducts(logger, r.tx, oldProducts, products)
+}
+
+func (r *postgresProducts) Get(logger *logger.Logger, products *[]*product.Product, productIDs []int64) (ok bool) {
+	ids := &[]*int64{}
+	for i := range productIDs {
+		*ids = append(*ids, &productIDs[i])
+	}
+	return query_products.Get(logger, r.tx, products, ids)
+}
+
+
+type postgresSearches struct {
+	tx *postgres.Tx
+}
+
+func (r *postgresSearches) Products(logger *logger.Logger, products *[]*product.Product, searchTerm string, filter *product.Filter) (found, expired, ok bool) {
+	return query.Products(logger, r.tx, products, searchTerm, filter)
+}
+
+func (r *postgresSearches) Cached(logger *logger.Logger, products *[]*product.Product, searchTerm string) (ok bool) {
+	return query.CachedProducts(logger, r.tx, products, searchTerm)
+}
+
+func (r *postgresSearches) Add(logger *logger.Logger, searchTerm string, products *[]*product.Product) (ok bool) {
+	ok = query.AddSearchTerm(logger, r.tx, searchTerm, products)
+	if !ok { return false }
+
+	ok = query.CheckWatches(logger, r.tx, searchTerm, products)
+	if !ok {
+		logger.ERROR("Failed to check watches")
+		return false
+	}
+
+	return true
+}
+
+
+type postgresBaskets struct {
+	tx *postgres.Tx
+}
+
+func (r *postgresBaskets) Add(logger *logger.Logger, clientID string, productID int64) (ok bool) {
+	return query.AddToBaskets(logger, r.tx, clientID, product.Product{ID: productID})
+}
+
+func (r *postgresBaskets) Remove(logger *logger.Logger, clientID string, productID int64) (ok bool) {
+	return query.RemoveFromBasket(logger, r.tx, clientID, product.Product{ID: productID})
+}
+
+func (r *postgresBaskets) Get(logger *logger.Logger, clientID string, products *[]*product.Product) (ok bool) {
+	return query.Baskets(logger, r.tx, clientID, products)
+}
+
+
+type postgresWatches struct {
+	tx *postgres.Tx
+}
+
+func (r *postgresWatches) Add(logger *logger.Logger, w *watch.Watch) (ok bool) {
+	return query.AddWatch(logger, r.tx, w)
+}
+
+func (r *postgresWatches) Remove(logger *logger.Logger, clientID string, watchID int64) (ok bool) {
+	return query.RemoveWatch(logger, r.tx, clientID, watchID)
+}
+
+func (r *postgresWatches) Get(logger *logger.Logger, clientID string, watches *[]*watch.Watch) (ok bool) {
+	return query.Watches(logger, r.tx, clientID, watches)
+}
+
+func (r *postgresWatches) Inbox(logger *logger.Logger, clientID string, limit int, markRead bool, notifications *[]*watch.Notification) (ok bool) {
+	return query.Inbox(logger, r.tx, clientID, limit, markRead, notifications)
+}
+
+func (r *postgresWatches) Claim(logger *logger.Logger, limit int, notifications *[]*watch.Notification) (ok bool) {
+	return query.ClaimNotifications(logger, r.tx, limit, notifications)
+}
+
+func (r *postgresWatches) SetDelivered(logger *logger.Logger, notifications []*watch.Notification, delivered map[int64]bool) (ok bool) {
+	return query.SetDelivered(logger, r.tx, notifications, delivered)
+}
+
+
+type postgresObservations struct {
+	tx *postgres.Tx
+}
+
+func (r *postgresObservations) Get(logger *logger.Logger, productID, since int64, observations *[]*history.Observation) (ok bool) {
+	return query.PriceHistory(logger, r.tx, productID, since, observations)
+}
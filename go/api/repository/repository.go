@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jakubruminski/FYP/go/api/history"
+	"github.com/jakubruminski/FYP/go/api/product"
+	"github.com/jakubruminski/FYP/go/api/watch"
+	"github.com/jakubruminski/FYP/go/utils/logger"
+	"github.com/jakubruminski/FYP/go/utils/postgres"
+)
+
+
+// Products stores what sellers list.
+type Products interface {
+	// Add stores scraped products and sets their IDs. Products already stored under the same URL
+	// are refreshed, and the ones in oldProducts whose seller no longer lists them are marked missing.
+	Add(logger *logger.Logger, oldProducts, products *[]*product.Product) (ok bool)
+
+	// Get appends the stored products with the given IDs. Unknown IDs are left out.
+	Get(logger *logger.Logger, products *[]*product.Product, productIDs []int64) (ok bool)
+}
+
+// Searches caches what searches found, under the normalised search term.
+type Searches interface {
+	// Products appends the cached results of searchTerm that pass filter. found is false when
+	// nothing is cached, expired when the cached results are too old to serve. A term that was
+	// never searched for may be answered from stored products with close names.
+	Products(logger *logger.Logger, products *[]*product.Product, searchTerm string, filter *product.Filter) (found, expired, ok bool)
+
+	// Cached appends every cached result of searchTerm, expired or not, unfiltered.
+	Cached(logger *logger.Logger, products *[]*product.Product, searchTerm string) (ok bool)
+
+	// Add makes products, which must already be stored, the results of searchTerm, replacing
+	// the ones before. Watches on the term or the products are checked against them.
+	Add(logger *logger.Logger, searchTerm string, products *[]*product.Product) (ok bool)
+}
+
+// Baskets holds the products each client saved.
+type Baskets interface {
+	Add(logger *logger.Logger, clientID string, productID int64) (ok bool)
+	Remove(logger *logger.Logger, clientID string, productID int64) (ok bool)
+
+	// Get appends the products in the client's basket, in the order they were added.
+	Get(logger *logger.Logger, clientID string, products *[]*product.Product) (ok bool)
+}
+
+// Watches holds the clients' price alerts and the notifications Searches.Add raises for them.
+type Watches interface {
+	// Add stores a watch and sets its ID.
+	Add(logger *logger.Logger, w *watch.Watch) (ok bool)
+	Remove(logger *logger.Logger, clientID string, watchID int64) (ok bool)
+
+	// Get appends the client's watches, oldest first.
+	Get(logger *logger.Logger, clientID string, watches *[]*watch.Watch) (ok bool)
+
+	// Inbox appends the client's latest notifications, newest first, as they were before
+	// markRead marks all of them read.
+	Inbox(logger *logger.Logger, clientID string, limit int, markRead bool, notifications *[]*watch.Notification) (ok bool)
+
+	// Claim takes up to limit notifications still waiting for their channel, counting an attempt
+	// at each, so they can be sent outside any transaction. Nothing else claims them until
+	// SetDelivered releases them or watch.CLAIM_TIMEOUT passes.
+	Claim(logger *logger.Logger, limit int, notifications *[]*watch.Notification) (ok bool)
+	SetDelivered(logger *logger.Logger, notifications []*watch.Notification, delivered map[int64]bool) (ok bool)
+}
+
+// Observations is the price history Products.Add records with every scrape.
+type Observations interface {
+	// Get appends the observations of a product since a unix time, oldest first.
+	Get(logger *logger.Logger, productID, since int64, observations *[]*history.Observation) (ok bool)
+}
+
+// Repositories are used together, within one transaction of the Store they came from.
+type Repositories struct {
+	Products     Products
+	Searches     Searches
+	Baskets      Baskets
+	Watches      Watches
+	Observations Observations
+}
+
+
+// TransactionFunction does the work of a transaction with repositories taking part in it. It may
+// be run more than once, so it must start from scratch every time.
+type TransactionFunction func(repos *Repositories) bool
+
+// Store is where the server keeps its data, Postgres or memory.
+type Store interface {
+	// InTransaction calls transactionFunction with repositories sharing one transaction, which
+	// is committed when it returns true. Postgres rolls it back otherwise, and runs it again on a
+	// serialisation failure or a deadlock as options allow, nil for postgres.ReadCommitted. Memory
+	// ignores options and keeps what was done before a failure.
+	InTransaction(
+		logger *logger.Logger,
+		ctx context.Context,
+		options *postgres.TxOptions,
+		transactionFunction TransactionFunction,
+	) bool
+}
+
+// Default is the store handlers use. It keeps everything in memory unless main switches it to
+// Postgres, so the server runs without a database and handlers can be tested without one.
+var Default Store = NewMemory()
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jakubruminski/FYP/go/api/query"
+	"github.com/jakubruminski/FYP/go/api/suggest"
+
+	"github.com/jakubruminski/FYP/go/utils/env"
+	"github.com/jakubruminski/FYP/go/utils/http/response"
+	"github.com/jakubruminski/FYP/go/utils/logger"
+	"github.com/jakubruminski/FYP/go/utils/postgres"
+)
+
+type Suggestions struct {
+	Prefix      string                `json:"prefix"`
+	Suggestions []*suggest.Suggestion `json:"suggestions"`
+}
+
+// A search is worth this many product names when ranking suggestions, people mostly want to
+// search again for what others searched for.
+const searchWeight = 10.0
+
+
+// suggestHandler completes prefix from the suggestion index, it never touches the database.
+//
+//  prefix   what has been typed so far
+//  limit    how many suggestions, 10 by default and at most 25
+//
+func suggestHandler(logger *logger.Logger, w http.ResponseWriter, r *http.Request) (jsonResponse []byte, ok bool) {
+	prefix := r.FormValue("prefix")
+
+	limit := 10
+	if r.FormValue("limit") != "" {
+		parsed, err := strconv.Atoi(r.FormValue("limit"))
+		if err != nil || parsed < 1 {
+			logger.ERROR("Invalid limit '%s'", r.FormValue("limit"))
+			response.WriteResponse(logger, w, http.StatusBadRequest, "application/json", "error", "Invalid limit")
+			return nil, true
+		}
+		limit = min(parsed, 25)
+	}
+
+	suggestions := suggest.Default.Suggest(prefix, limit)
+
+	jsonResponse, err := json.Marshal(Suggestions{Prefix: prefix, Suggestions: suggestions})
+	if err != nil {
+		logger.ERROR("Failed to marshal response: %s", err)
+		return nil, false
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonResponse)
+
+	return jsonResponse, true
+}
+
+
+// StartSuggester builds the suggestion index now and rebuilds it every SUGGEST_REFRESH_MINUTES.
+// Without a database it is built from the searches made since the server started. It stops when
+// ctx is done.
+func StartSuggester(logger *logger.Logger, ctx context.Context) {
+	interval := env.GetIntDefault(logger, "SUGGEST_REFRESH_MINUTES", 10)
+
+	refreshSuggestions(logger, ctx)
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				refreshSuggestions(logger, ctx)
+			}
+		}
+	}()
+
+	logger.INFO("Refreshing suggestions every %d minutes", interval)
+}
+
+func refreshSuggestions(logger *logger.Logger, ctx context.Context) {
+	limit := env.GetIntDefault(logger, "SUGGEST_INDEX_SIZE", 50000)
+
+	entries := &[]*suggest.Entry{}
+	if postgres.DB() != nil {
+		ok := postgres.ExecuteInTransaction(logger, ctx, postgres.ReadOnly, func(tx *postgres.Tx) bool {
+			entries = &[]*suggest.Entry{}
+			return query.SuggestionEntries(logger, tx, limit, searchWeight, entries)
+		})
+		if !ok {
+			logger.ERROR("Failed to get suggestions from the database, using recent searches only")
+			entries = &[]*suggest.Entry{}
+		}
+	}
+
+	size := suggest.Default.Refresh(*entries, searchWeight)
+	logger.DEBUG("Suggestion index has %d entries", size)
+}
@@ -0,0 +1,329 @@
+package suggest
+
+import (
+	"html"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jakubruminski/FYP/go/utils/text"
+)
+
+
+const (
+	KIND_SEARCH  = "search"    // something people searched for
+	KIND_PRODUCT = "product"   // the name of a stored product
+)
+
+// Suggestion is one completion of a prefix.
+type Suggestion struct {
+	Text   string  `json:"text"`
+	Kind   string  `json:"kind"`
+	Score  float64 `json:"score"`
+	Typo   bool    `json:"typo,omitempty"`   // matched the prefix with an edit or two
+}
+
+// Entry is something to suggest. Weight ranks it against the others, e.g. how often it was searched.
+type Entry struct {
+	Text   string
+	Kind   string
+	Weight float64
+}
+
+// Words of a product name completions start at, so "mil" finds "Avonmore Fresh Milk" by its third word.
+// Later words are left out, they are mostly sizes and flavours.
+const maxNameWords = 4
+
+// Each trie node keeps its best completions, so a lookup never walks the subtree below it.
+const keep = 10
+
+
+// Index is a trie over normalised text. It is built once and then only read, a refresh builds a
+// new one, so lookups need no locking.
+type Index struct {
+	root *node
+	size int
+}
+
+type node struct {
+	children map[rune]*node
+	best     []*Entry   // highest Weight first, at most keep
+}
+
+func newNode() *node {
+	return &node{children: map[rune]*node{}}
+}
+
+
+// Build indexes the entries. Entries of the same kind with the same text add up their weights,
+// across kinds the higher weight is kept.
+func Build(entries []*Entry) *Index {
+	index := &Index{root: newNode()}
+
+	unique := map[string]*Entry{}
+	for _, e := range entries {
+		key := text.Normalise(e.Text)
+		if key == "" {
+			continue
+		}
+
+		existing, found := unique[key]
+		switch {
+		case !found:
+			copied := *e
+			unique[key] = &copied
+		case existing.Kind == e.Kind:
+			existing.Weight += e.Weight
+		case existing.Weight < e.Weight:
+			copied := *e
+			unique[key] = &copied
+		}
+	}
+
+	// In order, so entries of equal weight always rank the same way
+	keys := make([]string, 0, len(unique))
+	for key := range unique {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		e := unique[key]
+		words := strings.Fields(key)
+		starts := 1
+		if e.Kind == KIND_PRODUCT {
+			starts = min(len(words), maxNameWords)
+		}
+		for i := 0; i < starts; i++ {
+			index.insert(strings.Join(words[i:], " "), e)
+		}
+		index.size++
+	}
+
+	return index
+}
+
+func (index *Index) insert(key string, e *Entry) {
+	n := index.root
+	n.offer(e)
+	for _, r := range key {
+		child, found := n.children[r]
+		if !found {
+			child = newNode()
+			n.children[r] = child
+		}
+		n = child
+		n.offer(e)
+	}
+}
+
+func (n *node) offer(e *Entry) {
+	for _, b := range n.best {
+		if b == e {
+			return
+		}
+	}
+	if len(n.best) == keep && n.best[keep-1].Weight >= e.Weight {
+		return
+	}
+
+	n.best = append(n.best, e)
+	sort.SliceStable(n.best, func(i, j int) bool { return n.best[i].Weight > n.best[j].Weight })
+	if len(n.best) > keep {
+		n.best = n.best[:keep]
+	}
+}
+
+func (index *Index) Len() int {
+	if index == nil {
+		return 0
+	}
+	return index.size
+}
+
+
+// Suggest returns up to limit completions of prefix, best first. Exact prefix matches come first.
+// When there are fewer than limit of them, prefixes within one edit, or two for prefixes of six
+// letters or more, fill up the rest, their scores divided by one more than their distance.
+// Swapping two letters is one edit. Prefixes shorter than three letters are only matched exactly.
+func (index *Index) Suggest(prefix string, limit int) (suggestions []*Suggestion) {
+	suggestions = []*Suggestion{}
+	prefix = text.Normalise(prefix)
+	if index == nil || prefix == "" || limit <= 0 {
+		return suggestions
+	}
+
+	seen := map[*Entry]bool{}
+	add := func(e *Entry, distance int) {
+		if seen[e] {
+			return
+		}
+		seen[e] = true
+		suggestions = append(suggestions, &Suggestion{
+			Text:  e.Text,
+			Kind:  e.Kind,
+			Score: e.Weight / float64(1+distance),
+			Typo:  distance > 0,
+		})
+	}
+
+	if n := index.find(prefix); n != nil {
+		for _, e := range n.best {
+			add(e, 0)
+		}
+	}
+
+	if len(suggestions) < limit && len([]rune(prefix)) >= 3 {
+		maxEdits := 1
+		if len([]rune(prefix)) >= 6 {
+			maxEdits = 2
+		}
+
+		exact := len(suggestions)
+		index.walk(prefix, maxEdits, func(n *node, distance int) {
+			for _, e := range n.best {
+				add(e, distance)
+			}
+		})
+
+		fuzzy := suggestions[exact:]
+		sort.SliceStable(fuzzy, func(i, j int) bool { return fuzzy[i].Score > fuzzy[j].Score })
+	}
+
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
+
+func (index *Index) find(prefix string) *node {
+	n := index.root
+	for _, r := range prefix {
+		child, found := n.children[r]
+		if !found {
+			return nil
+		}
+		n = child
+	}
+	return n
+}
+
+// walk calls found with every node whose path is within maxEdits of prefix, computing the
+// Damerau-Levenshtein distance one row per trie level and leaving branches that can no longer match.
+func (index *Index) walk(prefix string, maxEdits int, found func(n *node, distance int)) {
+	target := []rune(prefix)
+
+	row := make([]int, len(target)+1)
+	for i := range row {
+		row[i] = i
+	}
+
+	var visit func(n *node, r, previousRune rune, previous, beforePrevious []int)
+	visit = func(n *node, r, previousRune rune, previous, beforePrevious []int) {
+		current := make([]int, len(target)+1)
+		current[0] = previous[0] + 1
+
+		lowest := current[0]
+		for i := 1; i <= len(target); i++ {
+			cost := 1
+			if target[i-1] == r {
+				cost = 0
+			}
+			current[i] = min(current[i-1]+1, previous[i]+1, previous[i-1]+cost)
+
+			// Two letters the wrong way round
+			if beforePrevious != nil && i > 1 && target[i-1] == previousRune && target[i-2] == r {
+				current[i] = min(current[i], beforePrevious[i-2]+1)
+			}
+			lowest = min(lowest, current[i])
+		}
+
+		// The closest node on each path is enough, it keeps the best entries below it.
+		// Exact matches were already taken from find.
+		if distance := current[len(target)]; distance <= maxEdits {
+			if distance > 0 {
+				found(n, distance)
+			}
+			return
+		}
+		if lowest > maxEdits {
+			return
+		}
+		for childRune, child := range n.children {
+			visit(child, childRune, r, current, previous)
+		}
+	}
+
+	for r, child := range index.root.children {
+		visit(child, r, 0, row, nil)
+	}
+}
+
+
+// SearchText turns a cached search term, escaped and with "%20" for spaces, into text to suggest.
+// Quoted searches are left out, "" is returned for them.
+func SearchText(searchTerm string) string {
+	if strings.HasPrefix(searchTerm, "\"") {
+		return ""
+	}
+	return strings.TrimSpace(html.UnescapeString(strings.ReplaceAll(searchTerm, "%20", " ")))
+}
+
+
+// Suggester serves suggestions from the latest index. It also counts every search made while the
+// server runs, cached ones included, as the database only records scrapes.
+type Suggester struct {
+	mu     sync.RWMutex
+	index  *Index
+	recent map[string]int
+}
+
+// Default is the suggester the server keeps.
+var Default = NewSuggester()
+
+func NewSuggester() *Suggester {
+	return &Suggester{recent: map[string]int{}}
+}
+
+// At most this many different searches are counted, later new ones are left to the database.
+const maxRecent = 10000
+
+// Record counts a search towards the next refresh.
+func (s *Suggester) Record(searchTerm string) {
+	searchTerm = strings.TrimSpace(searchTerm)
+	if searchTerm == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, found := s.recent[searchTerm]; found || len(s.recent) < maxRecent {
+		s.recent[searchTerm]++
+	}
+}
+
+// Refresh builds a new index from the entries and the recorded searches, each search worth
+// searchWeight, and swaps it in.
+func (s *Suggester) Refresh(entries []*Entry, searchWeight float64) (size int) {
+	s.mu.RLock()
+	for searchTerm, count := range s.recent {
+		entries = append(entries, &Entry{Text: searchTerm, Kind: KIND_SEARCH, Weight: float64(count) * searchWeight})
+	}
+	s.mu.RUnlock()
+
+	index := Build(entries)
+
+	s.mu.Lock()
+	s.index = index
+	s.mu.Unlock()
+
+	return index.Len()
+}
+
+func (s *Suggester) Suggest(prefix string, limit int) []*Suggestion {
+	s.mu.RLock()
+	index := s.index
+	s.mu.RUnlock()
+
+	return index.Suggest(prefix, limit)
+}
@@ -0,0 +1,86 @@
+package suggest
+
+import (
+	"testing"
+)
+
+func TestSuggest(t *testing.T) {
+	index := Build([]*Entry{
+		{Text: "chocolate milk",             Kind: KIND_SEARCH,  Weight: 50},
+		{Text: "milk",                       Kind: KIND_SEARCH,  Weight: 100},
+		{Text: "milk",                       Kind: KIND_SEARCH,  Weight: 20},
+		{Text: "mince pies",                 Kind: KIND_SEARCH,  Weight: 30},
+		{Text: "Avonmore Fresh Milk 2L",     Kind: KIND_PRODUCT, Weight: 3},
+		{Text: "asparagus",                  Kind: KIND_SEARCH,  Weight: 40},
+		{Text: "Tesco Asparagus Tips 125G",  Kind: KIND_PRODUCT, Weight: 1},
+		{Text: "Crème Fraîche",              Kind: KIND_SEARCH,  Weight: 5},
+	})
+
+	if index.Len() != 7 {
+		t.Errorf("Expected 7 entries, but got %d", index.Len())
+	}
+
+	testCases := []struct {
+		prefix   string
+		limit    int
+		expected []string
+		typos    []bool
+	}{
+		{"mi",       10, []string{"milk", "mince pies", "Avonmore Fresh Milk 2L"}, []bool{false, false, false}},
+		{"Milk",     1,  []string{"milk"}, []bool{false}},
+		{"choc",     10, []string{"chocolate milk"}, []bool{false}},
+		{"crème f",  10, []string{"Crème Fraîche"}, []bool{false}},
+		{"creme",    10, []string{"Crème Fraîche"}, []bool{false}},
+
+		// typos
+		{"mlik",     10, []string{"milk", "Avonmore Fresh Milk 2L"}, []bool{true, true}},
+		{"aspargus", 10, []string{"asparagus", "Tesco Asparagus Tips 125G"}, []bool{true, true}},
+
+		{"",         10, []string{}, nil},
+		{"xyz",      10, []string{}, nil},
+	}
+
+	for _, tc := range testCases {
+		suggestions := index.Suggest(tc.prefix, tc.limit)
+		if len(suggestions) != len(tc.expected) {
+			texts := []string{}
+			for _, s := range suggestions {
+				texts = append(texts, s.Text)
+			}
+			t.Errorf("Expected %v, but got %v for '%s'", tc.expected, texts, tc.prefix)
+			continue
+		}
+		for i, s := range suggestions {
+			if s.Text != tc.expected[i] || s.Typo != tc.typos[i] {
+				t.Errorf("Expected '%s' (typo %v) at %d, but got '%s' (typo %v) for '%s'", tc.expected[i], tc.typos[i], i, s.Text, s.Typo, tc.prefix)
+			}
+		}
+	}
+
+	if s := index.Suggest("milk", 1); s[0].Score != 120 {
+		t.Errorf("Expected the two 'milk' searches to add up to 120, but got %f", s[0].Score)
+	}
+}
+
+func TestSuggester(t *testing.T) {
+	suggester := NewSuggester()
+
+	if len(suggester.Suggest("mi", 10)) != 0 {
+		t.Errorf("Expected no suggestions before the first refresh")
+	}
+
+	suggester.Record("milk")
+	suggester.Record("milk")
+	suggester.Record(SearchText("chocolate%20milk"))
+	suggester.Record(SearchText("\"milk\""))
+
+	size := suggester.Refresh([]*Entry{{Text: "mince pies", Kind: KIND_SEARCH, Weight: 15}}, 10)
+	if size != 3 {
+		t.Errorf("Expected 3 entries, but got %d", size)
+	}
+
+	suggestions := suggester.Suggest("mi", 10)
+	if len(suggestions) != 2 || suggestions[0].Text != "milk" || suggestions[0].Score != 20 {
+		t.Errorf("Expected 'milk' with 20 first, but got %v", suggestions)
+	}
+}
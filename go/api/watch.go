@@ -0,0 +1,264 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jakubruminski/FYP/go/api/normalise"
+	"github.com/jakubruminski/FYP/go/api/repository"
+	"github.com/jakubruminski/FYP/go/api/watch"
+
+	"github.com/jakubruminski/FYP/go/utils/env"
+	"github.com/jakubruminski/FYP/go/utils/http/response"
+	"github.com/jakubruminski/FYP/go/utils/logger"
+	"github.com/jakubruminski/FYP/go/utils/postgres"
+	"github.com/jakubruminski/FYP/go/utils/token"
+	"github.com/jakubruminski/FYP/go/utils/unit"
+)
+
+type Watches struct {
+	Watches *[]*watch.Watch `json:"watches"`
+}
+
+type Inbox struct {
+	Notifications *[]*watch.Notification `json:"notifications"`
+	Unread        int                    `json:"unread"`
+}
+
+
+// StartNotifier delivers queued notifications in the background every NOTIFY_INTERVAL_SECONDS,
+// until ctx is done.
+func StartNotifier(logger *logger.Logger, ctx context.Context) {
+	interval := env.GetIntDefault(logger, "NOTIFY_INTERVAL_SECONDS", 60)
+	batchSize := env.GetIntDefault(logger, "NOTIFY_BATCH_SIZE", 50)
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			deliverNotifications(logger, ctx, batchSize)
+		}
+	}()
+
+	logger.INFO("Delivering notifications every %d seconds", interval)
+}
+
+// deliverNotifications claims a batch of notifications and commits, sends them with no
+// transaction open, then records how that went in a second one. Sending can take seconds per
+// notification, row locks aren't held that long.
+func deliverNotifications(logger *logger.Logger, ctx context.Context, batchSize int) {
+	notifications := &[]*watch.Notification{}
+	ok := repository.Default.InTransaction(logger, ctx, nil, func(repos *repository.Repositories) bool {
+		*notifications = (*notifications)[:0]
+		return repos.Watches.Claim(logger, batchSize, notifications)
+	})
+	if !ok {
+		logger.ERROR("Failed to claim notifications")
+		return
+	}
+	if len(*notifications) == 0 {
+		return
+	}
+
+	delivered := map[int64]bool{}
+	for _, n := range *notifications {
+		delivered[n.ID] = watch.Send(logger, n)
+		if !delivered[n.ID] {
+			logger.WARN("Failed to deliver notification %d over %s, attempt %d", n.ID, n.Channel, n.Attempts)
+		}
+	}
+
+	ok = repository.Default.InTransaction(logger, ctx, nil, func(repos *repository.Repositories) bool {
+		return repos.Watches.SetDelivered(logger, *notifications, delivered)
+	})
+	if !ok {
+		logger.ERROR("Failed to record which notifications were delivered, they are claimed again once the claim times out")
+	}
+}
+
+
+// watchHandler adds a watch for the client.
+//
+//  product_id or search_term   what to watch
+//  target_unit_price           notify at or below this price per unit
+//  unit_type                   the unit of the target, e.g. kg, litre or each, or a dimension
+//                              such as mass. Needed for search terms, optional for a product
+//  channel                     inbox (default), webhook or email
+//  address                     the webhook URL or email address
+//
+func watchHandler(logger *logger.Logger, w http.ResponseWriter, r *http.Request) (jsonResponse []byte, ok bool) {
+	clientID, ok := watchClient(logger, r)
+	if !ok { return nil, ok }
+
+	newWatch := &watch.Watch{
+		ClientID:  clientID,
+		Channel:   strings.ToLower(strings.TrimSpace(r.FormValue("channel"))),
+		Address:   strings.TrimSpace(r.FormValue("address")),
+		CreatedAt: time.Now().Unix(),
+	}
+	if newWatch.Channel == "" {
+		newWatch.Channel = watch.CHANNEL_INBOX
+	}
+	if r.FormValue("search_term") != "" {
+		newWatch.SearchTerm = normalise.Key(logger, parseSearchValue(r.FormValue("search_term")))
+	}
+
+	var err error
+	if r.FormValue("product_id") != "" {
+		newWatch.ProductID, err = strconv.ParseInt(r.FormValue("product_id"), 10, 64)
+	}
+	if err == nil {
+		newWatch.TargetUnitPrice, err = strconv.ParseFloat(r.FormValue("target_unit_price"), 64)
+	}
+	if err == nil {
+		newWatch.UnitType, err = parseWatchUnit(r.FormValue("unit_type"))
+	}
+	if err == nil {
+		err = newWatch.Validate(logger)
+	}
+	if err != nil {
+		logger.ERROR("Invalid watch. Reason: %s", err)
+		response.WriteResponse(logger, w, http.StatusBadRequest, "application/json", "error", "Invalid watch: "+err.Error())
+		return nil, true
+	}
+
+	ok = repository.Default.InTransaction(logger, r.Context(), nil, func(repos *repository.Repositories) bool {
+		return repos.Watches.Add(logger, newWatch)
+	})
+	if !ok {
+		logger.ERROR("Failed to add watch")
+		return nil, false
+	}
+
+	return writeJSON(logger, w, newWatch)
+}
+
+
+// parseWatchUnit reads the unit of a target as the canonical unit of its dimension, kg for grams,
+// so it compares with every product priced by weight.
+func parseWatchUnit(text string) (unitType string, err error) {
+	text = strings.ToLower(strings.TrimSpace(text))
+	if text == "" {
+		return "", nil
+	}
+
+	for _, dimension := range unit.Dimensions {
+		if string(dimension) == text {
+			return unit.Canonical(dimension).Name, nil
+		}
+	}
+	if u, found := unit.Lookup(text); found {
+		return unit.Canonical(u.Dimension).Name, nil
+	}
+
+	return "", fmt.Errorf("unknown unit_type '%s'", text)
+}
+
+
+func watchesHandler(logger *logger.Logger, w http.ResponseWriter, r *http.Request) (jsonResponse []byte, ok bool) {
+	clientID, ok := watchClient(logger, r)
+	if !ok { return nil, ok }
+
+	watches := &[]*watch.Watch{}
+	ok = repository.Default.InTransaction(logger, r.Context(), postgres.ReadOnly, func(repos *repository.Repositories) bool {
+		*watches = (*watches)[:0]
+		return repos.Watches.Get(logger, clientID, watches)
+	})
+	if !ok {
+		logger.ERROR("Failed to get watches")
+		return nil, false
+	}
+
+	return writeJSON(logger, w, Watches{Watches: watches})
+}
+
+
+func unwatchHandler(logger *logger.Logger, w http.ResponseWriter, r *http.Request) (jsonResponse []byte, ok bool) {
+	clientID, ok := watchClient(logger, r)
+	if !ok { return nil, ok }
+
+	watchID, err := strconv.ParseInt(r.FormValue("watch_id"), 10, 64)
+	if err != nil {
+		logger.ERROR("Invalid watch_id '%s'", r.FormValue("watch_id"))
+		response.WriteResponse(logger, w, http.StatusBadRequest, "application/json", "error", "Invalid watch_id")
+		return nil, true
+	}
+
+	ok = repository.Default.InTransaction(logger, r.Context(), nil, func(repos *repository.Repositories) bool {
+		return repos.Watches.Remove(logger, clientID, watchID)
+	})
+	if !ok {
+		logger.ERROR("Failed to remove watch")
+		return nil, false
+	}
+
+	response.WriteResponse(logger, w, http.StatusOK, "application/json", "message", "Watch removed")
+	return nil, true
+}
+
+
+// inboxHandler returns the client's latest notifications. mark_read=true marks them all as read.
+func inboxHandler(logger *logger.Logger, w http.ResponseWriter, r *http.Request) (jsonResponse []byte, ok bool) {
+	clientID, ok := watchClient(logger, r)
+	if !ok { return nil, ok }
+
+	markRead, _ := strconv.ParseBool(r.FormValue("mark_read"))
+	limit := env.GetIntDefault(logger, "INBOX_SIZE", 50)
+
+	notifications := &[]*watch.Notification{}
+	ok = repository.Default.InTransaction(logger, r.Context(), nil, func(repos *repository.Repositories) bool {
+		*notifications = (*notifications)[:0]
+		return repos.Watches.Inbox(logger, clientID, limit, markRead, notifications)
+	})
+	if !ok {
+		logger.ERROR("Failed to get inbox")
+		return nil, false
+	}
+
+	inbox := Inbox{Notifications: notifications}
+	for _, n := range *notifications {
+		if !n.Read {
+			inbox.Unread++
+		}
+	}
+
+	return writeJSON(logger, w, inbox)
+}
+
+
+// watchClient returns the ID of the client whose watches these are.
+func watchClient(logger *logger.Logger, r *http.Request) (clientID string, ok bool) {
+	clientID, ok = token.GetID(logger, r)
+	if !ok {
+		logger.ERROR("Failed to get client ID")
+		return "", false
+	}
+
+	return clientID, true
+}
+
+func writeJSON(logger *logger.Logger, w http.ResponseWriter, value interface{}) (jsonResponse []byte, ok bool) {
+	jsonResponse, err := json.Marshal(value)
+	if err != nil {
+		logger.ERROR("Failed to marshal response: %s", err)
+		return nil, false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+
+	return jsonResponse, true
+}
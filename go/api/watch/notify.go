@@ -0,0 +1,199 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jakubruminski/FYP/go/utils/env"
+	"github.com/jakubruminski/FYP/go/utils/http/public"
+	"github.com/jakubruminski/FYP/go/utils/logger"
+)
+
+
+// Notifier delivers a notification over one channel. Every notification is kept in the
+// client's inbox whatever its channel, so the inbox notifier has nothing left to do.
+type Notifier interface {
+	Send(logger *logger.Logger, notification *Notification) (ok bool)
+}
+
+var notifiers = map[string]Notifier{
+	CHANNEL_INBOX:   inboxNotifier{},
+	CHANNEL_WEBHOOK: &WebhookNotifier{},
+	CHANNEL_EMAIL:   &SMTPNotifier{},
+}
+
+// Register replaces the notifier of a channel, or adds a new channel.
+func Register(channel string, notifier Notifier) {
+	notifiers[channel] = notifier
+}
+
+// Send delivers a notification over its channel.
+func Send(logger *logger.Logger, notification *Notification) (ok bool) {
+	notifier, ok := notifiers[notification.Channel]
+	if !ok {
+		logger.ERROR("No notifier for channel '%s'", notification.Channel)
+		return false
+	}
+	return notifier.Send(logger, notification)
+}
+
+
+type inboxNotifier struct{}
+
+func (inboxNotifier) Send(logger *logger.Logger, notification *Notification) (ok bool) {
+	return true
+}
+
+
+// WebhookNotifier POSTs the notification as JSON to the watch's address.
+// With WEBHOOK_SECRET set, the body is signed with HMAC-SHA256 in the X-Signature header.
+//
+// Clients choose the address, so without a Client of its own it only connects to public
+// addresses, checked on every connection so a host can't resolve to a public address when the
+// watch is made and to this network when the notification is sent. Redirects are checked the
+// same way. WEBHOOK_ALLOW_PRIVATE=true lifts this, for development.
+type WebhookNotifier struct {
+	Client *http.Client
+}
+
+func (n *WebhookNotifier) Send(logger *logger.Logger, notification *Notification) (ok bool) {
+	err := CheckWebhook(logger, notification.Address)
+	if err != nil {
+		logger.ERROR("Refusing to send webhook. Reason: %s", err)
+		return false
+	}
+
+	body, err := json.Marshal(struct {
+		*Notification
+		Message string `json:"message"`
+	}{notification, notification.Message()})
+	if err != nil {
+		logger.ERROR("Failed to marshal notification. Reason: %s", err)
+		return false
+	}
+
+	req, err := http.NewRequest(http.MethodPost, notification.Address, bytes.NewReader(body))
+	if err != nil {
+		logger.ERROR("Failed to create webhook request. Reason: %s", err)
+		return false
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	secret := env.GetDefault(logger, "WEBHOOK_SECRET", "")
+	if secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	client := n.Client
+	if client == nil {
+		client = webhookClient(logger)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.ERROR("Failed to send webhook to %s. Reason: %s", notification.Address, err)
+		return false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		logger.ERROR("Webhook %s answered with HTTP status code %d", notification.Address, resp.StatusCode)
+		return false
+	}
+
+	return true
+}
+
+
+// CheckWebhook makes sure a webhook address is an http or https URL whose host resolves to public
+// addresses only, not loopback, private, link-local (where cloud metadata services listen) or
+// multicast ones.
+func CheckWebhook(logger *logger.Logger, address string) error {
+	u, err := url.Parse(address)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("webhook address '%s' is not an http or https URL", address)
+	}
+	if allowPrivate(logger) {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return fmt.Errorf("couldn't resolve webhook host '%s': %w", u.Hostname(), err)
+	}
+	for _, addr := range addrs {
+		if !public.IP(addr.IP) {
+			return fmt.Errorf("webhook host '%s' resolves to %s, which isn't a public address", u.Hostname(), addr.IP)
+		}
+	}
+
+	return nil
+}
+
+func allowPrivate(logger *logger.Logger) bool {
+	return env.GetBoolDefault(logger, "WEBHOOK_ALLOW_PRIVATE", false)
+}
+
+// webhookClient refuses to connect to addresses that aren't public, see public.Client.
+func webhookClient(logger *logger.Logger) *http.Client {
+	return public.Client(10*time.Second, allowPrivate(logger))
+}
+
+
+// SMTPNotifier emails the notification through SMTP_ADDR, by default a local relay or test
+// server on localhost:1025. SMTP_USERNAME and SMTP_PASSWORD are only needed by relays that ask.
+type SMTPNotifier struct{}
+
+func (n *SMTPNotifier) Send(logger *logger.Logger, notification *Notification) (ok bool) {
+	addr := env.GetDefault(logger, "SMTP_ADDR", "localhost:1025")
+	from := env.GetDefault(logger, "SMTP_FROM", "alerts@localhost")
+	username := env.GetDefault(logger, "SMTP_USERNAME", "")
+	password := env.GetDefault(logger, "SMTP_PASSWORD", "")
+
+	to := notification.Address
+	if strings.ContainsAny(to, "\r\n") || !strings.Contains(to, "@") {
+		logger.ERROR("Invalid email address '%s'", to)
+		return false
+	}
+
+	var auth smtp.Auth
+	if username != "" {
+		host := addr
+		if i := strings.LastIndex(addr, ":"); i >= 0 {
+			host = addr[:i]
+		}
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	subject := fmt.Sprintf("Price drop: %s", strings.NewReplacer("\r", " ", "\n", " ").Replace(notification.ProductName))
+	message := "From: " + from + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" +
+		notification.Message() + "\r\n"
+
+	err := smtp.SendMail(addr, auth, from, []string{to}, []byte(message))
+	if err != nil {
+		logger.ERROR("Failed to email %s through %s. Reason: %s", to, addr, err)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,178 @@
+package watch
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jakubruminski/FYP/go/utils/logger"
+)
+
+var testNotification = &Notification{
+	ProductName: "Milk 2L",
+	Seller:      "tesco",
+	Currency:    "EUR",
+	UnitPrice:   0.95,
+	UnitType:    "litre",
+	Target:      1.00,
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	logger := &logger.Logger{}
+	t.Setenv("WEBHOOK_SECRET", "secret")
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE", "true")
+
+	var body map[string]interface{}
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get("X-Signature")
+		json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer server.Close()
+
+	notification := *testNotification
+	notification.Channel, notification.Address = CHANNEL_WEBHOOK, server.URL
+
+	ok := Send(logger, &notification)
+	if !ok {
+		t.Fatalf("Expected the webhook to be sent")
+	}
+	if body["product_name"] != "Milk 2L" || !strings.Contains(body["message"].(string), "0.95") {
+		t.Errorf("Expected the webhook body to describe the notification, but got %v", body)
+	}
+	if !strings.HasPrefix(signature, "sha256=") {
+		t.Errorf("Expected a signed webhook, but got signature '%s'", signature)
+	}
+
+	notification.Address = "not a url"
+	if Send(logger, &notification) {
+		t.Errorf("Expected a webhook to an invalid address to fail")
+	}
+
+	// The test server listens on loopback, which clients can't reach
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE", "false")
+	notification.Address = server.URL
+	body = nil
+	if Send(logger, &notification) || body != nil {
+		t.Errorf("Expected a webhook to a loopback address to be refused")
+	}
+}
+
+func TestCheckWebhook(t *testing.T) {
+	logger := &logger.Logger{}
+
+	testCases := []struct {
+		address string
+		valid   bool
+	}{
+		{"https://93.184.215.14/hook", true},
+		{"http://[2606:2800:21f:cb07:6820:80da:af6b:8b2c]/hook", true},
+		{"ftp://93.184.215.14/hook", false},
+		{"https:///hook", false},
+		{"http://127.0.0.1:8080/hook", false},
+		{"http://localhost/hook", false},
+		{"http://10.0.0.5/hook", false},
+		{"http://192.168.1.1/hook", false},
+		{"http://169.254.169.254/latest/meta-data/", false},   // cloud metadata
+		{"http://[::1]/hook", false},
+		{"http://[fe80::1]/hook", false},
+		{"http://0.0.0.0/hook", false},
+	}
+
+	for i, tc := range testCases {
+		err := CheckWebhook(logger, tc.address)
+		if (err == nil) != tc.valid {
+			t.Errorf("Test case %d: expected %s valid to be %v, but got error %v", i, tc.address, tc.valid, err)
+		}
+	}
+}
+
+// The address is checked again when connecting, whatever the host resolved to before.
+func TestWebhookClientRefusesPrivateAddresses(t *testing.T) {
+	logger := &logger.Logger{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	_, err := webhookClient(logger).Get(server.URL)
+	if err == nil || !strings.Contains(err.Error(), "isn't a public address") {
+		t.Errorf("Expected the connection to loopback to be refused, but got %v", err)
+	}
+}
+
+// A minimal SMTP server, enough for net/smtp to deliver one message.
+func TestSMTPNotifier(t *testing.T) {
+	logger := &logger.Logger{}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %s", err)
+	}
+	defer listener.Close()
+	t.Setenv("SMTP_ADDR", listener.Addr().String())
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		reply("220 localhost")
+		data := strings.Builder{}
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(strings.TrimSpace(line))
+
+			switch {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 localhost")
+			case command == "DATA":
+				reply("354 go ahead")
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				reply("250 queued")
+				received <- data.String()
+			case command == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+
+	notification := *testNotification
+	notification.Channel, notification.Address = CHANNEL_EMAIL, "shopper@example.com"
+
+	ok := Send(logger, &notification)
+	if !ok {
+		t.Fatalf("Expected the email to be sent")
+	}
+
+	message := <-received
+	if !strings.Contains(message, "To: shopper@example.com") || !strings.Contains(message, "Subject: Price drop: Milk 2L") {
+		t.Errorf("Expected the email headers, but got:\n%s", message)
+	}
+
+	notification.Address = "shopper@example.com\r\nBcc: x@y.z"
+	if Send(logger, &notification) {
+		t.Errorf("Expected an email address with a line break to be refused")
+	}
+}
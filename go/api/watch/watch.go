@@ -0,0 +1,206 @@
+package watch
+
+import (
+	"fmt"
+
+	"github.com/jakubruminski/FYP/go/api/product"
+
+	"github.com/jakubruminski/FYP/go/utils/logger"
+	"github.com/jakubruminski/FYP/go/utils/unit"
+)
+
+
+const (
+	CHANNEL_INBOX   = "inbox"
+	CHANNEL_WEBHOOK = "webhook"
+	CHANNEL_EMAIL   = "email"
+)
+
+const (
+	// Notifications that failed this many times are given up on. They stay in the inbox.
+	MAX_ATTEMPTS = 5
+
+	// A claimed notification that wasn't marked delivered or failed within this many seconds,
+	// because the instance sending it stopped, is claimed again.
+	CLAIM_TIMEOUT = 10 * 60
+)
+
+// Watch asks to be told when a product, or anything found for a search term,
+// is priced at or below TargetUnitPrice per UnitType.
+type Watch struct {
+	ID                int64   `json:"id"`
+	ClientID          string  `json:"-"`
+	ProductID         int64   `json:"product_id,omitempty"`   // either this
+	SearchTerm        string  `json:"search_term,omitempty"`  // or this
+	TargetUnitPrice   float64 `json:"target_unit_price"`
+
+	// A unit name such as "kilogram". Only products priced in its dimension are compared, their
+	// unit prices converted to it. Search term watches need one, a product watch without one
+	// compares the product in whatever unit it is priced.
+	UnitType          string  `json:"unit_type,omitempty"`
+
+	Channel           string  `json:"channel"`
+	Address           string  `json:"address,omitempty"`      // webhook URL or email address
+	CreatedAt         int64   `json:"created_at"`
+
+	// Lowest unit price already notified about, so the same deal isn't sent on every refresh.
+	// 0 until the first notification.
+	LastNotifiedPrice float64 `json:"last_notified_price"`
+}
+
+type Notification struct {
+	ID          int64   `json:"id"`
+	WatchID     int64   `json:"watch_id"`
+	ClientID    string  `json:"-"`
+	ProductID   int64   `json:"product_id"`
+	ProductName string  `json:"product_name"`
+	Seller      string  `json:"seller"`
+	URL         string  `json:"url"`
+	Currency    string  `json:"currency"`
+	UnitPrice   float64 `json:"unit_price"`
+	UnitType    string  `json:"unit_type"`
+	Target      float64 `json:"target"`
+	CreatedAt   int64   `json:"created_at"`
+	Read        bool    `json:"read"`
+
+	Channel     string  `json:"-"`
+	Address     string  `json:"-"`
+	Attempts    int     `json:"-"`
+}
+
+
+// Validate checks a watch built from a request. A webhook address must resolve to public
+// addresses only, see CheckWebhook.
+func (w *Watch) Validate(logger *logger.Logger) error {
+	if (w.ProductID > 0) == (w.SearchTerm != "") {
+		return fmt.Errorf("watch either a product_id or a search_term")
+	}
+	if w.TargetUnitPrice <= 0 {
+		return fmt.Errorf("target_unit_price must be above 0")
+	}
+
+	if w.UnitType != "" {
+		if _, ok := unit.ByName(w.UnitType); !ok {
+			return fmt.Errorf("unknown unit_type '%s'", w.UnitType)
+		}
+	} else if w.SearchTerm != "" {
+		return fmt.Errorf("a search_term watch needs a unit_type, results are priced per kg, litre, item and so on")
+	}
+
+	switch w.Channel {
+	case CHANNEL_INBOX:
+	case CHANNEL_WEBHOOK, CHANNEL_EMAIL:
+		if w.Address == "" {
+			return fmt.Errorf("channel %s needs an address", w.Channel)
+		}
+		if w.Channel == CHANNEL_WEBHOOK {
+			if err := CheckWebhook(logger, w.Address); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unknown channel '%s'", w.Channel)
+	}
+
+	return nil
+}
+
+// Applies says whether the watch is about the product, found for searchTerm.
+func (w *Watch) Applies(p *product.Product, searchTerm string) bool {
+	if w.ProductID > 0 {
+		return w.ProductID == p.ID
+	}
+	return w.SearchTerm == searchTerm
+}
+
+// UnitPrice is the product's unit price, discounted when there is a discount, per the unit of the
+// watch. ok is false when the product isn't priced in that dimension.
+func (w *Watch) UnitPrice(p *product.Product) (unitPrice float64, ok bool) {
+	unitPrice = p.EffectivePricePerUnit()
+	if unitPrice <= 0 {
+		return 0, false
+	}
+	if w.UnitType == "" {
+		return unitPrice, w.ProductID > 0
+	}
+
+	to, ok := unit.ByName(w.UnitType)
+	if !ok {
+		return 0, false
+	}
+	from, ok := unit.ByName(p.UnitType)
+	if !ok || from.Dimension != to.Dimension {
+		return 0, false
+	}
+
+	perCanonical, ok := unit.PricePerCanonical(unitPrice, unit.Quantity{Value: 1, Unit: from})
+	if !ok {
+		return 0, false
+	}
+	return perCanonical * to.ToCanonical(1), true
+}
+
+// Check looks at the cheapest product the watch applies to. It returns a notification when that
+// is at or below the target and cheaper than anything notified before, and forgets the last
+// notified price once the price goes back above the target, so the next drop is notified again.
+// changed is true when LastNotifiedPrice was updated and needs saving.
+func (w *Watch) Check(searchTerm string, products *[]*product.Product, now int64) (notification *Notification, changed bool) {
+	var cheapest *product.Product
+	var unitPrice float64
+	for _, p := range *products {
+		if !w.Applies(p, searchTerm) {
+			continue
+		}
+		price, ok := w.UnitPrice(p)
+		if !ok {
+			continue
+		}
+		if cheapest == nil || price < unitPrice {
+			cheapest, unitPrice = p, price
+		}
+	}
+
+	if cheapest == nil {
+		return nil, false
+	}
+
+	if unitPrice > w.TargetUnitPrice {
+		if w.LastNotifiedPrice > 0 {
+			w.LastNotifiedPrice = 0
+			return nil, true
+		}
+		return nil, false
+	}
+	if w.LastNotifiedPrice > 0 && unitPrice >= w.LastNotifiedPrice {
+		return nil, false
+	}
+
+	unitType := w.UnitType
+	if unitType == "" {
+		unitType = cheapest.UnitType
+	}
+
+	w.LastNotifiedPrice = unitPrice
+	notification = &Notification{
+		WatchID:     w.ID,
+		ClientID:    w.ClientID,
+		ProductID:   cheapest.ID,
+		ProductName: cheapest.Name,
+		Seller:      cheapest.Seller,
+		URL:         cheapest.URL,
+		Currency:    cheapest.Currency,
+		UnitPrice:   unitPrice,
+		UnitType:    unitType,
+		Target:      w.TargetUnitPrice,
+		CreatedAt:   now,
+		Channel:     w.Channel,
+		Address:     w.Address,
+	}
+	return notification, true
+}
+
+// Message is the text sent by email, and the summary in webhooks.
+func (n *Notification) Message() string {
+	return fmt.Sprintf("%s at %s is now %.2f %s per %s, at or below your target of %.2f.\n%s",
+		n.ProductName, n.Seller, n.UnitPrice, n.Currency, n.UnitType, n.Target, n.URL)
+}
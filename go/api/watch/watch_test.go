@@ -0,0 +1,119 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/jakubruminski/FYP/go/api/product"
+	"github.com/jakubruminski/FYP/go/utils/logger"
+)
+
+func TestCheck(t *testing.T) {
+	w := &Watch{ID: 1, SearchTerm: "milk", TargetUnitPrice: 1.00, UnitType: "litre", Channel: CHANNEL_INBOX}
+
+	refresh := func(prices ...float64) *[]*product.Product {
+		products := []*product.Product{}
+		for i, price := range prices {
+			products = append(products, &product.Product{ID: int64(i + 1), Name: "Milk", PricePerUnit: price, UnitType: "litre"})
+		}
+		return &products
+	}
+
+	testCases := []struct {
+		prices            []float64
+		notify            bool
+		changed           bool
+		lastNotifiedPrice float64
+	}{
+		{[]float64{1.20, 1.10}, false, false, 0},    // above target
+		{[]float64{1.20, 0.95}, true,  true,  0.95}, // dropped to target
+		{[]float64{0.95, 1.20}, false, false, 0.95}, // same deal again
+		{[]float64{0.90},       true,  true,  0.90}, // cheaper still
+		{[]float64{1.05},       false, true,  0},    // back above target
+		{[]float64{0.99},       true,  true,  0.99}, // dropped again
+	}
+
+	for i, tc := range testCases {
+		notification, changed := w.Check("milk", refresh(tc.prices...), 100)
+
+		if (notification != nil) != tc.notify {
+			t.Errorf("Refresh %d: expected a notification to be %v, but got %v", i, tc.notify, notification != nil)
+		}
+		if changed != tc.changed {
+			t.Errorf("Refresh %d: expected changed to be %v, but got %v", i, tc.changed, changed)
+		}
+		if w.LastNotifiedPrice != tc.lastNotifiedPrice {
+			t.Errorf("Refresh %d: expected the last notified price to be %.2f, but got %.2f", i, tc.lastNotifiedPrice, w.LastNotifiedPrice)
+		}
+		if notification != nil && notification.UnitPrice != tc.lastNotifiedPrice {
+			t.Errorf("Refresh %d: expected a notification at %.2f, but got %.2f", i, tc.lastNotifiedPrice, notification.UnitPrice)
+		}
+	}
+}
+
+func TestCheckProduct(t *testing.T) {
+	w := &Watch{ProductID: 2, TargetUnitPrice: 1.00}
+
+	products := &[]*product.Product{
+		{ID: 1, PricePerUnit: 0.50},
+		{ID: 2, PricePerUnit: 1.50, DiscountPricePerUnit: 0.80},
+	}
+
+	notification, _ := w.Check("anything", products, 100)
+	if notification == nil || notification.ProductID != 2 || notification.UnitPrice != 0.80 {
+		t.Errorf("Expected a notification for product 2 at its discounted 0.80, but got %+v", notification)
+	}
+}
+
+// A search finds products priced per kg, per 100g and each, only the ones by weight are compared.
+func TestCheckDimension(t *testing.T) {
+	w := &Watch{SearchTerm: "cheese", TargetUnitPrice: 10.00, UnitType: "kilogram"}
+
+	products := &[]*product.Product{
+		{ID: 1, PricePerUnit: 2.50, UnitType: "each"},
+		{ID: 2, PricePerUnit: 12.00, UnitType: "kilogram"},
+		{ID: 3, PricePerUnit: 0.009, UnitType: "gram"},   // 9.00 per kg
+		{ID: 4, PricePerUnit: 1.00},                      // unknown unit
+	}
+
+	notification, _ := w.Check("cheese", products, 100)
+	if notification == nil || notification.ProductID != 3 || notification.UnitType != "kilogram" {
+		t.Fatalf("Expected a notification for product 3 per kilogram, but got %+v", notification)
+	}
+	if notification.UnitPrice < 8.999 || notification.UnitPrice > 9.001 {
+		t.Errorf("Expected 9.00 per kilogram, but got %f", notification.UnitPrice)
+	}
+
+	w = &Watch{SearchTerm: "cheese", TargetUnitPrice: 3.00, UnitType: "kilogram"}
+	products = &[]*product.Product{{ID: 1, PricePerUnit: 2.50, UnitType: "each"}}
+	if notification, _ := w.Check("cheese", products, 100); notification != nil {
+		t.Errorf("Expected a price per item not to meet a target per kilogram, but got %+v", notification)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	logger := &logger.Logger{}
+
+	testCases := []struct {
+		watch Watch
+		valid bool
+	}{
+		{Watch{SearchTerm: "milk", TargetUnitPrice: 1, UnitType: "litre", Channel: CHANNEL_INBOX}, true},
+		{Watch{ProductID: 3, TargetUnitPrice: 1, Channel: CHANNEL_EMAIL, Address: "a@b.ie"}, true},
+		{Watch{ProductID: 3, SearchTerm: "milk", TargetUnitPrice: 1, UnitType: "litre", Channel: CHANNEL_INBOX}, false},
+		{Watch{TargetUnitPrice: 1, Channel: CHANNEL_INBOX}, false},
+		{Watch{SearchTerm: "milk", UnitType: "litre", Channel: CHANNEL_INBOX}, false},
+		{Watch{SearchTerm: "milk", TargetUnitPrice: 1, Channel: CHANNEL_INBOX}, false},                      // no unit
+		{Watch{SearchTerm: "milk", TargetUnitPrice: 1, UnitType: "furlong", Channel: CHANNEL_INBOX}, false},
+		{Watch{SearchTerm: "milk", TargetUnitPrice: 1, UnitType: "litre", Channel: CHANNEL_WEBHOOK}, false},
+		{Watch{SearchTerm: "milk", TargetUnitPrice: 1, UnitType: "litre", Channel: CHANNEL_WEBHOOK, Address: "https://93.184.215.14/hook"}, true},
+		{Watch{SearchTerm: "milk", TargetUnitPrice: 1, UnitType: "litre", Channel: CHANNEL_WEBHOOK, Address: "http://169.254.169.254/"}, false},
+		{Watch{SearchTerm: "milk", TargetUnitPrice: 1, UnitType: "litre", Channel: "sms"}, false},
+	}
+
+	for i, tc := range testCases {
+		err := tc.watch.Validate(logger)
+		if (err == nil) != tc.valid {
+			t.Errorf("Test case %d: expected valid to be %v, but got error %v", i, tc.valid, err)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS searches;
+DROP TABLE IF EXISTS clients;
+DROP TABLE IF EXISTS products;
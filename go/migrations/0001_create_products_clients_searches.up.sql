@@ -0,0 +1,32 @@
+-- The schema the server created on startup before migrations, so databases it made are adopted as they are.
+
+CREATE TABLE IF NOT EXISTS products (
+	id                                  SERIAL PRIMARY KEY,
+	seller                              VARCHAR(255),
+	name                                VARCHAR(255),
+	currency                            VARCHAR(10),
+	price                               DOUBLE PRECISION,
+	price_per_unit                      DOUBLE PRECISION,
+	discount_price                      DOUBLE PRECISION,
+	discount_price_per_unit             DOUBLE PRECISION,
+	discount_price_in_words             VARCHAR(255),
+	unit_type                           VARCHAR(30),
+	url                                 VARCHAR(255),
+	img_url                             VARCHAR(255)
+);
+
+CREATE TABLE IF NOT EXISTS clients (
+	id                                  SERIAL PRIMARY KEY,
+	client_id                           VARCHAR(255),
+	last_fetch                          INT,
+	product_id                          INT,
+	product_exists                      BOOLEAN
+);
+
+CREATE TABLE IF NOT EXISTS searches (
+	search_term                         VARCHAR(255),
+	product_id                          INT,
+	fetch_count                         INT,
+	last_fetch                          INT,
+	expiry                              INT
+);
@@ -0,0 +1,5 @@
+ALTER TABLE products DROP COLUMN IF EXISTS in_stock;
+ALTER TABLE products DROP COLUMN IF EXISTS category;
+ALTER TABLE products DROP COLUMN IF EXISTS own_brand;
+ALTER TABLE products DROP COLUMN IF EXISTS brand;
+ALTER TABLE products DROP COLUMN IF EXISTS ean;
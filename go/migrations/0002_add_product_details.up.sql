@@ -0,0 +1,5 @@
+ALTER TABLE products ADD COLUMN IF NOT EXISTS ean       VARCHAR(14);
+ALTER TABLE products ADD COLUMN IF NOT EXISTS brand     VARCHAR(100);
+ALTER TABLE products ADD COLUMN IF NOT EXISTS own_brand BOOLEAN DEFAULT FALSE;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS category  VARCHAR(100);
+ALTER TABLE products ADD COLUMN IF NOT EXISTS in_stock  BOOLEAN DEFAULT TRUE;
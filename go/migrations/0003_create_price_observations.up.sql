@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS price_observations (
+	id                                  SERIAL PRIMARY KEY,
+	product_id                          INT NOT NULL,
+	seller                              VARCHAR(255),
+	observed_at                         BIGINT NOT NULL,
+	currency                            VARCHAR(10),
+	price                               DOUBLE PRECISION,
+	price_per_unit                      DOUBLE PRECISION,
+	discount_price                      DOUBLE PRECISION,
+	discount_price_per_unit             DOUBLE PRECISION,
+	discount_price_in_words             VARCHAR(255),
+	unit_type                           VARCHAR(30)
+);
+
+CREATE INDEX IF NOT EXISTS price_observations_product_observed ON price_observations (product_id, observed_at);
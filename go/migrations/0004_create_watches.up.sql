@@ -0,0 +1,36 @@
+CREATE TABLE IF NOT EXISTS watches (
+	id                                  SERIAL PRIMARY KEY,
+	client_id                           VARCHAR(255) NOT NULL,
+	product_id                          INT,
+	search_term                         VARCHAR(255),
+	target_unit_price                   DOUBLE PRECISION NOT NULL,
+	channel                             VARCHAR(20) NOT NULL,
+	address                             VARCHAR(255),
+	created_at                          BIGINT NOT NULL,
+	last_notified_price                 DOUBLE PRECISION DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS notifications (
+	id                                  SERIAL PRIMARY KEY,
+	watch_id                            INT NOT NULL,
+	client_id                           VARCHAR(255) NOT NULL,
+	product_id                          INT,
+	product_name                        VARCHAR(255),
+	seller                              VARCHAR(255),
+	url                                 VARCHAR(255),
+	currency                            VARCHAR(10),
+	unit_price                          DOUBLE PRECISION,
+	unit_type                           VARCHAR(30),
+	target                              DOUBLE PRECISION,
+	channel                             VARCHAR(20),
+	address                             VARCHAR(255),
+	created_at                          BIGINT NOT NULL,
+	read                                BOOLEAN DEFAULT FALSE,
+	delivered                           BOOLEAN DEFAULT FALSE,
+	attempts                            INT DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS watches_search_term       ON watches (search_term);
+CREATE INDEX IF NOT EXISTS watches_product_id        ON watches (product_id);
+CREATE INDEX IF NOT EXISTS notifications_client_id   ON notifications (client_id, created_at);
+CREATE INDEX IF NOT EXISTS notifications_undelivered ON notifications (delivered) WHERE NOT delivered;
@@ -0,0 +1,4 @@
+-- pg_trgm is left enabled, other database objects may use it.
+
+DROP INDEX IF EXISTS products_name_fts;
+DROP INDEX IF EXISTS products_name_trgm;
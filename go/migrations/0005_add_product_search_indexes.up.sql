@@ -0,0 +1,20 @@
+-- Indexes fuzzy search looks names up with. pg_trgm comes with Postgres but not every host lets
+-- it be enabled, without it the trigram index is skipped and FUZZY_SEARCH should be false.
+
+DO $$
+BEGIN
+	CREATE EXTENSION IF NOT EXISTS pg_trgm;
+EXCEPTION WHEN OTHERS THEN
+	RAISE WARNING 'pg_trgm is unavailable, skipping the trigram index: %', SQLERRM;
+END
+$$;
+
+DO $$
+BEGIN
+	IF EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_trgm') THEN
+		CREATE INDEX IF NOT EXISTS products_name_trgm ON products USING GIN (LOWER(name) gin_trgm_ops);
+	END IF;
+END
+$$;
+
+CREATE INDEX IF NOT EXISTS products_name_fts ON products USING GIN (to_tsvector('english', name));
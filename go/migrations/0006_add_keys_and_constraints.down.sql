@@ -0,0 +1,27 @@
+-- Only the constraints and indexes are dropped, merged duplicates stay merged.
+
+DROP INDEX IF EXISTS watches_client_id;
+
+ALTER TABLE notifications      DROP CONSTRAINT IF EXISTS notifications_product_id_fkey;
+ALTER TABLE notifications      DROP CONSTRAINT IF EXISTS notifications_watch_id_fkey;
+ALTER TABLE watches            DROP CONSTRAINT IF EXISTS watches_product_id_fkey;
+ALTER TABLE price_observations DROP CONSTRAINT IF EXISTS price_observations_product_id_fkey;
+
+UPDATE notifications SET watch_id = 0 WHERE watch_id IS NULL;
+ALTER TABLE notifications ALTER COLUMN watch_id SET NOT NULL;
+
+DROP INDEX IF EXISTS clients_product_id;
+ALTER TABLE clients DROP CONSTRAINT IF EXISTS clients_product_id_fkey;
+ALTER TABLE clients DROP CONSTRAINT IF EXISTS clients_client_id_product_id_key;
+ALTER TABLE clients ALTER COLUMN product_id DROP NOT NULL;
+ALTER TABLE clients ALTER COLUMN client_id  DROP NOT NULL;
+
+DROP INDEX IF EXISTS searches_last_fetch;
+DROP INDEX IF EXISTS searches_product_id;
+ALTER TABLE searches DROP CONSTRAINT IF EXISTS searches_product_id_fkey;
+ALTER TABLE searches DROP CONSTRAINT IF EXISTS searches_pkey;
+ALTER TABLE searches ALTER COLUMN fetch_count DROP DEFAULT;
+ALTER TABLE searches ALTER COLUMN product_id  DROP NOT NULL;
+ALTER TABLE searches ALTER COLUMN search_term DROP NOT NULL;
+
+ALTER TABLE products DROP CONSTRAINT IF EXISTS products_url_key;
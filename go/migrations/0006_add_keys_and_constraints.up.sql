@@ -0,0 +1,87 @@
+-- Keys, unique constraints and foreign keys, so the database and not the server keeps products,
+-- searches and baskets consistent. Databases made before this are cleaned up first: duplicate
+-- products are merged into the oldest row, duplicate rows pointing at them are collapsed and rows
+-- pointing at products that no longer exist are dropped.
+
+
+-- Products are identified by their URL. Empty URLs become NULL, they never conflict.
+
+UPDATE products SET url = NULL WHERE url = '';
+
+CREATE TEMPORARY TABLE product_duplicates ON COMMIT DROP AS
+	SELECT id, MIN(id) OVER (PARTITION BY url) AS keep
+	FROM products
+	WHERE url IS NOT NULL;
+
+DELETE FROM product_duplicates WHERE id = keep;
+
+UPDATE searches           s SET product_id = d.keep FROM product_duplicates d WHERE s.product_id = d.id;
+UPDATE clients            c SET product_id = d.keep FROM product_duplicates d WHERE c.product_id = d.id;
+UPDATE price_observations o SET product_id = d.keep FROM product_duplicates d WHERE o.product_id = d.id;
+UPDATE watches            w SET product_id = d.keep FROM product_duplicates d WHERE w.product_id = d.id;
+UPDATE notifications      n SET product_id = d.keep FROM product_duplicates d WHERE n.product_id = d.id;
+
+DELETE FROM products p USING product_duplicates d WHERE p.id = d.id;
+
+ALTER TABLE products ADD CONSTRAINT products_url_key UNIQUE (url);
+
+
+-- A search finds each product once. Every scrape used to add rows of its own, they are collapsed
+-- into one per product, counting the scrapes and keeping the latest.
+
+DELETE FROM searches WHERE search_term IS NULL OR product_id IS NULL OR product_id NOT IN (SELECT id FROM products);
+
+CREATE TEMPORARY TABLE searches_collapsed ON COMMIT DROP AS
+	SELECT search_term, product_id, COUNT(DISTINCT last_fetch)::INT AS fetch_count, MAX(last_fetch) AS last_fetch, MAX(expiry) AS expiry
+	FROM searches
+	GROUP BY search_term, product_id;
+
+DELETE FROM searches;
+INSERT INTO searches (search_term, product_id, fetch_count, last_fetch, expiry)
+	SELECT search_term, product_id, fetch_count, last_fetch, expiry FROM searches_collapsed;
+
+ALTER TABLE searches ALTER COLUMN search_term SET NOT NULL;
+ALTER TABLE searches ALTER COLUMN product_id  SET NOT NULL;
+ALTER TABLE searches ALTER COLUMN fetch_count SET DEFAULT 1;
+
+-- Also the index searches are looked up by search_term with
+ALTER TABLE searches ADD CONSTRAINT searches_pkey PRIMARY KEY (search_term, product_id);
+ALTER TABLE searches ADD CONSTRAINT searches_product_id_fkey FOREIGN KEY (product_id) REFERENCES products (id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS searches_product_id ON searches (product_id);
+CREATE INDEX IF NOT EXISTS searches_last_fetch ON searches (last_fetch);
+
+
+-- A basket holds each product once.
+
+DELETE FROM clients WHERE client_id IS NULL OR product_id IS NULL OR product_id NOT IN (SELECT id FROM products);
+
+DELETE FROM clients c USING clients newer
+	WHERE c.client_id = newer.client_id AND c.product_id = newer.product_id AND c.id < newer.id;
+
+ALTER TABLE clients ALTER COLUMN client_id  SET NOT NULL;
+ALTER TABLE clients ALTER COLUMN product_id SET NOT NULL;
+
+-- Also the index baskets are looked up by client_id with
+ALTER TABLE clients ADD CONSTRAINT clients_client_id_product_id_key UNIQUE (client_id, product_id);
+ALTER TABLE clients ADD CONSTRAINT clients_product_id_fkey FOREIGN KEY (product_id) REFERENCES products (id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS clients_product_id ON clients (product_id);
+
+
+-- Price history and watches go with their product. Notifications stay in the inbox when their
+-- watch or product is removed.
+
+DELETE FROM price_observations WHERE product_id NOT IN (SELECT id FROM products);
+DELETE FROM watches WHERE product_id IS NOT NULL AND product_id NOT IN (SELECT id FROM products);
+
+UPDATE notifications SET product_id = NULL WHERE product_id NOT IN (SELECT id FROM products);
+ALTER TABLE notifications ALTER COLUMN watch_id DROP NOT NULL;
+UPDATE notifications SET watch_id = NULL WHERE watch_id NOT IN (SELECT id FROM watches);
+
+ALTER TABLE price_observations ADD CONSTRAINT price_observations_product_id_fkey FOREIGN KEY (product_id) REFERENCES products (id) ON DELETE CASCADE;
+ALTER TABLE watches            ADD CONSTRAINT watches_product_id_fkey            FOREIGN KEY (product_id) REFERENCES products (id) ON DELETE CASCADE;
+ALTER TABLE notifications      ADD CONSTRAINT notifications_watch_id_fkey        FOREIGN KEY (watch_id)   REFERENCES watches (id)  ON DELETE SET NULL;
+ALTER TABLE notifications      ADD CONSTRAINT notifications_product_id_fkey      FOREIGN KEY (product_id) REFERENCES products (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS watches_client_id ON watches (client_id);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS product_changes;
+
+ALTER TABLE products DROP COLUMN IF EXISTS missing_since;
+ALTER TABLE products DROP COLUMN IF EXISTS last_seen;
@@ -0,0 +1,20 @@
+-- When each product was last listed by its seller, when it stopped being listed, and what
+-- re-scrapes changed about it.
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS last_seen     BIGINT;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS missing_since BIGINT;
+
+UPDATE products p SET last_seen = s.last_fetch
+	FROM (SELECT product_id, MAX(last_fetch) AS last_fetch FROM searches GROUP BY product_id) s
+	WHERE p.id = s.product_id;
+
+CREATE TABLE IF NOT EXISTS product_changes (
+	id                                  SERIAL PRIMARY KEY,
+	product_id                          INT NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+	changed_at                          BIGINT NOT NULL,
+	field                               VARCHAR(50) NOT NULL,
+	old_value                           TEXT,
+	new_value                           TEXT
+);
+
+CREATE INDEX IF NOT EXISTS product_changes_product_changed ON product_changes (product_id, changed_at);
@@ -0,0 +1,12 @@
+ALTER TABLE searches ADD COLUMN fetch_count INT DEFAULT 1;
+ALTER TABLE searches ADD COLUMN expiry      INT;
+
+UPDATE searches s SET fetch_count = t.fetch_count, expiry = t.expiry
+	FROM search_terms t WHERE s.search_term = t.search_term;
+
+ALTER TABLE searches DROP CONSTRAINT searches_search_term_fkey;
+ALTER TABLE searches DROP CONSTRAINT searches_pkey;
+ALTER TABLE searches DROP COLUMN generation;
+ALTER TABLE searches ADD CONSTRAINT searches_pkey PRIMARY KEY (search_term, product_id);
+
+DROP TABLE IF EXISTS search_terms;
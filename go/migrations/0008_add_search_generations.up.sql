@@ -0,0 +1,34 @@
+-- One row per normalised search term, pointing at its current result set. A refresh writes the
+-- next generation of results and moves the pointer in one transaction, so readers see either the
+-- old set or the new one, never a mix.
+
+CREATE TABLE IF NOT EXISTS search_terms (
+	search_term                         VARCHAR(255) PRIMARY KEY,
+	generation                          INT NOT NULL DEFAULT 1,
+	fetch_count                         INT NOT NULL DEFAULT 1,
+	last_fetch                          BIGINT NOT NULL,
+	expiry                              BIGINT NOT NULL
+);
+
+INSERT INTO search_terms (search_term, generation, fetch_count, last_fetch, expiry)
+	SELECT search_term, 1, COALESCE(MAX(fetch_count), 1), COALESCE(MAX(last_fetch), 0), COALESCE(MAX(expiry), 0)
+	FROM searches
+	GROUP BY search_term
+	ON CONFLICT (search_term) DO NOTHING;
+
+-- Only the products found by the latest fetch of each term are its current set
+DELETE FROM searches s USING search_terms t
+	WHERE s.search_term = t.search_term AND COALESCE(s.last_fetch, 0) < t.last_fetch;
+
+ALTER TABLE searches ADD COLUMN generation INT NOT NULL DEFAULT 1;
+ALTER TABLE searches ALTER COLUMN generation DROP DEFAULT;
+
+ALTER TABLE searches DROP CONSTRAINT searches_pkey;
+ALTER TABLE searches ADD CONSTRAINT searches_pkey PRIMARY KEY (search_term, generation, product_id);
+ALTER TABLE searches ADD CONSTRAINT searches_search_term_fkey FOREIGN KEY (search_term) REFERENCES search_terms (search_term) ON DELETE CASCADE;
+
+-- Kept per term now
+ALTER TABLE searches DROP COLUMN fetch_count;
+ALTER TABLE searches DROP COLUMN expiry;
+
+CREATE INDEX IF NOT EXISTS search_terms_expiry ON search_terms (expiry);
@@ -0,0 +1,2 @@
+ALTER TABLE notifications DROP COLUMN claimed_at;
+ALTER TABLE watches DROP COLUMN unit_type;
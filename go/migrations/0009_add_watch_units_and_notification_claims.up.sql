@@ -0,0 +1,17 @@
+-- The unit a watch's target is per. Only products priced in its dimension are compared with it.
+-- Search term watches take the unit of their latest notification, ones never notified stay
+-- without a unit and match nothing until they are made again.
+ALTER TABLE watches ADD COLUMN unit_type VARCHAR(30);
+
+UPDATE watches w SET unit_type = n.unit_type
+	FROM (
+		SELECT DISTINCT ON (watch_id) watch_id, unit_type
+		FROM notifications
+		WHERE unit_type IS NOT NULL AND unit_type <> ''
+		ORDER BY watch_id, id DESC
+	) n
+	WHERE w.id = n.watch_id AND w.search_term IS NOT NULL;
+
+-- Notifications are claimed in one short transaction, sent outside any, and marked delivered in
+-- another. A claim that is never released times out.
+ALTER TABLE notifications ADD COLUMN claimed_at BIGINT;
@@ -0,0 +1,2 @@
+-- Nothing to revert, the code reads ISO codes either way and can't tell which rows held "€".
+SELECT 1;
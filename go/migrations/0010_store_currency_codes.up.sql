@@ -0,0 +1,5 @@
+-- Rows written before currencies were stored as ISO codes hold "€", which readers converted on
+-- every read. Rewritten once here.
+UPDATE products           SET currency = 'EUR' WHERE currency = '€';
+UPDATE price_observations SET currency = 'EUR' WHERE currency = '€';
+UPDATE notifications      SET currency = 'EUR' WHERE currency = '€';
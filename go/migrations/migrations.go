@@ -0,0 +1,10 @@
+// Package migrations holds the database schema as numbered SQL files, NNNN_name.up.sql applies a
+// change and NNNN_name.down.sql reverts it. A new change is a new pair with the next number,
+// files that were released are never edited, the checksums in schema_version would no longer match.
+package migrations
+
+import "embed"
+
+
+//go:embed *.sql
+var Files embed.FS
@@ -3,6 +3,7 @@ package mux
 import (
 	"net/http"
 
+	"github.com/jakubruminski/FYP/go/api/image_proxy"
 	"github.com/jakubruminski/FYP/go/router/request"
 	"github.com/jakubruminski/FYP/go/utils/env"
 	"github.com/jakubruminski/FYP/go/utils/logger"
@@ -60,5 +61,23 @@ func INIT(logger *logger.Logger) (port string, mux *http.ServeMux, ok bool) {
 
 	mux.HandleFunc("/api/get_items", RequestLimiter( logger, request.HandleApiRequest ))
 
+	mux.HandleFunc("/api/compare", RequestLimiter( logger, request.HandleApiRequest ))
+
+	mux.HandleFunc(image_proxy.PATH, RequestLimiter( logger, request.HandleImageRequest ))
+
+	mux.HandleFunc("/api/product/", RequestLimiter( logger, request.HandleApiRequest ))
+
+	mux.HandleFunc("/api/suggest", RequestLimiter( logger, request.HandleApiRequest ))
+
+	mux.HandleFunc("/api/deals", RequestLimiter( logger, request.HandleApiRequest ))
+
+	mux.HandleFunc("/api/watch", RequestLimiter( logger, request.HandleApiRequest ))
+	mux.HandleFunc("/api/watches", RequestLimiter( logger, request.HandleApiRequest ))
+	mux.HandleFunc("/api/unwatch", RequestLimiter( logger, request.HandleApiRequest ))
+	mux.HandleFunc("/api/inbox", RequestLimiter( logger, request.HandleApiRequest ))
+
+	// Not limited, so health checks are answered while every request slot is busy
+	mux.HandleFunc("/api/health", request.HandleHealthRequest)
+
 	return port, mux, true
 }
\ No newline at end of file
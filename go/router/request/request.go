@@ -6,6 +6,7 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/jakubruminski/FYP/go/api"
+	"github.com/jakubruminski/FYP/go/api/image_proxy"
 	
 	"github.com/jakubruminski/FYP/go/utils/env"
 	"github.com/jakubruminski/FYP/go/utils/http/response"
@@ -113,3 +114,24 @@ func handleApiRequest(w http.ResponseWriter, r *http.Request, logger *logger.Log
 
 	return true
 }
+
+// HandleHealthRequest answers health checks without a token or a log file per request.
+func HandleHealthRequest(w http.ResponseWriter, r *http.Request) {
+	logger := &logger.Logger{}
+
+	_, ok := api.HealthHandler(logger, w, r)
+	if !ok {
+		response.WriteResponse(logger, w, http.StatusInternalServerError, "application/json", "error", "Something went wrong, please try again.")
+	}
+}
+
+// HandleImageRequest serves proxied images without a token or a log file per request, a page of
+// results asks for dozens of them.
+func HandleImageRequest(w http.ResponseWriter, r *http.Request) {
+	logger := &logger.Logger{}
+
+	ok := image_proxy.Serve(logger, w, r)
+	if !ok {
+		response.WriteResponse(logger, w, http.StatusInternalServerError, "application/json", "error", "Something went wrong, please try again.")
+	}
+}
@@ -0,0 +1,74 @@
+package currency
+
+import (
+	"strings"
+)
+
+
+type Currency struct {
+	Code    string  // ISO 4217, e.g. "EUR"
+	Symbol  string  // e.g. "€"
+	Name    string  // label shown in the currency dropdown, e.g. "Euro"
+}
+
+// Currencies we can display. Rates for everything except EUR come from the ECB,
+// so a currency the ECB doesn't publish is simply left out of responses.
+var Currencies = []Currency{
+	{Code: "EUR", Symbol: "€",  Name: "Euro"},
+	{Code: "GBP", Symbol: "£",  Name: "UK"},
+	{Code: "USD", Symbol: "$",  Name: "USA"},
+	{Code: "CAD", Symbol: "C$", Name: "Canada"},
+	{Code: "AUD", Symbol: "A$", Name: "Australia"},
+	{Code: "PLN", Symbol: "zł", Name: "Poland"},
+	{Code: "INR", Symbol: "₹",  Name: "India"},
+	{Code: "CRC", Symbol: "₡",  Name: "Costa Rica"},
+	{Code: "CHF", Symbol: "Fr", Name: "Switzerland"},
+}
+
+// Prices are scraped from Irish sellers, so this is what an unlabelled price is in.
+const BASE = "EUR"
+
+
+// Lookup finds a currency by ISO code or symbol, e.g. "EUR", "eur" or "€".
+func Lookup(codeOrSymbol string) (c Currency, ok bool) {
+	codeOrSymbol = strings.TrimSpace(codeOrSymbol)
+
+	for _, c := range Currencies {
+		if strings.EqualFold(c.Code, codeOrSymbol) || c.Symbol == codeOrSymbol {
+			return c, true
+		}
+	}
+	return Currency{}, false
+}
+
+// Code normalises what older rows and clients stored ("€") into an ISO code.
+// Unknown values are returned upper-cased, empty values become BASE.
+func Code(codeOrSymbol string) string {
+	if codeOrSymbol == "" {
+		return BASE
+	}
+	c, ok := Lookup(codeOrSymbol)
+	if !ok {
+		return strings.ToUpper(strings.TrimSpace(codeOrSymbol))
+	}
+	return c.Code
+}
+
+// Symbol returns the display symbol for an ISO code, or the code itself if it has none.
+func Symbol(code string) string {
+	c, ok := Lookup(code)
+	if !ok {
+		return code
+	}
+	return c.Symbol
+}
+
+// IsCode reports whether text is a known ISO code, case-insensitively.
+func IsCode(text string) bool {
+	for _, c := range Currencies {
+		if strings.EqualFold(c.Code, text) {
+			return true
+		}
+	}
+	return false
+}
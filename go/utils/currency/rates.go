@@ -0,0 +1,272 @@
+package currency
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jakubruminski/FYP/go/utils/env"
+	"github.com/jakubruminski/FYP/go/utils/logger"
+)
+
+const (
+	ECB_DAILY_URL = "https://www.ecb.europa.eu/stats/eurofxref/eurofxref-daily.xml"
+
+	// After a failed refresh, don't hit the source again on every request.
+	retryAfter = 10 * time.Minute
+)
+
+
+type Rates struct {
+	Date   string              // ECB reference date, e.g. "2024-03-01"
+	PerEUR map[string]float64  // units of each currency that one euro buys. EUR is always 1
+}
+
+// Rate is how many units of `to` one unit of `from` buys.
+func (r *Rates) Rate(from, to string) (rate float64, ok bool) {
+	fromRate, ok := r.PerEUR[Code(from)]
+	if !ok {
+		return 0.0, false
+	}
+	toRate, ok := r.PerEUR[Code(to)]
+	if !ok {
+		return 0.0, false
+	}
+	return toRate / fromRate, true
+}
+
+func (r *Rates) Convert(amount float64, from, to string) (converted float64, ok bool) {
+	rate, ok := r.Rate(from, to)
+	if !ok {
+		return 0.0, false
+	}
+	return amount * rate, true
+}
+
+
+type Provider struct {
+	// Refreshes outlive the request that started them, so they log through the server's logger
+	logger      *logger.Logger
+
+	mutex       sync.Mutex
+	rates       *Rates
+	nextRefresh time.Time
+
+	// Closed when the refresh in flight is done, nil when there is none
+	refreshing  chan struct{}
+}
+
+// NewProvider makes a provider whose refreshes log through logger, which has to outlive every
+// request, like the one main sets up.
+func NewProvider(logger *logger.Logger) *Provider {
+	return &Provider{logger: logger}
+}
+
+var defaultProvider = NewProvider(&logger.Logger{})
+
+// INIT makes the shared provider log its refreshes through the server's logger.
+func INIT(logger *logger.Logger) {
+	defaultProvider = NewProvider(logger)
+}
+
+
+// GetRates returns the current reference rates from the shared provider.
+func GetRates(logger *logger.Logger) (rates *Rates, ok bool) {
+	return defaultProvider.Get(logger)
+}
+
+// Get returns cached rates, refreshing them from EXCHANGE_RATES_SOURCE once they expire.
+//
+// EXCHANGE_RATES_SOURCE is either a URL or a path to an ECB eurofxref XML file.
+// Every good response is written to EXCHANGE_RATES_CACHE_FILE, which is read back
+// whenever the source can't be reached, e.g. right after a restart without network.
+//
+// The source is read without holding the lock, by one caller at a time. Expired rates are served
+// while they are refreshed, only the very first call waits for rates to be loaded.
+//
+func (p *Provider) Get(logger *logger.Logger) (rates *Rates, ok bool) {
+	p.mutex.Lock()
+	if p.rates != nil && time.Now().Before(p.nextRefresh) {
+		rates = p.rates
+		p.mutex.Unlock()
+		return rates, true
+	}
+
+	if p.refreshing == nil {
+		p.refreshing = make(chan struct{})
+		go p.refresh(p.logger, p.refreshing)
+	}
+	rates, refreshing := p.rates, p.refreshing
+	p.mutex.Unlock()
+
+	if rates != nil {
+		logger.DEBUG("Using exchange rates from %s while they are refreshed", rates.Date)
+		return rates, true
+	}
+
+	<-refreshing
+
+	p.mutex.Lock()
+	rates = p.rates
+	p.mutex.Unlock()
+
+	if rates == nil {
+		return nil, false
+	}
+	return rates, true
+}
+
+// refresh loads the rates from the source, or from the last known file when there are none yet
+// and the source can't be reached, and closes done.
+func (p *Provider) refresh(logger *logger.Logger, done chan struct{}) {
+	source := env.GetDefault(logger, "EXCHANGE_RATES_SOURCE", ECB_DAILY_URL)
+	cacheFile := env.GetDefault(logger, "EXCHANGE_RATES_CACHE_FILE", "/cache/eurofxref-daily.xml")
+	ttlHours := env.GetIntDefault(logger, "EXCHANGE_RATES_TTL_HOURS", 12)
+
+	var rates *Rates
+	nextRefresh := time.Now().Add(time.Duration(ttlHours) * time.Hour)
+
+	data, ok := load(logger, source)
+	if ok {
+		rates, ok = Parse(logger, data)
+	}
+	if ok {
+		saveLastKnown(logger, cacheFile, data)
+		logger.DEBUG("Loaded exchange rates for %s from %s", rates.Date, source)
+	} else {
+		logger.WARN("Failed to refresh exchange rates from %s", source)
+		nextRefresh = time.Now().Add(retryAfter)
+	}
+
+	p.mutex.Lock()
+	defer func() {
+		p.nextRefresh = nextRefresh
+		p.refreshing = nil
+		p.mutex.Unlock()
+		close(done)
+	}()
+
+	if ok {
+		p.rates = rates
+		return
+	}
+
+	if p.rates != nil {
+		logger.WARN("Using exchange rates from %s until the next refresh", p.rates.Date)
+		return
+	}
+
+	data, ok = load(logger, cacheFile)
+	if ok {
+		rates, ok = Parse(logger, data)
+	}
+	if !ok {
+		logger.ERROR("No exchange rates available, last known file %s is missing or invalid", cacheFile)
+		return
+	}
+
+	logger.WARN("Using last known exchange rates from %s", rates.Date)
+	p.rates = rates
+}
+
+
+type ecbEnvelope struct {
+	Cube struct {
+		Days []struct {
+			Time  string `xml:"time,attr"`
+			Rates []struct {
+				Currency string  `xml:"currency,attr"`
+				Rate     float64 `xml:"rate,attr"`
+			} `xml:"Cube"`
+		} `xml:"Cube"`
+	} `xml:"Cube"`
+}
+
+// Parse reads an ECB eurofxref document. Historical files list the newest day first,
+// so the first day is always the one used.
+func Parse(logger *logger.Logger, data []byte) (rates *Rates, ok bool) {
+	var envelope ecbEnvelope
+
+	err := xml.Unmarshal(data, &envelope)
+	if err != nil {
+		logger.ERROR("Failed to parse exchange rates. Reason: %s", err)
+		return nil, false
+	}
+
+	if len(envelope.Cube.Days) == 0 || len(envelope.Cube.Days[0].Rates) == 0 {
+		logger.ERROR("Exchange rates document contains no rates")
+		return nil, false
+	}
+
+	day := envelope.Cube.Days[0]
+	rates = &Rates{Date: day.Time, PerEUR: map[string]float64{"EUR": 1.0}}
+	for _, r := range day.Rates {
+		if r.Rate <= 0 {
+			logger.DEBUG_WARN("Ignoring invalid rate %f for %s", r.Rate, r.Currency)
+			continue
+		}
+		rates.PerEUR[strings.ToUpper(r.Currency)] = r.Rate
+	}
+
+	return rates, true
+}
+
+
+func load(logger *logger.Logger, source string) (data []byte, ok bool) {
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		return download(logger, source)
+	}
+
+	data, err := os.ReadFile(strings.TrimPrefix(source, "file://"))
+	if err != nil {
+		logger.DEBUG_WARN("Failed to read exchange rates from %s. Reason: %s", source, err)
+		return nil, false
+	}
+	return data, true
+}
+
+func download(logger *logger.Logger, source string) (data []byte, ok bool) {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	resp, err := client.Get(source)
+	if err != nil {
+		logger.ERROR("Error sending GET request: %v", err)
+		return nil, false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		logger.ERROR("Received HTTP status code %d for URL %s", resp.StatusCode, source)
+		return nil, false
+	}
+
+	data, err = io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		logger.ERROR("Error reading exchange rates: %v", err)
+		return nil, false
+	}
+
+	return data, true
+}
+
+func saveLastKnown(logger *logger.Logger, cacheFile string, data []byte) {
+	err := os.MkdirAll(filepath.Dir(cacheFile), 0700)
+	if err != nil {
+		logger.DEBUG_WARN("Failed to create directory for %s. Reason: %s", cacheFile, err)
+		return
+	}
+
+	tmp := cacheFile + ".tmp"
+	err = os.WriteFile(tmp, data, 0600)
+	if err == nil {
+		err = os.Rename(tmp, cacheFile)
+	}
+	if err != nil {
+		logger.DEBUG_WARN("Failed to save last known exchange rates to %s. Reason: %s", cacheFile, err)
+	}
+}
@@ -0,0 +1,138 @@
+package currency
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jakubruminski/FYP/go/utils/logger"
+)
+
+const ecbDaily = `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<gesmes:Sender><gesmes:name>European Central Bank</gesmes:name></gesmes:Sender>
+	<Cube>
+		<Cube time='2024-03-01'>
+			<Cube currency='USD' rate='1.0826'/>
+			<Cube currency='GBP' rate='0.85618'/>
+			<Cube currency='PLN' rate='4.3138'/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`
+
+
+func TestConvert(t *testing.T) {
+	logger := &logger.Logger{}
+
+	rates, ok := Parse(logger, []byte(ecbDaily))
+	if !ok {
+		t.Fatalf("Failed to parse ECB document")
+	}
+	if rates.Date != "2024-03-01" {
+		t.Errorf("Expected date 2024-03-01, but got %s", rates.Date)
+	}
+
+	testCases := []struct {
+		amount      float64
+		from        string
+		to          string
+		expected    float64
+		expectedOk  bool
+	}{
+		{10,    "EUR", "USD", 10.826,  true},
+		{10,    "€",   "GBP", 8.5618,  true},
+		{1.0826, "USD", "EUR", 1.0,    true},
+		{0.85618, "GBP", "USD", 1.0826, true},
+		{5,     "EUR", "EUR", 5.0,     true},
+
+		// These should fail
+		{5,     "EUR", "XXX", 0.0,     false},
+		{5,     "CRC", "EUR", 0.0,     false},
+	}
+
+	for _, tc := range testCases {
+		converted, ok := rates.Convert(tc.amount, tc.from, tc.to)
+		if ok != tc.expectedOk {
+			t.Errorf("Expected ok to be %v, but got %v for %s to %s", tc.expectedOk, ok, tc.from, tc.to)
+			continue
+		}
+		if math.Abs(converted-tc.expected) > 1e-9 {
+			t.Errorf("Expected %f, but got %f for %f %s to %s", tc.expected, converted, tc.amount, tc.from, tc.to)
+		}
+	}
+}
+
+func TestFallbackToLastKnown(t *testing.T) {
+	logger := &logger.Logger{}
+	dir := t.TempDir()
+
+	source := filepath.Join(dir, "source.xml")
+	cacheFile := filepath.Join(dir, "last-known.xml")
+	t.Setenv("EXCHANGE_RATES_SOURCE", source)
+	t.Setenv("EXCHANGE_RATES_CACHE_FILE", cacheFile)
+
+	err := os.WriteFile(source, []byte(ecbDaily), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rates, ok := NewProvider(logger).Get(logger)
+	if !ok || rates.PerEUR["USD"] != 1.0826 {
+		t.Fatalf("Failed to load rates from source")
+	}
+
+	// The source disappears, a fresh provider (e.g. after a restart) must use the last known file.
+	os.Remove(source)
+
+	rates, ok = NewProvider(logger).Get(logger)
+	if !ok || rates.PerEUR["USD"] != 1.0826 {
+		t.Errorf("Failed to fall back to last known rates")
+	}
+}
+
+// Expired rates are served while a slow source is downloaded, and replaced once it answers.
+func TestStaleWhileRefreshing(t *testing.T) {
+	logger := &logger.Logger{}
+	t.Setenv("EXCHANGE_RATES_CACHE_FILE", filepath.Join(t.TempDir(), "last-known.xml"))
+
+	release := make(chan struct{})
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		<-release
+		w.Write([]byte(strings.Replace(ecbDaily, "1.0826", "1.1", 1)))
+	}))
+	defer server.Close()
+	t.Setenv("EXCHANGE_RATES_SOURCE", server.URL)
+
+	stale, _ := Parse(logger, []byte(ecbDaily))
+	provider := NewProvider(logger)
+	provider.rates, provider.nextRefresh = stale, time.Now().Add(-time.Minute)
+
+	for i := 0; i < 3; i++ {
+		rates, ok := provider.Get(logger)
+		if !ok || rates.PerEUR["USD"] != 1.0826 {
+			t.Fatalf("Expected the expired rates while refreshing, but got %v", rates)
+		}
+	}
+
+	provider.mutex.Lock()
+	refreshing := provider.refreshing
+	provider.mutex.Unlock()
+	close(release)
+	<-refreshing
+
+	rates, ok := provider.Get(logger)
+	if !ok || rates.PerEUR["USD"] != 1.1 {
+		t.Errorf("Expected the refreshed rates, but got %v", rates)
+	}
+	if requests != 1 {
+		t.Errorf("Expected one download, but got %d", requests)
+	}
+}
@@ -65,4 +65,45 @@ func GetKeys(logger *logger.Logger, v ...*string) (ok bool) {
 	}
 	ok = exists
 	return ok
-}
\ No newline at end of file
+}
+
+// GetDefault behaves like Get, but falls back to defaultValue for optional settings
+// instead of reporting an error.
+func GetDefault(logger *logger.Logger, key, defaultValue string) (value string) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		logger.DEBUG("Environment variable %s not set, using default '%s'", key, defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
+func GetIntDefault(logger *logger.Logger, key string, defaultValue int) (value int) {
+	v := GetDefault(logger, key, strconv.Itoa(defaultValue))
+	value, err := strconv.Atoi(v)
+	if err != nil {
+		logger.WARN("Failed to convert %s to int, using default %d. Reason: %s", key, defaultValue, err)
+		return defaultValue
+	}
+	return value
+}
+
+func GetBoolDefault(logger *logger.Logger, key string, defaultValue bool) (value bool) {
+	v := GetDefault(logger, key, strconv.FormatBool(defaultValue))
+	value, err := strconv.ParseBool(v)
+	if err != nil {
+		logger.WARN("Failed to convert %s to bool, using default %v. Reason: %s", key, defaultValue, err)
+		return defaultValue
+	}
+	return value
+}
+
+func GetFloatDefault(logger *logger.Logger, key string, defaultValue float64) (value float64) {
+	v := GetDefault(logger, key, strconv.FormatFloat(defaultValue, 'f', -1, 64))
+	value, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		logger.WARN("Failed to convert %s to float, using default %f. Reason: %s", key, defaultValue, err)
+		return defaultValue
+	}
+	return value
+}
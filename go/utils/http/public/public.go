@@ -0,0 +1,46 @@
+package public
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+
+// IP is false for addresses inside this network, loopback, private, link-local (where cloud
+// metadata services listen) and multicast ones.
+func IP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
+// Client is for requests to addresses someone else chose. Unless allowPrivate, it refuses to
+// connect to addresses that aren't public. The check runs on the address being dialled, after
+// DNS, for every connection including the ones redirects make, and no proxy is used, which
+// would hide it.
+func Client(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, conn syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !IP(ip) {
+				return fmt.Errorf("refusing to connect to %s, it isn't a public address", host)
+			}
+			return nil
+		}
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+		},
+	}
+}
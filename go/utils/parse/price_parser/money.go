@@ -0,0 +1,298 @@
+package price_parser
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jakubruminski/FYP/go/utils/currency"
+)
+
+
+type Money struct {
+	Amount    float64  // price of the whole offer, e.g. 3.0 for "2 for €3"
+	MaxAmount float64  // upper end of a range like "€1.50 - €2", otherwise equal to Amount
+	Quantity  int      // number of items the amount buys. 1 unless it is a multi-buy
+	Currency  string   // ISO 4217 code, "" if the string doesn't give one
+}
+
+// UnitAmount is the price of a single item, e.g. 1.5 for "2 for €3".
+func (m Money) UnitAmount() float64 {
+	if m.Quantity <= 1 {
+		return m.Amount
+	}
+	return m.Amount / float64(m.Quantity)
+}
+
+func (m Money) IsRange() bool {
+	return m.MaxAmount > m.Amount
+}
+
+
+// ParseMoney reads a price as sellers print it.
+//
+//  "€1.99", "€1,99", "1.299,00", "EUR 4"  -> single amount
+//  "85c", "99p"                            -> cents and pence
+//  "2 for €3", "Any 3 for €10"             -> multi-buy, Quantity is set
+//  "€1.50 - €2.00", "€1 to €2"             -> range, MaxAmount is set
+//
+// Anything after the price, like "/kg" or "Clubcard Price", is ignored.
+//
+func ParseMoney(text string) (money Money, ok bool) {
+	amounts, ok := readAmounts(tokenize(text))
+	if !ok {
+		return Money{}, false
+	}
+
+	first := amounts[0]
+	money = Money{Amount: first.value, MaxAmount: first.value, Quantity: 1, Currency: first.currency}
+
+	if len(amounts) < 2 {
+		return money, true
+	}
+	second := amounts[1]
+
+	if second.joinedBy == tokenFor && first.currency == "" && isWholeNumber(first.value) && first.value >= 1 {
+		money = Money{Amount: second.value, MaxAmount: second.value, Quantity: int(first.value), Currency: second.currency}
+		return money, true
+	}
+
+	if second.joinedBy == tokenRange {
+		if money.Currency == "" {
+			money.Currency = second.currency
+		}
+		money.Amount = math.Min(first.value, second.value)
+		money.MaxAmount = math.Max(first.value, second.value)
+		return money, true
+	}
+
+	return money, true
+}
+
+
+type tokenKind int
+
+const (
+	tokenNumber tokenKind = iota
+	tokenCurrency
+	tokenCent
+	tokenFor
+	tokenRange
+	tokenStop
+	tokenWord
+)
+
+type token struct {
+	kind     tokenKind
+	text     string
+	currency string
+}
+
+type amount struct {
+	value    float64
+	currency string
+	joinedBy tokenKind  // tokenFor or tokenRange if that word came right before this amount
+}
+
+// Cent words give the currency too, unless the string names one itself.
+var centWords = map[string]string{
+	"c":     "EUR",
+	"cent":  "EUR",
+	"cents": "EUR",
+	"p":     "GBP",
+	"pence": "GBP",
+}
+
+
+func tokenize(text string) (tokens []token) {
+	runes := []rune(text)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || (isSeparator(runes[i]) && i+1 < len(runes) && unicode.IsDigit(runes[i+1]))) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: string(runes[start:i])})
+
+		case unicode.IsLetter(r):
+			start := i
+			for i < len(runes) && unicode.IsLetter(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, classifyWord(string(runes[start:i])))
+
+		case r == '-' || r == '–' || r == '—':
+			tokens = append(tokens, token{kind: tokenRange, text: string(r)})
+			i++
+
+		case r == '/':
+			tokens = append(tokens, token{kind: tokenStop, text: string(r)})
+			i++
+
+		default:
+			if c, ok := currency.Lookup(string(r)); ok {
+				tokens = append(tokens, token{kind: tokenCurrency, text: string(r), currency: c.Code})
+			}
+			i++
+		}
+	}
+
+	return tokens
+}
+
+func classifyWord(word string) token {
+	lower := strings.ToLower(word)
+
+	if c, ok := currency.Lookup(word); ok {
+		return token{kind: tokenCurrency, text: word, currency: c.Code}
+	}
+	if code, ok := centWords[lower]; ok {
+		return token{kind: tokenCent, text: word, currency: code}
+	}
+
+	switch lower {
+	case "for":
+		return token{kind: tokenFor, text: word}
+	case "to":
+		return token{kind: tokenRange, text: word}
+	case "per", "each":
+		return token{kind: tokenStop, text: word}
+	}
+
+	return token{kind: tokenWord, text: word}
+}
+
+
+// readAmounts collects up to two amounts, remembering whether "for" or a range
+// joined them. Reading stops at a per-unit marker such as "/" or "per".
+func readAmounts(tokens []token) (amounts []amount, ok bool) {
+	pendingCurrency := ""
+	joinedBy := tokenWord
+
+	for i := 0; i < len(tokens) && len(amounts) < 2; i++ {
+		t := tokens[i]
+
+		switch t.kind {
+		case tokenStop:
+			i = len(tokens)
+
+		case tokenCurrency:
+			pendingCurrency = t.currency
+
+		case tokenFor, tokenRange:
+			if len(amounts) > 0 {
+				joinedBy = t.kind
+			}
+
+		case tokenNumber:
+			value, ok := normaliseNumber(t.text)
+			if !ok {
+				return nil, false
+			}
+
+			code := pendingCurrency
+			if i+1 < len(tokens) && tokens[i+1].kind == tokenCent {
+				value = value / 100
+				if code == "" {
+					code = tokens[i+1].currency
+				}
+				i++
+			} else if i+1 < len(tokens) && tokens[i+1].kind == tokenCurrency && code == "" {
+				code = tokens[i+1].currency
+				i++
+			}
+
+			amounts = append(amounts, amount{value: value, currency: code, joinedBy: joinedBy})
+			pendingCurrency = ""
+			joinedBy = tokenWord
+		}
+	}
+
+	if len(amounts) == 0 {
+		return nil, false
+	}
+	return amounts, true
+}
+
+
+// normaliseNumber turns "1,99", "1.299,00", "1,299.00" or "1'299" into a float.
+//
+// With both '.' and ',' present, whichever comes last is the decimal point.
+// A lone separator followed by exactly three digits is read as a thousands separator,
+// since no seller prices groceries to a tenth of a cent.
+//
+func normaliseNumber(raw string) (value float64, ok bool) {
+	lastDot := strings.LastIndex(raw, ".")
+	lastComma := strings.LastIndex(raw, ",")
+	raw = strings.ReplaceAll(raw, "'", "")
+
+	decimal := ""
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		if lastDot > lastComma {
+			decimal = "."
+		} else {
+			decimal = ","
+		}
+
+	case lastDot >= 0:
+		decimal = decimalSeparator(raw, ".")
+
+	case lastComma >= 0:
+		decimal = decimalSeparator(raw, ",")
+	}
+
+	integerPart, fractionPart := raw, ""
+	if decimal != "" {
+		index := strings.LastIndex(raw, decimal)
+		integerPart, fractionPart = raw[:index], raw[index+1:]
+	}
+	integerPart = strings.NewReplacer(".", "", ",", "").Replace(integerPart)
+
+	if integerPart == "" {
+		integerPart = "0"
+	}
+	normalised := integerPart
+	if fractionPart != "" {
+		normalised += "." + fractionPart
+	}
+
+	value, err := strconv.ParseFloat(normalised, 64)
+	if err != nil || math.IsInf(value, 0) || math.IsNaN(value) {
+		return 0.0, false
+	}
+
+	return value, true
+}
+
+// decimalSeparator decides if the only separator kind in raw is a decimal point.
+func decimalSeparator(raw, separator string) string {
+	if strings.Count(raw, separator) > 1 {
+		return ""
+	}
+
+	index := strings.Index(raw, separator)
+	digitsAfter := len(raw) - index - 1
+	digitsBefore := index
+
+	if digitsAfter == 3 && digitsBefore >= 1 && digitsBefore <= 3 && raw[0] != '0' {
+		return ""
+	}
+	return separator
+}
+
+func isSeparator(r rune) bool {
+	return r == '.' || r == ',' || r == '\''
+}
+
+func isWholeNumber(value float64) bool {
+	return value == math.Trunc(value)
+}
@@ -0,0 +1,153 @@
+package price_parser
+
+import (
+	"math"
+	"testing"
+
+	"github.com/jakubruminski/FYP/go/utils/logger"
+)
+
+func TestParseMoney(t *testing.T) {
+	testCases := []struct {
+		priceAsString      string
+		expectedOk         bool
+		expectedAmount     float64
+		expectedMaxAmount  float64
+		expectedQuantity   int
+		expectedCurrency   string
+	}{
+		{"€5",               true, 5.0,    5.0,    1, "EUR"},
+		{"€5.00",            true, 5.0,    5.0,    1, "EUR"},
+		{"€1,99",            true, 1.99,   1.99,   1, "EUR"},
+		{"1,99 €",           true, 1.99,   1.99,   1, "EUR"},
+		{"€ 2.50",           true, 2.5,    2.5,    1, "EUR"},
+		{"£3.49",            true, 3.49,   3.49,   1, "GBP"},
+		{"$0.99",            true, 0.99,   0.99,   1, "USD"},
+		{"12,50 zł",         true, 12.5,   12.5,   1, "PLN"},
+		{"4.20",             true, 4.2,    4.2,    1, ""},
+
+		// Cent notation
+		{"85c",              true, 0.85,   0.85,   1, "EUR"},
+		{"85 cent",          true, 0.85,   0.85,   1, "EUR"},
+		{"99p",              true, 0.99,   0.99,   1, "GBP"},
+
+		// Thousands separators
+		{"1.299,00",         true, 1299.0, 1299.0, 1, ""},
+		{"€1,299.00",        true, 1299.0, 1299.0, 1, "EUR"},
+		{"€1,299",           true, 1299.0, 1299.0, 1, "EUR"},
+		{"1.299.000",        true, 1299000.0, 1299000.0, 1, ""},
+		{"1'299.50 CHF",     true, 1299.5, 1299.5, 1, "CHF"},
+		{"0,299",            true, 0.299,  0.299,  1, ""},
+
+		// ISO codes
+		{"EUR 4",            true, 4.0,    4.0,    1, "EUR"},
+		{"eur 4,10",         true, 4.1,    4.1,    1, "EUR"},
+		{"3.10 GBP",         true, 3.1,    3.1,    1, "GBP"},
+
+		// Multi-buys
+		{"2 for €3",         true, 3.0,    3.0,    2, "EUR"},
+		{"Any 3 for €10",    true, 10.0,   10.0,   3, "EUR"},
+		{"buy 2 for 5,00 €", true, 5.0,    5.0,    2, "EUR"},
+
+		// Ranges
+		{"€1.50 - €2.00",    true, 1.5,    2.0,    1, "EUR"},
+		{"€2 to €1",         true, 1.0,    2.0,    1, "EUR"},
+		{"1,50 – 2,00 €",    true, 1.5,    2.0,    1, "EUR"},
+
+		// Trailing text is ignored
+		{"€5/kg",            true, 5.0,    5.0,    1, "EUR"},
+		{"€3 Clubcard Price", true, 3.0,   3.0,    1, "EUR"},
+		{"€1.20 each",       true, 1.2,    1.2,    1, "EUR"},
+
+		// These should fail
+		{"",                 false, 0.0,   0.0,    0, ""},
+		{"€",                false, 0.0,   0.0,    0, ""},
+		{"Clubcard Price",   false, 0.0,   0.0,    0, ""},
+	}
+
+	for _, tc := range testCases {
+		money, ok := ParseMoney(tc.priceAsString)
+		if ok != tc.expectedOk {
+			t.Errorf("Expected ok to be %v, but got %v for '%s'", tc.expectedOk, ok, tc.priceAsString)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		if math.Abs(money.Amount-tc.expectedAmount) > 1e-9 {
+			t.Errorf("Expected amount %f, but got %f for '%s'", tc.expectedAmount, money.Amount, tc.priceAsString)
+		}
+		if math.Abs(money.MaxAmount-tc.expectedMaxAmount) > 1e-9 {
+			t.Errorf("Expected max amount %f, but got %f for '%s'", tc.expectedMaxAmount, money.MaxAmount, tc.priceAsString)
+		}
+		if money.Quantity != tc.expectedQuantity {
+			t.Errorf("Expected quantity %d, but got %d for '%s'", tc.expectedQuantity, money.Quantity, tc.priceAsString)
+		}
+		if money.Currency != tc.expectedCurrency {
+			t.Errorf("Expected currency '%s', but got '%s' for '%s'", tc.expectedCurrency, money.Currency, tc.priceAsString)
+		}
+	}
+}
+
+// A multi-buy isn't a shelf price, it is read as what one item costs when bought that way.
+func TestFloatMultiBuy(t *testing.T) {
+	logger := &logger.Logger{}
+
+	_, price, ok := Float(0, logger, "2 for €3")
+	if ok {
+		t.Errorf("Expected a multi-buy not to be read as a shelf price, but got %f", price)
+	}
+
+	_, price, ok = Float(0, logger, "€2.00")
+	if !ok || price != 2.0 {
+		t.Errorf("Expected 2.0, but got %f (ok: %v)", price, ok)
+	}
+
+	testCases := []struct {
+		offer            string
+		expectedPrice    float64
+		expectedQuantity int
+		expectedOk       bool
+	}{
+		{"2 for €3",                       1.5, 2, true},
+		{"Any 3 for €10 Clubcard Price",   10.0 / 3, 3, true},
+		{"buy 4 for €5",                   1.25, 4, true},
+		{"€3",                             0.0, 0, false},
+		{"save 50c",                       0.0, 0, false},
+	}
+
+	for _, tc := range testCases {
+		_, price, quantity, ok := MultiBuy(0, logger, tc.offer)
+		if ok != tc.expectedOk || price != tc.expectedPrice || quantity != tc.expectedQuantity {
+			t.Errorf("Expected %f for %d (ok: %v), but got %f for %d (ok: %v) for '%s'", tc.expectedPrice, tc.expectedQuantity, tc.expectedOk, price, quantity, ok, tc.offer)
+		}
+	}
+}
+
+func FuzzParseMoney(f *testing.F) {
+	seeds := []string{"€1,99", "85c", "1.299,00", "2 for €3", "€1.50 - €2.00", "EUR 4", "€5/kg", "1,2,3", "..,,", "9999999999999999999999"}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, text string) {
+		money, ok := ParseMoney(text)
+		if !ok {
+			return
+		}
+
+		if math.IsNaN(money.Amount) || math.IsInf(money.Amount, 0) || money.Amount < 0 {
+			t.Errorf("Invalid amount %f for '%s'", money.Amount, text)
+		}
+		if money.MaxAmount < money.Amount {
+			t.Errorf("Max amount %f below amount %f for '%s'", money.MaxAmount, money.Amount, text)
+		}
+		if money.Quantity < 1 {
+			t.Errorf("Invalid quantity %d for '%s'", money.Quantity, text)
+		}
+		if money.UnitAmount() > money.Amount {
+			t.Errorf("Unit amount %f above amount %f for '%s'", money.UnitAmount(), money.Amount, text)
+		}
+	})
+}
@@ -2,194 +2,107 @@ package price_parser
 
 import (
 	"regexp"
-	"strconv"
 	"strings"
 
 	"github.com/jakubruminski/FYP/go/utils/logger"
-	"github.com/jakubruminski/FYP/go/utils/parse"
-	"github.com/jakubruminski/FYP/go/utils/slice"
+	"github.com/jakubruminski/FYP/go/utils/unit"
 )
 
 
+// Float reads a single shelf price. currency is the ISO 4217 code, or "" if the string doesn't say.
+// A multi-buy like "2 for €3" is refused, it doesn't say what one item costs on the shelf, read
+// it with MultiBuy instead.
 func Float(index int, logger *logger.Logger, price string) (currency string, priceFloat float64, ok bool) {
-	currency, price, ok = findAndStripCurrency(index, logger, price)
-	if !ok {
-		logger.DEBUG_WARN("%v - Failed to find and strip currency from '%s'", index, price)
-		return "", 0.0, false
-	}
-
-	price = strings.Replace(price, " ", "", -1)
-
-	priceFloat, ok = convertToFloat(index, logger, price)
+	money, ok := ParseMoney(price)
 	if !ok {
 		logger.DEBUG_WARN("%v - Failed to convert string '%s' to float", index, price)
 		return "", 0.0, false
 	}
-	
-	return currency, priceFloat, true
-}
-
 
-func FloatPerUnit(index int, logger *logger.Logger, price string) (currency string, priceFloat float64, pricePerUnit string, ok bool) {
-	currency, price, ok = findAndStripCurrency(index, logger, price)
-	if !ok {
-		logger.DEBUG_WARN("%v - Failed to find and strip currency from '%s'", index, price)
-		return "", 0.0, "", false
+	if money.Quantity > 1 {
+		logger.DEBUG_WARN("%v - '%s' is a multi-buy of %d, not a shelf price", index, price, money.Quantity)
+		return "", 0.0, false
 	}
-
-	parsedPrice, perUnitQuantity, perUnit, measurement, ok := stripMeasurement(index, logger, price)
-	if !ok {
-		logger.DEBUG_WARN("%v - Failed to strip price '%s'", index, price)
-		return currency, 0.0, "", false
+	if money.IsRange() {
+		logger.DEBUG("%v - '%s' is a price range, using the lower end", index, price)
 	}
-	priceFloat, ok = convertPrice(index, logger, parsedPrice, perUnitQuantity, perUnit)
-	if !ok {
-		logger.DEBUG_WARN("%v - Failed to convert price '%s'", index, price)
-		return currency, 0.0, "", false
-	}	
-	
-	return currency, priceFloat, measurement, true
-}
 
-
-func findAndStripCurrency(index int, logger *logger.Logger, price string) (currency, priceStripped string, ok bool) {
-	currency = parse.Find(price, []string{"€", "£", "$"})
-	price   = parse.Strip(price, []string{"€", "£", "$"})
-	return currency, price, true
+	return money.Currency, money.Amount, true
 }
 
-
-func convertToFloat(index int, logger *logger.Logger, price string) (priceFloat float64, ok bool) {
-	priceFloat, err := strconv.ParseFloat(price, 64)
-	if err != nil {
-		logger.DEBUG_WARN("%v - Error converting string '%s' to float", index, price)
-		return 0.0, false
+// MultiBuy reads an offer like "2 for €3" or "Any 3 for €10 Clubcard Price". priceFloat is what
+// one item costs when bought that way, 1.50 for "2 for €3".
+func MultiBuy(index int, logger *logger.Logger, offer string) (currency string, priceFloat float64, quantity int, ok bool) {
+	money, ok := ParseMoney(offer)
+	if !ok || money.Quantity <= 1 {
+		logger.DEBUG_WARN("%v - '%s' is not a multi-buy", index, offer)
+		return "", 0.0, 0, false
 	}
-	
-	return priceFloat, true
-}
 
-// Good To Know: The order of the unit types in the map is ignored when iterated over.
-// Sometimescausing kilograms to be stepped over first of grams, and vice versa.
-//
-var unitTypes_DICT = map[string]map[string][]string{
-    "kilogram": {
-        "kilogram": {"kilograms", "kilogram", "kilo", "kg"},
-        "gram":     {"grams", "gram", "g"},
-    },
-    "litre": {
-        "centilitre": {"centilitres", "centilitre", "cl"},
-        "millilitre": {"millilitres", "millilitre", "ml"},
-        "litre":      {"litres", "litre", "l"},
-    },
-    "each": {
-        "each": {"each", "unit", "item", "items", "sht"},
-    },
+	return money.Currency, money.UnitAmount(), money.Quantity, true
 }
 
 
-func stripMeasurement(index int, logger *logger.Logger, price string) (parsedPrice, perUnitQuantity, perUnit, measurement string, ok bool) {
-	var parsedPriceArray []string  // will look like this later -> ["700", "70", "cl"]
-	if strings.Contains(price, "/") {
-		parsedPriceArray = strings.Split(price, "/")
-	} else if strings.Contains(price, "per") {
-		parsedPriceArray = strings.Split(price, "per")
-	} else {
-		parsedPriceArray = strings.Split(price, " ")
-		if len(parsedPriceArray) == 2 && !slice.ContainsString(unitTypes_DICT["each"]["each"], parsedPriceArray[1]) {
-            logger.DEBUG_WARN("%v - Failed to split price '%s' by '/' or 'per'.", index, price)
-			return "", "", "", "", false
-		}
-	}
+// FloatPerUnit reads a seller's unit price, e.g. "€43 per 70cl" or "€0.02/sht", and
+// normalises it to the canonical unit of its dimension (kilogram, litre, each, metre,
+// square metre, wash or sheet). The canonical unit name is returned as pricePerUnit.
+//
+func FloatPerUnit(index int, logger *logger.Logger, price string) (currency string, priceFloat float64, pricePerUnit string, ok bool) {
+	pricePart, quantityPart, split := splitPerUnit(price)
 
-	if len(parsedPriceArray) != 2 {
-		logger.DEBUG_WARN("%v - Failed to parse price '%s'.", index, price)
-		return "", "", "", "", false
+	money, ok := ParseMoney(pricePart)
+	if !ok {
+		logger.DEBUG_WARN("%v - Failed to find a price in '%s'", index, price)
+		return "", 0.0, "", false
 	}
+	currency = money.Currency
 
-	regexNumeric := regexp.MustCompile(`[0-9.]+`)
-	regexNominal := regexp.MustCompile(`[^0-9.\s]+`)
-
-	logger.DEBUG("%v - Analysing string array '%v'", index, parsedPriceArray)
-
-	for measurement, measurementDict := range unitTypes_DICT {
-		for _, unitTypeSlice := range measurementDict {
-			for _, unit := range unitTypeSlice {
-				parsedPrice = regexNumeric.FindString(parsedPriceArray[0])
-				perUnitQuantity = regexNumeric.FindString(parsedPriceArray[1])
-				perUnit = regexNominal.FindString(parsedPriceArray[1])
-
-				if parsedPrice == "" || perUnit == "" {
-					logger.DEBUG("%v - parsed Price '%s' or perUnit '%s' was empty. Skipping...", index, parsedPrice, perUnit)
-					continue
-				}
-				if !strings.Contains(perUnit, unit) {
-					continue
-				}
-		
-				if perUnitQuantity == "" {
-					perUnitQuantity = "1"
-				}
-
-				logger.DEBUG("%v - Found parsed Price '%s'", index, parsedPrice)
-				logger.DEBUG("%v - Found perUnitQuantity '%s'", index, perUnitQuantity)
-				logger.DEBUG("%v - Found perUnit '%s'", index, perUnit)
-				logger.DEBUG("%v - Found measurement '%s'", index, measurement)
-
-				// Do not uncomment this line, it causes instable unit type recognition
-				// perUnit = unit
-
-				return parsedPrice, perUnitQuantity, perUnit, measurement, true
-			}
-		}
+	if !split {
+		logger.DEBUG_WARN("%v - Failed to split price '%s' by '/' or 'per'.", index, price)
+		return currency, 0.0, "", false
 	}
-	
-	logger.DEBUG("%v - perUnit '%s' did not contain any recognised Unit Type. Skipping...", index, perUnit)
-	return "", "", "unknown", "unknown", false
-}
-
 
-func convertPrice(index int, logger *logger.Logger, parsedPrice, perUnitQuantity, unitType string) (priceFloat float64, ok bool) {
-	parsedPriceFloat, ok := convertToFloat(index, logger, parsedPrice)
+	quantity, ok := unit.ParseQuantity(quantityPart)
 	if !ok {
-		logger.DEBUG_WARN("%v - Failed to convert price per unit '%s' to float", index, parsedPrice)
-		return 0.0, false
+		logger.DEBUG("%v - '%s' did not contain any recognised Unit Type. Skipping...", index, quantityPart)
+		return currency, 0.0, "", false
 	}
 
-	parsedUnitQuantityFloat, ok := convertToFloat(index, logger, perUnitQuantity)
+	priceFloat, ok = unit.PricePerCanonical(money.UnitAmount(), quantity)
 	if !ok {
-		logger.DEBUG_WARN("%v - Failed to convert unit quantity '%s' to float", index, perUnitQuantity)
-		return 0.0, false
+		logger.DEBUG_WARN("%v - Failed to convert price '%s'", index, price)
+		return currency, 0.0, "", false
 	}
 
-	isCentilitre := (slice.ContainsString(unitTypes_DICT["litre"]["centilitre"], unitType))
-	logger.DEBUG("%v - isCentilitre: %v", index, isCentilitre)
+	canonical := unit.Canonical(quantity.Unit.Dimension)
 
-	isGramOrMillilitre := (slice.ContainsString(unitTypes_DICT["kilogram"]["gram"], unitType) || slice.ContainsString(unitTypes_DICT["litre"]["millilitre"], unitType))
-	logger.DEBUG("%v - isGramOrMillilitre: %v", index, isGramOrMillilitre)
+	logger.DEBUG("%v - Found price '%f' per '%f %s', which is '%f' per %s", index, money.UnitAmount(), quantity.Value, quantity.Unit.Name, priceFloat, canonical.Name)
 
-	isKiloOrLitre := (slice.ContainsString(unitTypes_DICT["kilogram"]["kilogram"], unitType) || slice.ContainsString(unitTypes_DICT["litre"]["litre"], unitType))
-	logger.DEBUG("%v - isKiloOrLitre: %v", index, isKiloOrLitre)
-	
-	isEach := slice.ContainsString(unitTypes_DICT["each"]["each"], unitType)
-	logger.DEBUG("%v - isEach: %v", index, isEach)
+	return currency, priceFloat, canonical.Name, true
+}
 
-	
-	if isCentilitre {
-		return (parsedPriceFloat * (100 / parsedUnitQuantityFloat)), true
 
-	} else if isGramOrMillilitre {
-		return (parsedPriceFloat * (1000 / parsedUnitQuantityFloat)), true
+// "per" not following a letter, so not the end of "super" or "paper". "€1.50per kg" still splits.
+var perRegex = regexp.MustCompile(`(?i)(?:^|[^\pL])(per)\s+`)
 
-	} else if isKiloOrLitre {
-		return parsedPriceFloat, true
+// splitPerUnit separates "€43 per 70cl" into "€43" and "70cl".
+// A bare count like "€1.20 each" is split on the space.
+func splitPerUnit(price string) (pricePart, quantityPart string, ok bool) {
+	if before, after, found := strings.Cut(price, "/"); found {
+		return before, after, true
+	}
 
-	} else if isEach {
-		return (parsedPriceFloat * parsedUnitQuantityFloat), true
+	if match := perRegex.FindStringSubmatchIndex(price); match != nil {
+		return strings.TrimSpace(price[:match[2]]), price[match[1]:], true
 	}
 
+	fields := strings.Fields(price)
+	if len(fields) == 2 {
+		u, ok := unit.Lookup(fields[1])
+		if ok && u.Dimension == unit.Count {
+			return fields[0], fields[1], true
+		}
+	}
 
-	logger.DEBUG_WARN("%v - Failed to convert price per unit type '%s'", index, parsedPrice)
-	return 0.0, false
+	return price, "", false
 }
-
@@ -15,21 +15,33 @@ func TestFloat(t *testing.T) {
 		expectedPriceType         string
 		expectedPrice             float64
 	}{
-		{"€43 per 70cl",  "€", "litre", 61.42857142857143},
-		{"€50 per 100cl", "€", "litre", 50.0},
-		{"€5/kg",         "€", "kilogram", 5.0},
-		{"€2/g",          "€", "kilogram", 2000.0},
-		{"€9.68/l",       "€", "litre", 9.68},
+		{"€43 per 70cl",  "EUR", "litre", 61.42857142857143},
+		{"€50 per 100cl", "EUR", "litre", 50.0},
+		{"€5/kg",         "EUR", "kilogram", 5.0},
+		{"€2/g",          "EUR", "kilogram", 2000.0},
+		{"€9.68/l",       "EUR", "litre", 9.68},
 		
-		{"€3/litre",      "€", "litre", 3.0},
-		{"€3/ml",         "€", "litre", 3000.0},
-		{"€0.01/cl",      "€", "litre", 1.0},
+		{"€3/litre",      "EUR", "litre", 3.0},
+		{"€3/ml",         "EUR", "litre", 3000.0},
+		{"€0.01/cl",      "EUR", "litre", 1.0},
 		
-		{"€2/item",       "€", "each", 2.0},
+		{"€2/item",       "EUR", "each", 2.0},
+		{"€1.20 each",    "EUR", "each", 1.2},
+		{"€3/dozen",      "EUR", "each", 0.25},
+
+		{"€1,99/kg",      "EUR", "kilogram", 1.99},
+		{"€0.50 per 100g", "EUR", "kilogram", 5.0},
+		{"€0.02/sht",     "EUR", "sheet", 0.02},
+		{"€0.25/wash",    "EUR", "wash", 0.25},
+		{"€2 PER KG",     "EUR", "kilogram", 2.0},
+		{"Super Saver €2 per kg", "EUR", "kilogram", 2.0},
+		{"€1.50per kg",   "EUR", "kilogram", 1.5},
 
 		// These should fail
-		{"€5",            "€", "", 0.0},
-		{"€5.00",         "€", "", 0.0},
+		{"€5",            "EUR", "", 0.0},
+		{"€5.00",         "EUR", "", 0.0},
+		{"Kitchen paper 4 pack", "", "", 0.0},
+		{"€2 super 4 pack", "EUR", "", 0.0},   // not "per 4 pack"
 
 	}
 
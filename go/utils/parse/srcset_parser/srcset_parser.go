@@ -0,0 +1,121 @@
+package srcset_parser
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+
+type Candidate struct {
+	URL     string
+	Width   int      // "w" descriptor, 0 if not given
+	Density float64  // "x" descriptor, 1 if neither descriptor is given
+}
+
+// Parse splits a srcset attribute into its candidates.
+//
+// A plain URL without descriptors (e.g. the value of a "src" attribute) is returned
+// as a single candidate, so callers don't need to know which attribute they read.
+//
+//  e.g. "https://a/img.jpg?w=90 90w, https://a/img.jpg?w=225 225w"
+//
+func Parse(srcset string) (candidates []Candidate) {
+	input := strings.TrimSpace(srcset)
+
+	for len(input) > 0 {
+		input = strings.TrimLeftFunc(input, func(r rune) bool { return unicode.IsSpace(r) || r == ',' })
+		if input == "" {
+			break
+		}
+
+		// The URL runs until the first whitespace. A trailing comma belongs to the list, not the URL.
+		end := strings.IndexFunc(input, unicode.IsSpace)
+		if end == -1 {
+			end = len(input)
+		}
+		url := input[:end]
+		input = input[end:]
+
+		descriptor := ""
+		if strings.HasSuffix(url, ",") {
+			url = strings.TrimRight(url, ",")
+		} else {
+			comma := strings.Index(input, ",")
+			if comma == -1 {
+				comma = len(input)
+			}
+			descriptor = strings.TrimSpace(input[:comma])
+			input = input[comma:]
+		}
+
+		if url == "" {
+			continue
+		}
+
+		candidate := Candidate{URL: url, Density: 1}
+		parseDescriptor(&candidate, descriptor)
+		candidates = append(candidates, candidate)
+	}
+
+	return candidates
+}
+
+// Best picks the candidate that fits the requested width best.
+//
+// The smallest candidate at least as wide as targetWidth wins. When targetWidth is 0,
+// or nothing is wide enough, the largest candidate is returned.
+//
+func Best(srcset string, targetWidth int) (url string, ok bool) {
+	candidates := Parse(srcset)
+	if len(candidates) == 0 {
+		return "", false
+	}
+
+	largest := candidates[0]
+	var fitting *Candidate
+	for i, c := range candidates {
+		if size(c) > size(largest) {
+			largest = c
+		}
+		if targetWidth > 0 && c.Width >= targetWidth && (fitting == nil || c.Width < fitting.Width) {
+			fitting = &candidates[i]
+		}
+	}
+
+	if fitting != nil {
+		return fitting.URL, true
+	}
+	return largest.URL, true
+}
+
+
+func parseDescriptor(candidate *Candidate, descriptor string) {
+	for _, d := range strings.Fields(descriptor) {
+		if len(d) < 2 {
+			continue
+		}
+		value, suffix := d[:len(d)-1], d[len(d)-1]
+
+		switch suffix {
+		case 'w':
+			width, err := strconv.Atoi(value)
+			if err == nil && width > 0 {
+				candidate.Width = width
+			}
+		case 'x':
+			density, err := strconv.ParseFloat(value, 64)
+			if err == nil && density > 0 {
+				candidate.Density = density
+			}
+		}
+	}
+}
+
+// size orders candidates by width when known, density otherwise.
+func size(c Candidate) float64 {
+	if c.Width > 0 {
+		return float64(c.Width)
+	}
+	return c.Density
+}
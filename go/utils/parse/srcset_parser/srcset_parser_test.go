@@ -0,0 +1,41 @@
+package srcset_parser
+
+import (
+	"testing"
+)
+
+func TestBest(t *testing.T) {
+	tesco := "https://digitalcontent.api.tesco.com/v2/media/ghs/a.jpeg?h=90&w=90 90w, " +
+		"https://digitalcontent.api.tesco.com/v2/media/ghs/a.jpeg?h=225&w=225 225w, " +
+		"https://digitalcontent.api.tesco.com/v2/media/ghs/a.jpeg?h=540&w=540 540w"
+
+	testCases := []struct {
+		srcset       string
+		targetWidth  int
+		expectedURL  string
+		expectedOk   bool
+	}{
+		{tesco, 0,   "https://digitalcontent.api.tesco.com/v2/media/ghs/a.jpeg?h=540&w=540", true},
+		{tesco, 100, "https://digitalcontent.api.tesco.com/v2/media/ghs/a.jpeg?h=225&w=225", true},
+		{tesco, 90,  "https://digitalcontent.api.tesco.com/v2/media/ghs/a.jpeg?h=90&w=90", true},
+		{tesco, 999, "https://digitalcontent.api.tesco.com/v2/media/ghs/a.jpeg?h=540&w=540", true},
+
+		{"https://a/img.png 1x, https://a/img@2x.png 2x", 0, "https://a/img@2x.png", true},
+		{"https://a/img.png",                             0, "https://a/img.png", true},
+		{"  https://a/img.png  ",                         64, "https://a/img.png", true},
+
+		// These should fail
+		{"",    0, "", false},
+		{" , ", 0, "", false},
+	}
+
+	for _, tc := range testCases {
+		url, ok := Best(tc.srcset, tc.targetWidth)
+		if ok != tc.expectedOk {
+			t.Errorf("Expected ok to be %v, but got %v for srcset '%s'", tc.expectedOk, ok, tc.srcset)
+		}
+		if url != tc.expectedURL {
+			t.Errorf("Expected '%s', but got '%s' for srcset '%s' and width %d", tc.expectedURL, url, tc.srcset, tc.targetWidth)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package migrate
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jakubruminski/FYP/go/utils/logger"
+)
+
+
+const Usage = `usage: migrate <command>
+
+  up [version]   apply pending migrations, up to version if given
+  down [steps]   revert the latest migrations, one unless steps is given
+  status         list migrations and whether they are applied
+`
+
+// Command runs the migrate command line, args being what follows "migrate", and writes its
+// output to out.
+func Command(logger *logger.Logger, db *sql.DB, migrations []*Migration, args []string, out io.Writer) (ok bool) {
+	if len(args) == 0 || len(args) > 2 {
+		fmt.Fprint(out, Usage)
+		return false
+	}
+
+	number := 0
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			fmt.Fprintf(out, "%s needs a number above 0, got '%s'\n\n%s", args[0], args[1], Usage)
+			return false
+		}
+		number = n
+	}
+
+	switch args[0] {
+	case "up":
+		count, ok := Up(logger, db, migrations, number)
+		fmt.Fprintf(out, "Applied %d migrations\n", count)
+		return ok
+
+	case "down":
+		steps := 1
+		if number > 0 {
+			steps = number
+		}
+		count, ok := Down(logger, db, migrations, steps)
+		fmt.Fprintf(out, "Reverted %d migrations\n", count)
+		return ok
+
+	case "status":
+		if len(args) != 1 {
+			fmt.Fprint(out, Usage)
+			return false
+		}
+		statusList, ok := GetStatus(logger, db, migrations)
+		if !ok { return false }
+		WriteStatus(out, statusList)
+		return true
+	}
+
+	fmt.Fprint(out, Usage)
+	return false
+}
+
+// WriteStatus prints statuses as a table.
+func WriteStatus(out io.Writer, statusList []*Status) {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+
+	for _, s := range statusList {
+		applied := "pending"
+		if s.Applied {
+			applied = time.Unix(s.AppliedAt, 0).UTC().Format("2006-01-02 15:04:05")
+		}
+		switch {
+		case s.Unknown:
+			applied += " (no file in this build)"
+		case s.Modified:
+			applied += " (file changed since)"
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+
+	w.Flush()
+}
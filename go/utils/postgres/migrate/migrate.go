@@ -0,0 +1,381 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jakubruminski/FYP/go/utils/logger"
+)
+
+
+// Migration is one numbered change to the schema, with the SQL that applies it and the SQL that
+// reverts it.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Checksum identifies the SQL a migration was applied with, so edits to released files are noticed.
+func (m *Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+// Status is where a migration stands in a database.
+type Status struct {
+	Version   int    `json:"version"`
+	Name      string `json:"name"`
+	Applied   bool   `json:"applied"`
+	AppliedAt int64  `json:"applied_at,omitempty"`  // unix seconds
+	Modified  bool   `json:"modified,omitempty"`    // the file changed since it was applied
+	Unknown   bool   `json:"unknown,omitempty"`     // applied by a newer build, there is no file for it
+}
+
+// A row of schema_version.
+type record struct {
+	name      string
+	checksum  string
+	appliedAt int64
+}
+
+
+var filePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Load reads the migrations in the root of files, named NNNN_name.up.sql and NNNN_name.down.sql.
+// Every version needs both files and versions count up from 1 without gaps.
+func Load(files fs.FS) (migrations []*Migration, err error) {
+	entries, err := fs.ReadDir(files, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		match := filePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			if strings.HasSuffix(entry.Name(), ".sql") {
+				return nil, fmt.Errorf("migration %s isn't named NNNN_name.up.sql or NNNN_name.down.sql", entry.Name())
+			}
+			continue
+		}
+
+		version, err := strconv.Atoi(match[1])
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s needs a version above 0", entry.Name())
+		}
+
+		data, err := fs.ReadFile(files, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, found := byVersion[version]
+		if !found {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", m.Name, match[2], version)
+		}
+
+		switch match[3] {
+		case "up":
+			m.Up = string(data)
+		case "down":
+			m.Down = string(data)
+		}
+		seen[fmt.Sprintf("%d.%s", version, match[3])] = true
+	}
+
+	for _, m := range byVersion {
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+		if !seen[fmt.Sprintf("%d.up", m.Version)] {
+			return nil, fmt.Errorf("migration %d %s has no .up.sql file", m.Version, m.Name)
+		}
+		if !seen[fmt.Sprintf("%d.down", m.Version)] {
+			return nil, fmt.Errorf("migration %d %s has no .down.sql file", m.Version, m.Name)
+		}
+	}
+
+	return migrations, nil
+}
+
+
+// Every instance takes this advisory lock before migrating, so only one of them migrates at a
+// time and the others find the work done. Any number works, as long as it never changes.
+const lockKey int64 = 4170355611
+
+const versionTableQuery = `
+	CREATE TABLE IF NOT EXISTS schema_version (
+		version                             INT PRIMARY KEY,
+		name                                VARCHAR(255) NOT NULL,
+		checksum                            VARCHAR(64) NOT NULL,
+		applied_at                          BIGINT NOT NULL
+	)
+	`
+
+// lock waits for the migration lock on a connection of its own, advisory locks belong to the
+// session that took them. The connection must be given to unlock.
+func lock(logger *logger.Logger, ctx context.Context, db *sql.DB) (conn *sql.Conn, ok bool) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		logger.ERROR("Couldn't get a connection to migrate with. Reason: %s", err)
+		return nil, false
+	}
+
+	logger.DEBUG("Waiting for the migration lock")
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey)
+	if err != nil {
+		logger.ERROR("Couldn't take the migration lock. Reason: %s", err)
+		conn.Close()
+		return nil, false
+	}
+
+	_, err = conn.ExecContext(ctx, versionTableQuery)
+	if err != nil {
+		logger.ERROR("Couldn't create the schema_version table. Reason: %s", err)
+		unlock(logger, ctx, conn)
+		return nil, false
+	}
+
+	return conn, true
+}
+
+func unlock(logger *logger.Logger, ctx context.Context, conn *sql.Conn) {
+	_, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, lockKey)
+	if err != nil {
+		logger.ERROR("Couldn't release the migration lock. Reason: %s", err)
+	}
+	conn.Close()
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func applied(logger *logger.Logger, ctx context.Context, db queryer) (records map[int]*record, ok bool) {
+	rows, err := db.QueryContext(ctx, `SELECT version, name, checksum, applied_at FROM schema_version`)
+	if err != nil {
+		logger.ERROR("Couldn't read the schema_version table. Reason: %s", err)
+		return nil, false
+	}
+	defer rows.Close()
+
+	records = map[int]*record{}
+	for rows.Next() {
+		var version int
+		r := &record{}
+		err = rows.Scan(&version, &r.name, &r.checksum, &r.appliedAt)
+		if err != nil {
+			logger.ERROR("Couldn't scan the schema_version table. Reason: %s", err)
+			return nil, false
+		}
+		records[version] = r
+	}
+	if rows.Err() != nil {
+		logger.ERROR("Couldn't read the schema_version table. Reason: %s", rows.Err())
+		return nil, false
+	}
+
+	return records, true
+}
+
+
+// Up applies the migrations not yet in the database, up to and including target, or all of them
+// if target is 0. Each one runs in a transaction of its own, so a failed migration leaves the
+// database at the one before.
+func Up(logger *logger.Logger, db *sql.DB, migrations []*Migration, target int) (count int, ok bool) {
+	ctx := context.Background()
+
+	conn, ok := lock(logger, ctx, db)
+	if !ok { return 0, false }
+	defer unlock(logger, ctx, conn)
+
+	records, ok := applied(logger, ctx, conn)
+	if !ok { return 0, false }
+
+	for _, s := range statuses(migrations, records) {
+		if s.Unknown {
+			logger.WARN("Database has migration %d %s which this build doesn't know, it was applied by a newer one", s.Version, s.Name)
+		}
+		if s.Modified {
+			logger.WARN("Migration %d %s changed since it was applied, changes to applied migrations are never run", s.Version, s.Name)
+		}
+	}
+
+	for _, m := range pending(migrations, records, target) {
+		logger.INFO("Applying migration %d %s", m.Version, m.Name)
+
+		ok = run(logger, ctx, conn, m.Version, m.Up,
+			`INSERT INTO schema_version (version, name, checksum, applied_at) VALUES ($1, $2, $3, $4)`,
+			m.Version, m.Name, m.Checksum(), time.Now().Unix())
+		if !ok {
+			logger.ERROR("Migration %d %s failed", m.Version, m.Name)
+			return count, false
+		}
+		count++
+	}
+
+	if count == 0 {
+		logger.INFO("Database schema is up to date")
+	}
+	return count, true
+}
+
+// Down reverts the latest steps migrations applied to the database, newest first.
+func Down(logger *logger.Logger, db *sql.DB, migrations []*Migration, steps int) (count int, ok bool) {
+	ctx := context.Background()
+
+	conn, ok := lock(logger, ctx, db)
+	if !ok { return 0, false }
+	defer unlock(logger, ctx, conn)
+
+	records, ok := applied(logger, ctx, conn)
+	if !ok { return 0, false }
+
+	byVersion := map[int]*Migration{}
+	for _, m := range migrations {
+		byVersion[m.Version] = m
+	}
+
+	versions := []int{}
+	for version := range records {
+		versions = append(versions, version)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+	for _, version := range versions {
+		if count == steps {
+			break
+		}
+
+		m, found := byVersion[version]
+		if !found {
+			logger.ERROR("Can't revert migration %d %s, this build has no file for it", version, records[version].name)
+			return count, false
+		}
+
+		logger.INFO("Reverting migration %d %s", m.Version, m.Name)
+
+		ok = run(logger, ctx, conn, m.Version, m.Down, `DELETE FROM schema_version WHERE version = $1`, m.Version)
+		if !ok {
+			logger.ERROR("Reverting migration %d %s failed", m.Version, m.Name)
+			return count, false
+		}
+		count++
+	}
+
+	return count, true
+}
+
+// run executes the SQL of a migration and records it in schema_version, in one transaction.
+func run(logger *logger.Logger, ctx context.Context, conn *sql.Conn, version int, migration, record string, recordArgs ...interface{}) (ok bool) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		logger.ERROR("Couldn't start the transaction for migration %d. Reason: %s", version, err)
+		return false
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, migration)
+	if err != nil {
+		logger.ERROR("Couldn't execute migration %d. Reason: %s", version, err)
+		return false
+	}
+
+	_, err = tx.ExecContext(ctx, record, recordArgs...)
+	if err != nil {
+		logger.ERROR("Couldn't record migration %d in schema_version. Reason: %s", version, err)
+		return false
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logger.ERROR("Couldn't commit migration %d. Reason: %s", version, err)
+		return false
+	}
+
+	return true
+}
+
+// GetStatus lists every migration, known to this build or applied to the database, by version.
+// It doesn't wait for the migration lock, so it can be checked while another instance migrates.
+func GetStatus(logger *logger.Logger, db *sql.DB, migrations []*Migration) (statusList []*Status, ok bool) {
+	ctx := context.Background()
+
+	var exists bool
+	err := db.QueryRowContext(ctx, `SELECT to_regclass('schema_version') IS NOT NULL`).Scan(&exists)
+	if err != nil {
+		logger.ERROR("Couldn't look up the schema_version table. Reason: %s", err)
+		return nil, false
+	}
+
+	records := map[int]*record{}
+	if exists {
+		records, ok = applied(logger, ctx, db)
+		if !ok { return nil, false }
+	}
+
+	return statuses(migrations, records), true
+}
+
+
+func statuses(migrations []*Migration, records map[int]*record) (statusList []*Status) {
+	statusList = []*Status{}
+	known := map[int]bool{}
+
+	for _, m := range migrations {
+		known[m.Version] = true
+		s := &Status{Version: m.Version, Name: m.Name}
+		if r, found := records[m.Version]; found {
+			s.Applied = true
+			s.AppliedAt = r.appliedAt
+			s.Modified = r.checksum != m.Checksum()
+		}
+		statusList = append(statusList, s)
+	}
+
+	for version, r := range records {
+		if !known[version] {
+			statusList = append(statusList, &Status{Version: version, Name: r.name, Applied: true, AppliedAt: r.appliedAt, Unknown: true})
+		}
+	}
+
+	sort.Slice(statusList, func(i, j int) bool { return statusList[i].Version < statusList[j].Version })
+	return statusList
+}
+
+func pending(migrations []*Migration, records map[int]*record, target int) (toApply []*Migration) {
+	for _, m := range migrations {
+		if target > 0 && m.Version > target {
+			break
+		}
+		if _, found := records[m.Version]; !found {
+			toApply = append(toApply, m)
+		}
+	}
+	return toApply
+}
@@ -0,0 +1,170 @@
+package migrate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jakubruminski/FYP/go/migrations"
+	"github.com/jakubruminski/FYP/go/utils/logger"
+)
+
+func file(sql string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(sql)}
+}
+
+func TestLoad(t *testing.T) {
+	testCases := []struct {
+		files    fstest.MapFS
+		expected []string   // names in order, nil when loading should fail
+	}{
+		{fstest.MapFS{
+			"0002_add_b.up.sql":   file("B"),
+			"0002_add_b.down.sql": file("-B"),
+			"0001_add_a.up.sql":   file("A"),
+			"0001_add_a.down.sql": file("-A"),
+			"README.md":           file("not a migration"),
+		}, []string{"add_a", "add_b"}},
+		{fstest.MapFS{}, []string{}},
+		{fstest.MapFS{"0001_add_a.up.sql": file("A")}, nil},                                                      // no down
+		{fstest.MapFS{"0001_add_a.down.sql": file("-A")}, nil},                                                   // no up
+		{fstest.MapFS{"0002_add_b.up.sql": file("B"), "0002_add_b.down.sql": file("-B")}, nil},                   // gap
+		{fstest.MapFS{"0001_add_a.up.sql": file("A"), "0001_add_b.down.sql": file("-B")}, nil},                   // two names, one version
+		{fstest.MapFS{"0000_add_a.up.sql": file("A"), "0000_add_a.down.sql": file("-A")}, nil},                   // version 0
+		{fstest.MapFS{"add_a.sql": file("A")}, nil},                                                              // unnumbered
+	}
+
+	for i, tc := range testCases {
+		migrations, err := Load(tc.files)
+		if tc.expected == nil {
+			if err == nil {
+				t.Errorf("Test case %d: expected an error, but loaded %d migrations", i, len(migrations))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test case %d: unexpected error %s", i, err)
+			continue
+		}
+
+		names := []string{}
+		for _, m := range migrations {
+			names = append(names, m.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(tc.expected, ",") {
+			t.Errorf("Test case %d: expected %v, but got %v", i, tc.expected, names)
+		}
+	}
+
+	migrations, _ := Load(testCases[0].files)
+	if migrations[1].Version != 2 || migrations[1].Up != "B" || migrations[1].Down != "-B" {
+		t.Errorf("Expected migration 2 to be B and -B, but got %+v", migrations[1])
+	}
+}
+
+// The migrations that ship with the server must always load.
+func TestLoadMigrations(t *testing.T) {
+	all, err := Load(migrations.Files)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %s", err)
+	}
+	if len(all) == 0 {
+		t.Errorf("Expected migrations")
+	}
+	for _, m := range all {
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			t.Errorf("Migration %d %s has an empty file", m.Version, m.Name)
+		}
+	}
+}
+
+func TestStatuses(t *testing.T) {
+	migrations := []*Migration{
+		{Version: 1, Name: "add_a", Up: "A"},
+		{Version: 2, Name: "add_b", Up: "B"},
+		{Version: 3, Name: "add_c", Up: "C"},
+	}
+	edited := &Migration{Up: "A, edited"}
+	records := map[int]*record{
+		1: {name: "add_a", checksum: edited.Checksum(), appliedAt: 100},
+		2: {name: "add_b", checksum: migrations[1].Checksum(), appliedAt: 200},
+		4: {name: "add_d", checksum: "", appliedAt: 300},
+	}
+
+	statusList := statuses(migrations, records)
+
+	expected := []Status{
+		{Version: 1, Name: "add_a", Applied: true, AppliedAt: 100, Modified: true},
+		{Version: 2, Name: "add_b", Applied: true, AppliedAt: 200},
+		{Version: 3, Name: "add_c"},
+		{Version: 4, Name: "add_d", Applied: true, AppliedAt: 300, Unknown: true},
+	}
+	if len(statusList) != len(expected) {
+		t.Fatalf("Expected %d statuses, but got %d", len(expected), len(statusList))
+	}
+	for i := range expected {
+		if *statusList[i] != expected[i] {
+			t.Errorf("Status %d: expected %+v, but got %+v", i, expected[i], *statusList[i])
+		}
+	}
+}
+
+func TestPending(t *testing.T) {
+	migrations := []*Migration{{Version: 1}, {Version: 2}, {Version: 3}, {Version: 4}}
+	records := map[int]*record{1: {}, 3: {}}
+
+	testCases := []struct {
+		target   int
+		expected []int
+	}{
+		{0, []int{2, 4}},
+		{2, []int{2}},
+		{1, []int{}},
+	}
+
+	for i, tc := range testCases {
+		versions := []int{}
+		for _, m := range pending(migrations, records, tc.target) {
+			versions = append(versions, m.Version)
+		}
+		if len(versions) != len(tc.expected) {
+			t.Errorf("Test case %d: expected %v, but got %v", i, tc.expected, versions)
+			continue
+		}
+		for j := range versions {
+			if versions[j] != tc.expected[j] {
+				t.Errorf("Test case %d: expected %v, but got %v", i, tc.expected, versions)
+				break
+			}
+		}
+	}
+}
+
+func TestCommandUsage(t *testing.T) {
+	logger := &logger.Logger{}
+
+	// Bad arguments are caught before the database is used
+	for _, args := range [][]string{{}, {"sideways"}, {"down", "0"}, {"up", "x"}, {"status", "1"}, {"up", "1", "2"}} {
+		out := &bytes.Buffer{}
+		if Command(logger, nil, nil, args, out) {
+			t.Errorf("Expected %v to fail", args)
+		}
+		if !strings.Contains(out.String(), "usage: migrate") {
+			t.Errorf("Expected usage for %v, but got '%s'", args, out.String())
+		}
+	}
+}
+
+func TestWriteStatus(t *testing.T) {
+	out := &bytes.Buffer{}
+	WriteStatus(out, []*Status{
+		{Version: 1, Name: "add_a", Applied: true, AppliedAt: 0},
+		{Version: 2, Name: "add_b"},
+	})
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[1], "1970-01-01 00:00:00") || !strings.HasSuffix(lines[2], "pending") {
+		t.Errorf("Unexpected status table:\n%s", out.String())
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"sync"
 	"time"
 
 	_ "github.com/lib/pq"
@@ -15,6 +16,14 @@ import (
 
 var (
 	CONTEXT_TIMEOUT = 120
+
+	poolMu sync.Mutex
+	pool   *sql.DB
+)
+
+const (
+	connectRetryDelay = 5 * time.Second
+	healthTimeout     = 2 * time.Second
 )
 
 
@@ -47,132 +56,159 @@ func connectToDatabase(logger *logger.Logger) (db *sql.DB, ok bool) {
 	return db, true
 }
 
-func ExecuteCreateTableQuery(logger *logger.Logger, tableName, query string) (ok bool) {
-	CONTEXT_TIMEOUT, ok := env.GetInt(logger, "CONTEXT_TIMEOUT")
-	if !ok {
-		return false
+// Open creates the connection pool every transaction shares, sized by DB_MAX_OPEN_CONNS and
+// DB_MAX_IDLE_CONNS, with connections replaced after DB_CONN_MAX_LIFETIME_MINUTES and idle ones
+// closed after DB_CONN_MAX_IDLE_MINUTES. It checks the database answers, trying up to attempts
+// times a few seconds apart as it may still be starting next to the server.
+//
+// It is called once at startup, Close closes the pool on the way out.
+func Open(logger *logger.Logger, attempts int) (ok bool) {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+
+	if pool != nil {
+		return true
 	}
+
+	CONTEXT_TIMEOUT = env.GetIntDefault(logger, "CONTEXT_TIMEOUT", CONTEXT_TIMEOUT)
 	logger.DEBUG("Global context timout set to %d", CONTEXT_TIMEOUT)
 
-	retry := true
-	for retry {
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			logger.DEBUG("Sleeping for %s before retrying", connectRetryDelay)
+			time.Sleep(connectRetryDelay)
+		}
+
 		db, ok := connectToDatabase(logger)
 		if !ok {
-			logger.ERROR("Couldn't connect to the database")
-			logger.DEBUG("Sleeping for 1 minute before retrying")
-			time.Sleep(1 * time.Minute)
 			continue
 		}
-		defer db.Close()
 
-		_, err := db.Exec(query)
-		if err != nil {
-			logger.ERROR("Couldn't execute the query. Reason: %s", err)
-			logger.DEBUG("Sleeping for 1 minute before retrying")
-			time.Sleep(1 * time.Minute)
+		db.SetMaxOpenConns(env.GetIntDefault(logger, "DB_MAX_OPEN_CONNS", 25))
+		db.SetMaxIdleConns(env.GetIntDefault(logger, "DB_MAX_IDLE_CONNS", 10))
+		db.SetConnMaxLifetime(time.Duration(env.GetIntDefault(logger, "DB_CONN_MAX_LIFETIME_MINUTES", 30)) * time.Minute)
+		db.SetConnMaxIdleTime(time.Duration(env.GetIntDefault(logger, "DB_CONN_MAX_IDLE_MINUTES", 5)) * time.Minute)
+
+		_, ok = ping(db)
+		if !ok {
+			logger.ERROR("Couldn't reach the database, attempt %d of %d", attempt, attempts)
+			db.Close()
 			continue
 		}
 
+		pool = db
+		logger.INFO("Connected to the database, at most %d connections", db.Stats().MaxOpenConnections)
 		return true
 	}
 
-	logger.INFO("Successfully created table '%s'", tableName)
-	return true
+	return false
 }
 
-// REMEMBER TO COMMIT THE TRANSACTION
-func createTransaction(logger *logger.Logger) (tx *sql.Tx, ok bool) {
-	db, ok := connectToDatabase(logger)
-	if !ok {
-		logger.ERROR("Couldn't connect to the database")
-		return nil, false
-	}
-	defer db.Close()
+// DB is the pool Open created, nil before.
+func DB() *sql.DB {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+	return pool
+}
 
-	tx, err := db.Begin()
-	if err != nil {
-		logger.ERROR("Couldn't start the transaction. Reason: %s", err)
-		return nil, false
+func Close() {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+
+	if pool != nil {
+		pool.Close()
+		pool = nil
 	}
-	return tx, true
 }
 
-func ExecuteInTransaction(
-	logger *logger.Logger,
-	transactionFunction func(logger *logger.Logger, tx *sql.Tx, args ...interface{}) bool,
-	transactionArgs ...interface{},
-) bool {
-
-	var ok bool
-	db_available, ok := env.GetBool(logger, "DB_AVAILABLE")
-	if !ok { return false }
-	
-	var tx *sql.Tx
-	if db_available {
-		tx, ok = createTransaction(logger)
-		if !ok {
-			logger.ERROR("Couldn't start the transaction.")
-			return false
-		}
-		defer tx.Rollback()
-	}
 
-	ok = transactionFunction(logger, tx, transactionArgs...)
-	if !ok {
-		logger.ERROR("Transaction failed")
-		return false
-	}
+// Stats describes the pool, for monitoring.
+type Stats struct {
+	MaxOpen           int     `json:"max_open"`
+	Open              int     `json:"open"`
+	InUse             int     `json:"in_use"`
+	Idle              int     `json:"idle"`
+	WaitCount         int64   `json:"wait_count"`         // times a transaction waited for a free connection
+	WaitMilliseconds  int64   `json:"wait_ms"`            // total time spent waiting
+	MaxIdleClosed     int64   `json:"max_idle_closed"`
+	MaxIdleTimeClosed int64   `json:"max_idle_time_closed"`
+	MaxLifetimeClosed int64   `json:"max_lifetime_closed"`
+}
 
-	if db_available {
-		err := tx.Commit()
-		if err != nil {
-			logger.ERROR("Couldn't commit the transaction. Reason: %s", err)
-			return false
-		}
+func NewStats(s sql.DBStats) *Stats {
+	return &Stats{
+		MaxOpen:           s.MaxOpenConnections,
+		Open:              s.OpenConnections,
+		InUse:             s.InUse,
+		Idle:              s.Idle,
+		WaitCount:         s.WaitCount,
+		WaitMilliseconds:  s.WaitDuration.Milliseconds(),
+		MaxIdleClosed:     s.MaxIdleClosed,
+		MaxIdleTimeClosed: s.MaxIdleTimeClosed,
+		MaxLifetimeClosed: s.MaxLifetimeClosed,
 	}
-
-	return true
 }
 
-func ExecuteContextChangeQuery(
-	logger *logger.Logger,
-	tx *sql.Tx,
-	changeFunction func(logger *logger.Logger, tx *sql.Tx, ctx context.Context, query string, args ...interface{}) (bool),
-	query string,
-	args ...interface{},
-) (ok bool) {
+// Health is the result of a health check of the pool.
+type Health struct {
+	Available bool    `json:"available"`
+	LatencyMs float64 `json:"latency_ms"`
+	Pool      *Stats  `json:"pool,omitempty"`
+}
 
-	ctx := context.Background()
-	ctx, cancel := context.WithTimeout(ctx, time.Duration(CONTEXT_TIMEOUT)*time.Second)
-	defer cancel()
+// Check pings the database through the pool.
+func Check(logger *logger.Logger) *Health {
+	db := DB()
+	if db == nil {
+		return &Health{}
+	}
 
-	ok = changeFunction(logger, tx, ctx, query, args...)
+	latency, ok := ping(db)
 	if !ok {
-		logger.ERROR("Failed to execute the context change query")
-		return false
+		logger.ERROR("Database health check failed")
 	}
 
-	return true
+	return &Health{
+		Available: ok,
+		LatencyMs: float64(latency.Microseconds()) / 1000,
+		Pool:      NewStats(db.Stats()),
+	}
 }
 
-func ExecuteContextLookUpQuery(
-	logger *logger.Logger,
-	tx *sql.Tx,
-	lookUpFunction func(logger *logger.Logger, tx *sql.Tx, ctx context.Context, query string, args ...interface{}) (bool),
+// StartHealthCheck pings the database every DB_HEALTH_CHECK_SECONDS and logs when it goes down
+// or comes back. Broken connections are dropped from the pool as the pings find them.
+func StartHealthCheck(logger *logger.Logger) {
+	interval := env.GetIntDefault(logger, "DB_HEALTH_CHECK_SECONDS", 30)
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+
+		available := true
+		for range ticker.C {
+			health := Check(logger)
+			if health.Available != available {
+				if health.Available {
+					logger.INFO("Database is reachable again")
+				} else {
+					logger.WARN("Database is unreachable")
+				}
+				available = health.Available
+			}
+			if health.Pool != nil && health.Pool.WaitCount > 0 {
+				logger.DEBUG("Database pool: %d of %d connections in use, %d waits", health.Pool.InUse, health.Pool.MaxOpen, health.Pool.WaitCount)
+			}
+		}
+	}()
 
-	query string,
-	args ...interface{},
-) (ok bool) {
+	logger.INFO("Checking the database every %d seconds", interval)
+}
 
-	ctx := context.Background()
-	ctx, cancel := context.WithTimeout(ctx, time.Duration(CONTEXT_TIMEOUT)*time.Second)
+func ping(db *sql.DB) (latency time.Duration, ok bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), healthTimeout)
 	defer cancel()
 
-	ok = lookUpFunction(logger, tx, ctx, query, args...)
-	if !ok {
-		logger.ERROR("Failed to execute the context look up query")
-		return false
-	}
-
-	return true
-}
\ No newline at end of file
+	start := time.Now()
+	err := db.PingContext(ctx)
+	return time.Since(start), err == nil
+}
@@ -0,0 +1,43 @@
+// Package postgrestest runs query tests against the database in DB_HOST, POSTGRES_DB, ...
+// Tests are skipped without one.
+package postgrestest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jakubruminski/FYP/go/migrations"
+
+	"github.com/jakubruminski/FYP/go/utils/logger"
+	"github.com/jakubruminski/FYP/go/utils/postgres"
+	"github.com/jakubruminski/FYP/go/utils/postgres/migrate"
+)
+
+
+// Open connects to the database and brings it up to date with the migrations, the way
+// query.INITIALISE_DATABASE does on startup. The pool is closed when the test ends.
+func Open(t *testing.T, logger *logger.Logger) {
+	t.Helper()
+
+	if !postgres.Open(logger, 1) {
+		t.Skip("No database to test against")
+	}
+	t.Cleanup(postgres.Close)
+
+	all, err := migrate.Load(migrations.Files)
+	if err != nil {
+		t.Fatalf("Failed to load migrations. Reason: %s", err)
+	}
+	if _, ok := migrate.Up(logger, postgres.DB(), all, 0); !ok {
+		t.Fatalf("Failed to migrate the database")
+	}
+}
+
+// RolledBack runs testFunction in a transaction that is always rolled back, so the test leaves
+// nothing behind.
+func RolledBack(logger *logger.Logger, testFunction func(tx *postgres.Tx)) {
+	postgres.ExecuteInTransaction(logger, context.Background(), postgres.Once, func(tx *postgres.Tx) bool {
+		testFunction(tx)
+		return false
+	})
+}
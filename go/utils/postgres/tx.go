@@ -0,0 +1,262 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/jakubruminski/FYP/go/utils/env"
+	"github.com/jakubruminski/FYP/go/utils/logger"
+)
+
+
+const (
+	serializationFailure = pq.ErrorCode("40001")
+	deadlockDetected     = pq.ErrorCode("40P01")
+
+	retryDelay = 50 * time.Millisecond   // doubled every attempt
+)
+
+var (
+	errNoPool = errors.New("the database pool isn't open")
+	errFailed = errors.New("the transaction function failed")
+)
+
+
+// Tx is a transaction and the context its queries run under. The helpers below keep the first
+// error a query ran into, which is how InTransaction tells a serialisation failure or a deadlock,
+// worth another go, from a transaction that failed for good.
+type Tx struct {
+	tx  *sql.Tx
+	ctx context.Context
+	err error
+}
+
+func (tx *Tx) Context() context.Context {
+	return tx.ctx
+}
+
+// Err is the first error a query of the transaction ran into, nil when none did.
+func (tx *Tx) Err() error {
+	return tx.err
+}
+
+func (tx *Tx) fail(logger *logger.Logger, err error) {
+	if tx.err == nil {
+		tx.err = err
+	}
+
+	if Retryable(err) {
+		logger.DEBUG_WARN("Query failed, the transaction may be tried again. Reason: %s", err)
+		return
+	}
+	logger.ERROR("Failed to execute the query. Reason: %s", err)
+}
+
+// queryContext bounds a query by CONTEXT_TIMEOUT, within the context of the transaction.
+func (tx *Tx) queryContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(tx.ctx, time.Duration(CONTEXT_TIMEOUT)*time.Second)
+}
+
+
+// TxOptions choose how a transaction is isolated and how often it is tried.
+type TxOptions struct {
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+	Attempts  int   // tries in all, 0 for DB_TX_ATTEMPTS. 1 when the transaction does something that can't be repeated
+}
+
+var (
+	// ReadCommitted is what Postgres does by default, each query sees what was committed before it
+	// started. Used when options are nil.
+	ReadCommitted = &TxOptions{Isolation: sql.LevelReadCommitted}
+
+	// ReadOnly is ReadCommitted for transactions that only read.
+	ReadOnly = &TxOptions{Isolation: sql.LevelReadCommitted, ReadOnly: true}
+
+	// Once is ReadCommitted tried a single time, for transactions that do something outside the
+	// database that shouldn't be done twice, like scraping the sellers.
+	Once = &TxOptions{Isolation: sql.LevelReadCommitted, Attempts: 1}
+
+	// Serializable runs as if no other transaction ran at the same time. Postgres fails the ones
+	// that couldn't have, and they are tried again.
+	Serializable = &TxOptions{Isolation: sql.LevelSerializable}
+)
+
+// Retryable is true for the errors a transaction fails with when it raced another, serialisation
+// failures and deadlocks. Running it again usually succeeds.
+func Retryable(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == serializationFailure || pqErr.Code == deadlockDetected
+}
+
+
+// InTransaction runs transactionFunction in a transaction of the shared pool and returns what it
+// returned. The transaction is committed when transactionFunction returns true and rolled back
+// otherwise. When a query of it failed on a serialisation failure or a deadlock, it is run again
+// in a fresh transaction, up to options.Attempts times, so it must start from scratch every time
+// and do nothing outside the transaction that can't be repeated.
+func InTransaction[T any](
+	logger *logger.Logger,
+	ctx context.Context,
+	options *TxOptions,
+	transactionFunction func(tx *Tx) (T, bool),
+) (result T, ok bool) {
+
+	if options == nil {
+		options = ReadCommitted
+	}
+	attempts := options.Attempts
+	if attempts == 0 {
+		attempts = env.GetIntDefault(logger, "DB_TX_ATTEMPTS", 3)
+	}
+
+	delay := retryDelay
+	for attempt := 1; ; attempt++ {
+		result, err := run(ctx, options, transactionFunction)
+		if err == nil {
+			return result, true
+		}
+
+		if !Retryable(err) || attempt >= attempts {
+			logger.ERROR("Transaction failed. Reason: %s", err)
+			var zero T
+			return zero, false
+		}
+
+		logger.WARN("Transaction failed on attempt %d of %d, trying again in %s. Reason: %s", attempt, attempts, delay, err)
+		select {
+		case <-ctx.Done():
+			logger.ERROR("Gave up on the transaction. Reason: %s", ctx.Err())
+			var zero T
+			return zero, false
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// ExecuteInTransaction is InTransaction for transactions that return nothing but whether they worked.
+func ExecuteInTransaction(
+	logger *logger.Logger,
+	ctx context.Context,
+	options *TxOptions,
+	transactionFunction func(tx *Tx) bool,
+) (ok bool) {
+
+	_, ok = InTransaction(logger, ctx, options, func(tx *Tx) (struct{}, bool) {
+		return struct{}{}, transactionFunction(tx)
+	})
+	return ok
+}
+
+// run is one attempt at a transaction. The error is what InTransaction decides to retry on.
+func run[T any](ctx context.Context, options *TxOptions, transactionFunction func(tx *Tx) (T, bool)) (result T, err error) {
+	db := DB()
+	if db == nil {
+		return result, errNoPool
+	}
+
+	sqlTx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: options.Isolation, ReadOnly: options.ReadOnly})
+	if err != nil {
+		return result, fmt.Errorf("couldn't start the transaction: %w", err)
+	}
+	defer sqlTx.Rollback()
+
+	tx := &Tx{tx: sqlTx, ctx: ctx}
+	result, ok := transactionFunction(tx)
+	if !ok {
+		if tx.err != nil {
+			return result, tx.err
+		}
+		return result, errFailed
+	}
+
+	err = sqlTx.Commit()
+	if err != nil {
+		return result, fmt.Errorf("couldn't commit the transaction: %w", err)
+	}
+	return result, nil
+}
+
+
+// Scanner is a row of Query or QueryRow.
+type Scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// Value scans a row of a single column, for Query and QueryRow.
+func Value[T any](row Scanner) (value T, err error) {
+	err = row.Scan(&value)
+	return value, err
+}
+
+// Exec runs a statement and returns how many rows it changed.
+func Exec(logger *logger.Logger, tx *Tx, query string, args ...interface{}) (affected int64, ok bool) {
+	ctx, cancel := tx.queryContext()
+	defer cancel()
+
+	result, err := tx.tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		tx.fail(logger, err)
+		return 0, false
+	}
+
+	affected, err = result.RowsAffected()
+	if err != nil {
+		tx.fail(logger, err)
+		return 0, false
+	}
+	return affected, true
+}
+
+// Query runs a query and returns its rows, each turned into a T by scan.
+func Query[T any](logger *logger.Logger, tx *Tx, scan func(row Scanner) (T, error), query string, args ...interface{}) (results []T, ok bool) {
+	ctx, cancel := tx.queryContext()
+	defer cancel()
+
+	rows, err := tx.tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		tx.fail(logger, err)
+		return nil, false
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		result, err := scan(rows)
+		if err != nil {
+			tx.fail(logger, err)
+			return nil, false
+		}
+		results = append(results, result)
+	}
+
+	if err := rows.Err(); err != nil {
+		tx.fail(logger, err)
+		return nil, false
+	}
+	return results, true
+}
+
+// QueryRow runs a query that returns at most one row. found is false when it returned none.
+func QueryRow[T any](logger *logger.Logger, tx *Tx, scan func(row Scanner) (T, error), query string, args ...interface{}) (result T, found, ok bool) {
+	ctx, cancel := tx.queryContext()
+	defer cancel()
+
+	result, err := scan(tx.tx.QueryRowContext(ctx, query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return result, false, true
+	}
+	if err != nil {
+		tx.fail(logger, err)
+		return result, false, false
+	}
+	return result, true, true
+}
@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+
+	"github.com/jakubruminski/FYP/go/utils/logger"
+)
+
+func TestRetryable(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected bool
+	}{
+		{&pq.Error{Code: "40001"}, true},                                          // serialization_failure
+		{&pq.Error{Code: "40P01"}, true},                                          // deadlock_detected
+		{fmt.Errorf("couldn't commit the transaction: %w", &pq.Error{Code: "40001"}), true},
+		{&pq.Error{Code: "23505"}, false},                                         // unique_violation
+		{errors.New("connection refused"), false},
+		{nil, false},
+	}
+
+	for i, tc := range testCases {
+		if Retryable(tc.err) != tc.expected {
+			t.Errorf("Test case %d: expected %t for %v", i, tc.expected, tc.err)
+		}
+	}
+}
+
+type row []interface{}
+
+func (r row) Scan(dest ...interface{}) error {
+	if len(dest) != len(r) {
+		return fmt.Errorf("expected %d columns, got %d", len(r), len(dest))
+	}
+	for i := range dest {
+		switch d := dest[i].(type) {
+		case *int64:
+			*d = r[i].(int64)
+		case *string:
+			*d = r[i].(string)
+		}
+	}
+	return nil
+}
+
+func TestValue(t *testing.T) {
+	id, err := Value[int64](row{int64(42)})
+	if err != nil || id != 42 {
+		t.Errorf("Expected 42, but got %d (%v)", id, err)
+	}
+
+	name, err := Value[string](row{"milk"})
+	if err != nil || name != "milk" {
+		t.Errorf("Expected milk, but got '%s' (%v)", name, err)
+	}
+
+	if _, err := Value[int64](row{int64(1), int64(2)}); err == nil {
+		t.Errorf("Expected a row of two columns to fail")
+	}
+}
+
+// Without a pool nothing runs, and nothing is tried again.
+func TestInTransactionWithoutPool(t *testing.T) {
+	logger := &logger.Logger{}
+
+	calls := 0
+	result, ok := InTransaction(logger, context.Background(), &TxOptions{Attempts: 3}, func(tx *Tx) (int, bool) {
+		calls++
+		return 1, true
+	})
+	if ok || result != 0 || calls != 0 {
+		t.Errorf("Expected the transaction to fail without running, but got %d after %d calls", result, calls)
+	}
+}
@@ -0,0 +1,69 @@
+package text
+
+import (
+	"strings"
+	"unicode"
+)
+
+
+var accents = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ä", "a", "ã", "a", "å", "a",
+	"é", "e", "è", "e", "ê", "e", "ë", "e",
+	"í", "i", "ì", "i", "î", "i", "ï", "i",
+	"ó", "o", "ò", "o", "ô", "o", "ö", "o", "õ", "o", "ø", "o",
+	"ú", "u", "ù", "u", "û", "u", "ü", "u",
+	"ç", "c", "ñ", "n", "ß", "ss", "æ", "ae", "œ", "oe",
+	"’", "'", "‘", "'",
+)
+
+
+// Normalise lowercases text, folds accents and turns punctuation into spaces,
+// so "Ben & Jerry's Crème Brûlée" becomes "ben jerry s creme brulee".
+// Decimal points and commas between digits are kept, "1.5L" stays "1.5l".
+func Normalise(text string) string {
+	text = accents.Replace(strings.ToLower(text))
+
+	runes := []rune(text)
+	var builder strings.Builder
+	for i, r := range runes {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			builder.WriteRune(r)
+		case (r == '.' || r == ',') && i > 0 && i+1 < len(runes) && unicode.IsDigit(runes[i-1]) && unicode.IsDigit(runes[i+1]):
+			builder.WriteRune(r)
+		default:
+			builder.WriteRune(' ')
+		}
+	}
+
+	return strings.Join(strings.Fields(builder.String()), " ")
+}
+
+// Tokens splits normalised text into words.
+func Tokens(text string) []string {
+	return strings.Fields(Normalise(text))
+}
+
+
+// Stem reduces an English plural to its singular, which is all product names need,
+// so "berries" matches "berry" and "tomatoes" matches "tomato". Other words are returned as they are.
+func Stem(word string) string {
+	if len(word) <= 3 {
+		return word
+	}
+
+	switch {
+	case strings.HasSuffix(word, "ies"):
+		return word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "oes"), strings.HasSuffix(word, "sses"):
+		return word[:len(word)-2]
+	case strings.HasSuffix(word, "ches"), strings.HasSuffix(word, "shes"), strings.HasSuffix(word, "xes"), strings.HasSuffix(word, "zes"):
+		return word[:len(word)-2]
+	case strings.HasSuffix(word, "ss"), strings.HasSuffix(word, "us"), strings.HasSuffix(word, "is"):
+		return word
+	case strings.HasSuffix(word, "s"):
+		return word[:len(word)-1]
+	}
+
+	return word
+}
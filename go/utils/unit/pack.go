@@ -0,0 +1,111 @@
+package unit
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+
+var (
+	numberRegex     = regexp.MustCompile(`\d+(?:[.,]\d+)?`)
+	multiplierRegex = regexp.MustCompile(`^\s*[x×]\s*(\d+(?:[.,]\d+)?)`)
+	packOfRegex     = regexp.MustCompile(`(?:pack|box|case|tray) of (\d+)`)
+)
+
+// Aliases that are too common as ordinary words to be trusted inside a product name,
+// e.g. "Eggs 12 in a box" is not 12 inches.
+var ambiguousInNames = map[string]bool{
+	"in":   true,
+	"ea":   true,
+	"load": true,
+}
+
+
+// ParsePackSize finds the total quantity a product name describes.
+//
+//  "Avonmore Milk 2L"            -> 2 litre
+//  "Coca-Cola 6 x 330ml"         -> 1980 millilitre
+//  "Heinz Beanz 4 Pack 415g"     -> 1660 gram
+//  "Eggs 12 Pack", "Pack of 12"  -> 12 each
+//
+// A multipack ("6 x 330ml") wins over everything else. Otherwise the last measured
+// quantity in the name is used, multiplied by a pack count if there is one.
+//
+func ParsePackSize(name string) (total Quantity, ok bool) {
+	text := strings.ToLower(name)
+
+	var measured, counted *Quantity
+
+	for _, loc := range numberRegex.FindAllStringIndex(text, -1) {
+		// Skip numbers glued to a word, e.g. "7up" or "v8"
+		if loc[0] > 0 && isLetter(text[loc[0]-1]) {
+			continue
+		}
+
+		value, ok := parseNumber(text[loc[0]:loc[1]])
+		if !ok {
+			continue
+		}
+		rest := text[loc[1]:]
+
+		if m := multiplierRegex.FindStringSubmatchIndex(rest); m != nil {
+			inner, ok := parseNumber(rest[m[2]:m[3]])
+			if !ok {
+				continue
+			}
+			q, ok := quantityAt(rest[m[3]:], inner)
+			if ok {
+				return q.Times(value), true
+			}
+			continue
+		}
+
+		q, ok := quantityAt(rest, value)
+		if !ok {
+			continue
+		}
+
+		if q.Unit.Dimension == Count {
+			counted = &q
+		} else {
+			measured = &q
+		}
+	}
+
+	if counted == nil {
+		if m := packOfRegex.FindStringSubmatch(text); m != nil {
+			value, ok := parseNumber(m[1])
+			if ok {
+				counted = &Quantity{Value: value, Unit: Canonical(Count)}
+			}
+		}
+	}
+
+	switch {
+	case measured != nil && counted != nil:
+		return measured.Times(counted.Canonical().Value), true
+	case measured != nil:
+		return *measured, true
+	case counted != nil:
+		return *counted, true
+	}
+
+	return Quantity{}, false
+}
+
+func quantityAt(text string, value float64) (q Quantity, ok bool) {
+	a, ok := lookup(text)
+	if !ok || ambiguousInNames[a.text] {
+		return Quantity{}, false
+	}
+	return Quantity{Value: value, Unit: a.unit}, true
+}
+
+func parseNumber(text string) (value float64, ok bool) {
+	value, err := strconv.ParseFloat(strings.Replace(text, ",", ".", 1), 64)
+	if err != nil || value <= 0 {
+		return 0.0, false
+	}
+	return value, true
+}
@@ -0,0 +1,55 @@
+package unit
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParsePackSize(t *testing.T) {
+	testCases := []struct {
+		name              string
+		expectedValue     float64   // in the canonical unit
+		expectedUnit      string
+		expectedOk        bool
+	}{
+		{"Avonmore Fresh Milk 2L",                 2.0,   "litre",    true},
+		{"Coca-Cola 6 x 330ml",                    1.98,  "litre",    true},
+		{"Coca-Cola Zero Sugar 6x330ml Cans",      1.98,  "litre",    true},
+		{"Tesco Free Range Eggs 12 Pack",          12.0,  "each",     true},
+		{"Pack of 6 Large Eggs",                   6.0,   "each",     true},
+		{"Heinz Beanz 4 Pack 415g",                1.66,  "kilogram", true},
+		{"Jameson Irish Whiskey 70cl",             0.7,   "litre",    true},
+		{"Kerrygold Butter 227g",                  0.227, "kilogram", true},
+		{"Cadbury Dairy Milk 4 x 110g",            0.44,  "kilogram", true},
+		{"Flora Original 1,5 kg",                  1.5,   "kilogram", true},
+		{"Andrex Toilet Tissue 9 Roll 200 Sheets", 200,   "sheet",    true},
+		{"Persil Bio Liquid 38 Washes",            38,    "wash",     true},
+		{"7up Free 2 Litre",                       2.0,   "litre",    true},
+		{"Bacofoil Kitchen Foil 30m",              30,    "metre",    true},
+		{"Guinness Draught 1 Pint",                0.56826125, "litre", true},
+
+		// These should fail
+		{"Bananas Loose",                          0,     "",         false},
+		{"Eggs 12 in a box",                       0,     "",         false},
+		{"Tesco 2% Milk",                          0,     "",         false},
+	}
+
+	for _, tc := range testCases {
+		q, ok := ParsePackSize(tc.name)
+		if ok != tc.expectedOk {
+			t.Errorf("Expected ok to be %v, but got %v for '%s'", tc.expectedOk, ok, tc.name)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		canonical := q.Canonical()
+		if canonical.Unit.Name != tc.expectedUnit {
+			t.Errorf("Expected unit '%s', but got '%s' for '%s'", tc.expectedUnit, canonical.Unit.Name, tc.name)
+		}
+		if math.Abs(canonical.Value-tc.expectedValue) > 1e-9 {
+			t.Errorf("Expected %f, but got %f for '%s'", tc.expectedValue, canonical.Value, tc.name)
+		}
+	}
+}
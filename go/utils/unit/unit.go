@@ -0,0 +1,242 @@
+package unit
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+
+type Dimension string
+
+const (
+	Mass    Dimension = "mass"
+	Volume  Dimension = "volume"
+	Count   Dimension = "count"
+	Length  Dimension = "length"
+	Area    Dimension = "area"
+	Washes  Dimension = "washes"
+	Sheets  Dimension = "sheets"
+)
+
+// Dimensions in the order results are presented.
+var Dimensions = []Dimension{Mass, Volume, Count, Length, Area, Washes, Sheets}
+
+
+type Unit struct {
+	Name       string     // e.g. "gram"
+	Dimension  Dimension
+	Aliases    []string   // how sellers write it, e.g. "g", "grams"
+
+	// One of this unit is Numerator/Denominator canonical units.
+	// Metric sub-units use an exact Denominator so that "€43 per 70cl" is computed as 43*100/70.
+	Numerator   float64
+	Denominator float64
+}
+
+// ToCanonical converts a value in this unit into the canonical unit of its dimension.
+func (u *Unit) ToCanonical(value float64) float64 {
+	return value * u.Numerator / u.Denominator
+}
+
+// FromCanonical converts a value in the canonical unit of the dimension into this unit.
+func (u *Unit) FromCanonical(value float64) float64 {
+	return value * u.Denominator / u.Numerator
+}
+
+func (u *Unit) IsCanonical() bool {
+	return u.Numerator == 1 && u.Denominator == 1
+}
+
+
+// Units is the full table. The first unit of each dimension is its canonical unit,
+// and its name is the UnitType stored on products ("kilogram", "litre", "each", ...).
+var Units = []*Unit{
+	{Name: "kilogram",   Dimension: Mass, Numerator: 1, Denominator: 1,       Aliases: []string{"kilograms", "kilogram", "kilos", "kilo", "kgs", "kg"}},
+	{Name: "gram",       Dimension: Mass, Numerator: 1, Denominator: 1000,    Aliases: []string{"grams", "gram", "grammes", "gramme", "gr", "g"}},
+	{Name: "milligram",  Dimension: Mass, Numerator: 1, Denominator: 1000000, Aliases: []string{"milligrams", "milligram", "mg"}},
+	{Name: "pound",      Dimension: Mass, Numerator: 0.45359237, Denominator: 1,   Aliases: []string{"pounds", "pound", "lbs", "lb"}},
+	{Name: "ounce",      Dimension: Mass, Numerator: 0.45359237, Denominator: 16,  Aliases: []string{"ounces", "ounce", "oz"}},
+
+	{Name: "litre",       Dimension: Volume, Numerator: 1, Denominator: 1,    Aliases: []string{"litres", "litre", "liters", "liter", "ltr", "lt", "l"}},
+	{Name: "decilitre",   Dimension: Volume, Numerator: 1, Denominator: 10,   Aliases: []string{"decilitres", "decilitre", "dl"}},
+	{Name: "centilitre",  Dimension: Volume, Numerator: 1, Denominator: 100,  Aliases: []string{"centilitres", "centilitre", "cl"}},
+	{Name: "millilitre",  Dimension: Volume, Numerator: 1, Denominator: 1000, Aliases: []string{"millilitres", "millilitre", "milliliters", "milliliter", "mls", "ml"}},
+	{Name: "fluid ounce", Dimension: Volume, Numerator: 4.54609, Denominator: 160, Aliases: []string{"fluid ounces", "fluid ounce", "fl oz", "floz"}},
+	{Name: "pint",        Dimension: Volume, Numerator: 4.54609, Denominator: 8,   Aliases: []string{"pints", "pint", "pt"}},
+	{Name: "gallon",      Dimension: Volume, Numerator: 4.54609, Denominator: 1,   Aliases: []string{"gallons", "gallon", "gal"}},
+
+	{Name: "each",  Dimension: Count, Numerator: 1, Denominator: 1,  Aliases: []string{"each", "ea", "units", "unit", "items", "item", "pieces", "piece", "pcs", "pc", "pack", "pk"}},
+	{Name: "dozen", Dimension: Count, Numerator: 12, Denominator: 1, Aliases: []string{"dozen", "doz"}},
+
+	{Name: "metre",      Dimension: Length, Numerator: 1, Denominator: 1,    Aliases: []string{"metres", "metre", "meters", "meter", "mtr", "m"}},
+	{Name: "centimetre", Dimension: Length, Numerator: 1, Denominator: 100,  Aliases: []string{"centimetres", "centimetre", "centimeters", "centimeter", "cm"}},
+	{Name: "millimetre", Dimension: Length, Numerator: 1, Denominator: 1000, Aliases: []string{"millimetres", "millimetre", "millimeters", "millimeter", "mm"}},
+	{Name: "foot",       Dimension: Length, Numerator: 0.3048, Denominator: 1, Aliases: []string{"feet", "foot", "ft"}},
+	{Name: "inch",       Dimension: Length, Numerator: 0.0254, Denominator: 1, Aliases: []string{"inches", "inch", "in"}},
+	{Name: "yard",       Dimension: Length, Numerator: 0.9144, Denominator: 1, Aliases: []string{"yards", "yard", "yd"}},
+
+	{Name: "square metre", Dimension: Area, Numerator: 1, Denominator: 1,          Aliases: []string{"square metres", "square metre", "square meters", "square meter", "sq m", "sqm", "m2", "m²"}},
+	{Name: "square foot",  Dimension: Area, Numerator: 0.09290304, Denominator: 1, Aliases: []string{"square feet", "square foot", "sq ft", "sqft", "ft2", "ft²"}},
+
+	{Name: "wash", Dimension: Washes, Numerator: 1, Denominator: 1, Aliases: []string{"washes", "wash", "wsh", "loads", "load"}},
+
+	{Name: "sheet", Dimension: Sheets, Numerator: 1, Denominator: 1, Aliases: []string{"sheets", "sheet", "shts", "sht"}},
+}
+
+
+type alias struct {
+	text string
+	unit *Unit
+}
+
+// aliases holds every alias longest first, so "kg" is always tried before "g" and
+// "fl oz" before "oz". Ties are broken alphabetically, so matching never depends on map order.
+var aliases = buildAliases()
+
+func buildAliases() (result []alias) {
+	for _, u := range Units {
+		for _, a := range u.Aliases {
+			result = append(result, alias{text: a, unit: u})
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if len(result[i].text) != len(result[j].text) {
+			return len(result[i].text) > len(result[j].text)
+		}
+		return result[i].text < result[j].text
+	})
+
+	return result
+}
+
+
+// Canonical returns the canonical unit of a dimension.
+func Canonical(dimension Dimension) *Unit {
+	for _, u := range Units {
+		if u.Dimension == dimension {
+			return u
+		}
+	}
+	return nil
+}
+
+// ByName finds a unit by its name, e.g. the UnitType stored on a product.
+func ByName(name string) (u *Unit, ok bool) {
+	for _, u := range Units {
+		if u.Name == name {
+			return u, true
+		}
+	}
+	return nil, false
+}
+
+// DimensionOf returns the dimension of a stored UnitType such as "kilogram".
+func DimensionOf(unitType string) (dimension Dimension, ok bool) {
+	u, ok := ByName(unitType)
+	if !ok {
+		return "", false
+	}
+	return u.Dimension, true
+}
+
+
+// Lookup finds the unit at the start of text, e.g. "kg", "kg.", "Litre", "fl oz".
+// The alias must end at a word boundary, so "grapes" is not grams.
+func Lookup(text string) (u *Unit, ok bool) {
+	a, ok := lookup(text)
+	if !ok {
+		return nil, false
+	}
+	return a.unit, true
+}
+
+func lookup(text string) (match alias, ok bool) {
+	text = normalise(text)
+
+	for _, a := range aliases {
+		if !strings.HasPrefix(text, a.text) {
+			continue
+		}
+		rest := text[len(a.text):]
+		if rest == "" || !isLetter(rest[0]) {
+			return a, true
+		}
+	}
+
+	return alias{}, false
+}
+
+
+type Quantity struct {
+	Value float64
+	Unit  *Unit
+}
+
+// Canonical expresses the quantity in the canonical unit of its dimension.
+func (q Quantity) Canonical() Quantity {
+	return Quantity{Value: q.Unit.ToCanonical(q.Value), Unit: Canonical(q.Unit.Dimension)}
+}
+
+// Convert expresses the quantity in another unit of the same dimension.
+func (q Quantity) Convert(to *Unit) (converted Quantity, ok bool) {
+	if q.Unit.Dimension != to.Dimension {
+		return Quantity{}, false
+	}
+	return Quantity{Value: to.FromCanonical(q.Unit.ToCanonical(q.Value)), Unit: to}, true
+}
+
+// Times scales a quantity, e.g. for multipacks like "6 x 330ml".
+func (q Quantity) Times(n float64) Quantity {
+	return Quantity{Value: q.Value * n, Unit: q.Unit}
+}
+
+
+var quantityRegex = regexp.MustCompile(`^\s*([0-9]+(?:[.,][0-9]+)?)?\s*(.*)$`)
+
+// ParseQuantity reads "70cl", "100 g", "1,5L" or just "kg" (meaning 1 kg).
+func ParseQuantity(text string) (q Quantity, ok bool) {
+	matches := quantityRegex.FindStringSubmatch(text)
+	if matches == nil {
+		return Quantity{}, false
+	}
+
+	value := 1.0
+	if matches[1] != "" {
+		v, err := strconv.ParseFloat(strings.Replace(matches[1], ",", ".", 1), 64)
+		if err != nil || v <= 0 {
+			return Quantity{}, false
+		}
+		value = v
+	}
+
+	u, ok := Lookup(matches[2])
+	if !ok {
+		return Quantity{}, false
+	}
+
+	return Quantity{Value: value, Unit: u}, true
+}
+
+
+// PricePerCanonical converts a price for the given quantity into a price per canonical unit,
+// e.g. €43 for 70cl -> €61.43 per litre.
+func PricePerCanonical(price float64, q Quantity) (pricePerUnit float64, ok bool) {
+	if q.Unit == nil || q.Value <= 0 {
+		return 0.0, false
+	}
+	return price * q.Unit.Denominator / (q.Value * q.Unit.Numerator), true
+}
+
+
+func normalise(text string) string {
+	text = strings.ToLower(strings.TrimSpace(text))
+	text = strings.Join(strings.Fields(text), " ")
+	return strings.TrimLeft(text, ".")
+}
+
+func isLetter(b byte) bool {
+	return (b >= 'a' && b <= 'z') || b >= 0x80
+}
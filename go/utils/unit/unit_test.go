@@ -0,0 +1,119 @@
+package unit
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	testCases := []struct {
+		text          string
+		expectedUnit  string
+		expectedOk    bool
+	}{
+		{"kg",        "kilogram",     true},
+		{"Kg.",       "kilogram",     true},
+		{"g",         "gram",         true},
+		{"grams",     "gram",         true},
+		{"fl oz",     "fluid ounce",  true},
+		{"oz",        "ounce",        true},
+		{"lb",        "pound",        true},
+		{"ml",        "millilitre",   true},
+		{"m",         "metre",        true},
+		{"m²",        "square metre", true},
+		{"sq ft",     "square foot",  true},
+		{"each",      "each",         true},
+		{"sht",       "sheet",        true},
+		{"wash",      "wash",         true},
+		{"kg approx", "kilogram",     true},
+
+		// These should fail
+		{"grapes",    "",             false},
+		{"",          "",             false},
+		{"bunch",     "",             false},
+	}
+
+	// Run the table several times, the result must never depend on iteration order.
+	for run := 0; run < 20; run++ {
+		for _, tc := range testCases {
+			u, ok := Lookup(tc.text)
+			if ok != tc.expectedOk {
+				t.Fatalf("Expected ok to be %v, but got %v for '%s'", tc.expectedOk, ok, tc.text)
+			}
+			if ok && u.Name != tc.expectedUnit {
+				t.Fatalf("Expected '%s', but got '%s' for '%s'", tc.expectedUnit, u.Name, tc.text)
+			}
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	testCases := []struct {
+		quantity       string
+		to             string
+		expectedValue  float64
+		expectedOk     bool
+	}{
+		{"1 lb",      "kilogram",   0.45359237,   true},
+		{"16 oz",     "pound",      1.0,          true},
+		{"1 pint",    "millilitre", 568.26125,    true},
+		{"1 gallon",  "pint",       8.0,          true},
+		{"20 fl oz",  "pint",       1.0,          true},
+		{"70cl",      "litre",      0.7,          true},
+		{"3 ft",      "yard",       1.0,          true},
+		{"1 sq ft",   "square metre", 0.09290304, true},
+		{"2 dozen",   "each",       24.0,         true},
+
+		// Different dimensions can't be converted
+		{"1 kg",      "litre",      0.0,          false},
+	}
+
+	for _, tc := range testCases {
+		q, ok := ParseQuantity(tc.quantity)
+		if !ok {
+			t.Errorf("Failed to parse '%s'", tc.quantity)
+			continue
+		}
+		to, _ := ByName(tc.to)
+
+		converted, ok := q.Convert(to)
+		if ok != tc.expectedOk {
+			t.Errorf("Expected ok to be %v, but got %v for '%s' to %s", tc.expectedOk, ok, tc.quantity, tc.to)
+			continue
+		}
+		if ok && math.Abs(converted.Value-tc.expectedValue) > 1e-9 {
+			t.Errorf("Expected %f, but got %f for '%s' to %s", tc.expectedValue, converted.Value, tc.quantity, tc.to)
+		}
+	}
+}
+
+func TestPricePerCanonical(t *testing.T) {
+	testCases := []struct {
+		price          float64
+		quantity       string
+		expectedPrice  float64
+		expectedUnit   string
+	}{
+		{43,   "70cl",   61.42857142857143, "litre"},
+		{0.5,  "100g",   5.0,               "kilogram"},
+		{4.5,  "1 lb",   9.920801798319491, "kilogram"},
+		{2.4,  "6 pack", 0.4,               "each"},
+		{3,    "150 sheets", 0.02,          "sheet"},
+	}
+
+	for _, tc := range testCases {
+		q, ok := ParseQuantity(tc.quantity)
+		if !ok {
+			t.Errorf("Failed to parse '%s'", tc.quantity)
+			continue
+		}
+
+		price, ok := PricePerCanonical(tc.price, q)
+		if !ok || math.Abs(price-tc.expectedPrice) > 1e-9 {
+			t.Errorf("Expected %f, but got %f for %f per '%s'", tc.expectedPrice, price, tc.price, tc.quantity)
+		}
+		if Canonical(q.Unit.Dimension).Name != tc.expectedUnit {
+			t.Errorf("Expected unit '%s', but got '%s' for '%s'", tc.expectedUnit, Canonical(q.Unit.Dimension).Name, tc.quantity)
+		}
+	}
+}
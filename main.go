@@ -1,33 +1,86 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/jakubruminski/FYP/go/api"
 	"github.com/jakubruminski/FYP/go/api/query"
+	"github.com/jakubruminski/FYP/go/api/repository"
 	"github.com/jakubruminski/FYP/go/router/mux"
 
+	"github.com/jakubruminski/FYP/go/utils/currency"
 	"github.com/jakubruminski/FYP/go/utils/env"
 	"github.com/jakubruminski/FYP/go/utils/logger"
+	"github.com/jakubruminski/FYP/go/utils/postgres"
 )
 
 
 func main() {
-	fmt.Println("\033[H\033[2J")
 	logger := &logger.Logger{}
 
+	// go run . migrate up|down|status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		ok := query.Migrate(logger, os.Args[2:])
+		if !ok { os.Exit(1) }
+		return
+	}
+
+	fmt.Println("\033[H\033[2J")
+
+	// Background jobs and the queries of requests in flight stop on Ctrl-C or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	db_available, ok := env.GetBool(logger, "DB_AVAILABLE")
 	if !ok { logger.ERROR("Failed to get DB_AVAILABLE from environment"); return }
 
 	if db_available {
-    	ok := query.INITIALISE_DATABASE(logger)
+		ok := postgres.Open(logger, env.GetIntDefault(logger, "DB_CONNECT_ATTEMPTS", 30))
+		if !ok { logger.ERROR("Failed to connect to the database"); return }
+		defer postgres.Close()
+
+		postgres.StartHealthCheck(logger)
+
+    	ok = query.INITIALISE_DATABASE(logger)
 		if !ok { logger.ERROR("Failed to initialize database"); return }
+
+		repository.Default = repository.NewPostgres()
+
+		api.StartCacheGC(logger, ctx)
+
+		ok = api.LoadDeals(logger, ctx)
+		if !ok { logger.WARN("Failed to load deals, the feed fills up as searches come in") }
+	} else {
+		logger.WARN("No database, products, searches, baskets, watches and price history are kept in memory until the server stops")
 	}
+
+	currency.INIT(logger)
+	api.StartNotifier(logger, ctx)
+	api.StartSuggester(logger, ctx)
 	
 	port, mux, ok := mux.INIT(logger)
 	if !ok { logger.ERROR("Failed to initialize router"); return }
 
 	logger.INFO("Listening on port http://localhost:" + port)
 
-	http.ListenAndServe(":"+port, mux)
+	server := &http.Server{
+		Addr:        ":" + port,
+		Handler:     mux,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+
+	err := server.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		logger.ERROR("Server stopped. Reason: %s", err)
+	}
 }
\ No newline at end of file